@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+// repoArtifactRoots returns the directories holding all of the artifacts of
+// the repo 'repoName' in 'backupDirPath', according to -layout and
+// -dir_flat_issues. Some of them may not exist
+func repoArtifactRoots(backupDirPath, repoName string) []string {
+	var roots []string
+	if *layoutFlag == layoutNested {
+		roots = append(roots, filepath.Join(backupDirPath, repoName))
+	} else {
+		for _, kind := range []string{artifactCode, artifactMeta, artifactPulls, artifactSource, artifactReleases,
+			artifactDeployments, artifactSecurity} {
+			roots = append(roots, repoArtifactPath(backupDirPath, repoName, kind))
+		}
+	}
+	if *layoutFlag != layoutNested || *dirFlatIssuesFlag {
+		roots = append(roots, repoArtifactPath(backupDirPath, repoName, artifactIssues))
+	}
+	return roots
+}
+
+// addDirToZip adds 'dir', recursively, to 'zw'. Entries are named after their
+// path relative to 'baseDir'
+func addDirToZip(zw *zip.Writer, baseDir, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		// XXX Directories are added too, even empty ones: a bare git repo
+		// without its (often empty) 'refs' directory isn't a git repo anymore
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			print.Debugf("Not zipping %s: not a regular file\n", path)
+			return nil
+		}
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		_, err = io.Copy(w, fd)
+		return err
+	})
+}
+
+// zipRepo writes every artifact of the repo 'repoName' to '<name>.zip' in
+// 'backupDirPath', streaming it to disk through a temporary file. With
+// -archive_cleanup, the zipped directories are removed once the zip is
+// complete
+func zipRepo(backupDirPath, repoName string) error {
+	print.DebugFunc()
+
+	zipPath := filepath.Join(backupDirPath, repoName+".zip")
+	tmpPath := zipPath + ".tmp"
+	err := checkWritePath(zipPath)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	zw := zip.NewWriter(fd)
+	var zipped []string
+	for _, root := range repoArtifactRoots(backupDirPath, repoName) {
+		if !util.IsDirectory(root) {
+			continue
+		}
+		err = addDirToZip(zw, backupDirPath, root)
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		zipped = append(zipped, root)
+	}
+	err = zw.Close()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+	print.Debugf("Zipped %s to %s\n", repoName, zipPath)
+	err = os.Rename(tmpPath, zipPath)
+	if err != nil {
+		return err
+	}
+	if !*archiveCleanupFlag {
+		return nil
+	}
+	for _, root := range zipped {
+		print.Debugf("Removing %s\n", root)
+		err = os.RemoveAll(root)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const assigneesFileName = "assignees.json"
+
+// writeRepoAssignees writes which of 'issues', the issues and PRs already
+// fetched for 'repo', are assigned to each user to 'assignees.json' in its
+// meta directory, as a map of login to issue numbers
+func writeRepoAssignees(backupDirPath string, repo *github.Repository, issues []*github.Issue) error {
+	print.DebugFunc()
+
+	assigned := map[string][]int{}
+	for _, issue := range issues {
+		for _, assignee := range issue.Assignees {
+			login := assignee.GetLogin()
+			assigned[login] = append(assigned[login], issue.GetNumber())
+		}
+	}
+	for _, numbers := range assigned {
+		sort.Ints(numbers)
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up the assignees of %d users for repo %s to %s\n", len(assigned), *repo.Name, targetDir)
+	return writeJSONFile(filepath.Join(targetDir, assigneesFileName), assigned)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+const attachmentIndexFileName = "index.json"
+
+// attachmentURLRegexp matches the URLs GitHub stores issue and comment
+// attachments at
+var attachmentURLRegexp = regexp.MustCompile(`https://(?:` +
+	`(?:private-)?user-images\.githubusercontent\.com/[^\s)"'<>\]]+|` +
+	`github\.com/user-attachments/(?:assets|files)/[^\s)"'<>\]]+|` +
+	`github\.com/[\w.-]+/[\w.-]+/files/\d+/[^\s)"'<>\]]+)`)
+
+// attachmentStore is a content-addressed store of downloaded attachments:
+// every file is stored once, as 'objects/<sha256>', however many issues
+// reference it. 'objects/index.json' maps each original URL to its hash.
+type attachmentStore struct {
+	dir        string
+	httpClient *http.Client
+	mu         sync.Mutex
+	// index maps an attachment's URL to the sha256 of its content
+	index map[string]string
+	// urlLocks keeps two repos referencing the same attachment from
+	// downloading it to the same partial file at the same time
+	urlLocks map[string]*sync.Mutex
+}
+
+// newAttachmentStore opens (or creates) the store in 'backupDirPath/objects'.
+// 'httpClient' is used for downloads.
+//
+// XXX It must not be the API client: its Authorization header would follow
+// the redirects to the S3 and CDN hosts attachments are served from, leaking
+// the token to them, and S3 refuses a signed URL that also has one
+func newAttachmentStore(backupDirPath string, httpClient *http.Client) (*attachmentStore, error) {
+	store := &attachmentStore{
+		dir:        filepath.Join(backupDirPath, "objects"),
+		httpClient: httpClient,
+		index:      map[string]string{},
+		urlLocks:   map[string]*sync.Mutex{},
+	}
+	err := os.MkdirAll(store.dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	indexPath := filepath.Join(store.dir, attachmentIndexFileName)
+	if util.IsFile(indexPath) {
+		b, err := os.ReadFile(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		// XXX Indexes of older runs went through -bom
+		err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), &store.index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func (s *attachmentStore) objectPath(hash string) string {
+	return filepath.Join(s.dir, hash)
+}
+
+// fetch returns the path 'url' is stored at, downloading it if it isn't in
+// the store yet
+func (s *attachmentStore) fetch(ctx context.Context, url string) (string, error) {
+	s.mu.Lock()
+	urlLock, ok := s.urlLocks[url]
+	if !ok {
+		urlLock = &sync.Mutex{}
+		s.urlLocks[url] = urlLock
+	}
+	s.mu.Unlock()
+	urlLock.Lock()
+	defer urlLock.Unlock()
+
+	s.mu.Lock()
+	hash, ok := s.index[url]
+	s.mu.Unlock()
+	if ok && util.IsFile(s.objectPath(hash)) {
+		return s.objectPath(hash), nil
+	}
+
+	print.Debugf("Downloading attachment %s...\n", url)
+	// XXX The partial download is named after the URL, so an interrupted one
+	// is resumed on the next run instead of starting over
+	urlHash := sha256.Sum256([]byte(url))
+	partialPath := filepath.Join(s.dir, "download-"+hex.EncodeToString(urlHash[:])+partialSuffix)
+	err := resumeDownload(ctx, s.httpClient, url, partialPath, -1, nil)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(partialPath)
+	hash, err = fileSHA256(partialPath)
+	if err != nil {
+		return "", err
+	}
+	objectPath := s.objectPath(hash)
+	if !util.IsFile(objectPath) {
+		err = os.Rename(partialPath, objectPath)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		print.Debugf("Attachment %s is already stored as %s\n", url, hash)
+	}
+	s.mu.Lock()
+	s.index[url] = hash
+	s.mu.Unlock()
+	return objectPath, nil
+}
+
+// rewrite downloads every attachment referenced in 'text' and replaces its URL
+// with the path of the stored object, relative to 'fromDir'.
+//
+// XXX An attachment that fails to download keeps its original URL: a single
+// expired link shouldn't fail the whole backup
+func (s *attachmentStore) rewrite(ctx context.Context, fromDir, text string) string {
+	return attachmentURLRegexp.ReplaceAllStringFunc(text, func(url string) string {
+		objectPath, err := s.fetch(ctx, url)
+		if err != nil {
+			print.Warnf("Couldn't download attachment %s: %v\n", url, err)
+			return url
+		}
+		rel, err := filepath.Rel(fromDir, objectPath)
+		if err != nil {
+			return url
+		}
+		return filepath.ToSlash(rel)
+	})
+}
+
+// rewriteIssue rewrites the attachments of the body and comments of 'issue',
+// which is written in 'issueDir'
+func (s *attachmentStore) rewriteIssue(ctx context.Context, issueDir string, issue *export.Issue) {
+	if issue.Body != nil {
+		body := s.rewrite(ctx, issueDir, *issue.Body)
+		issue.Body = &body
+	}
+	for i := range issue.Comments {
+		issue.Comments[i].Body = s.rewrite(ctx, issueDir, issue.Comments[i].Body)
+	}
+}
+
+// writeIndex writes the URL->hash index of the store
+func (s *attachmentStore) writeIndex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeStateFile(filepath.Join(s.dir, attachmentIndexFileName), s.index)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// backupOrgAuditLog uses 'client' and 'ctx' to page through the audit log of
+// 'org' and write every event to 'org__audit/audit.ndjson', one JSON object
+// per line. If 'since' isn't zero, only events created since then are fetched.
+//
+// XXX The audit log is only available to org owners on GitHub Enterprise
+// Cloud. If the token or the plan doesn't allow it, this is skipped with a
+// warning instead of failing the run.
+func backupOrgAuditLog(client *github.Client, ctx context.Context,
+	backupDirPath string, org string, since time.Time) error {
+	print.DebugFunc()
+
+	opts := &github.GetAuditLogOptions{
+		Include:           github.Ptr("all"),
+		Order:             github.Ptr("asc"),
+		ListCursorOptions: github.ListCursorOptions{PerPage: 100},
+	}
+	if !since.IsZero() {
+		opts.Phrase = github.Ptr("created:>=" + since.UTC().Format(time.RFC3339))
+	}
+
+	var fd *os.File
+	var enc *json.Encoder
+	eventCount := 0
+	pageCount := 0
+	for {
+		print.Debugf("Fetching audit log events on page %d (total fetched: %d)...\n", pageCount, eventCount)
+		entries, resp, err := client.Organizations.GetAuditLog(ctx, org, opts)
+		if wait, ok := retryAfterRateLimit(err); ok {
+			print.Debugf("Rate limited while fetching the audit log: retrying in %v\n", wait)
+			err = sleepContext(ctx, wait)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			if fd == nil && isAccessDenied(err) {
+				print.Warnf("Skipping audit log of %s: the token or the org's plan doesn't allow it (%v)\n", org, err)
+				return nil
+			}
+			if fd != nil {
+				fd.Close()
+			}
+			return err
+		}
+		// XXX Only create the file once we know we have access
+		if fd == nil {
+			targetDir := orgArtifactPath(backupDirPath, "audit")
+			err = os.MkdirAll(targetDir, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			err = checkWritePath(filepath.Join(targetDir, "audit.ndjson"))
+			if err != nil {
+				return err
+			}
+			fd, err = os.Create(filepath.Join(targetDir, "audit.ndjson"))
+			if err != nil {
+				return err
+			}
+			enc = json.NewEncoder(fd)
+		}
+		for _, entry := range entries {
+			err = enc.Encode(entry)
+			if err != nil {
+				fd.Close()
+				return err
+			}
+		}
+		eventCount += len(entries)
+		if len(resp.After) == 0 {
+			break
+		}
+		opts.ListCursorOptions.After = resp.After
+		pageCount++
+		err = waitForRateLimit(ctx, resp)
+		if err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	print.Debugf("Backed up %d audit log events for %s\n", eventCount, org)
+	return fd.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const authorsFileName = "authors.txt"
+
+// backupRepoAuthors writes every distinct author and committer of the
+// history of 'repo', as 'Name <email>', to 'authors.txt' in its meta
+// directory, one per line and sorted. It's read from the repo's mirror,
+// which must already be cloned
+func backupRepoAuthors(ctx context.Context, backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	mirrorDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
+	out, err := runCommand(ctx, mirrorDir, nil, "git", "log", "--all",
+		"--format=%an <%ae>%n%cn <%ce>")
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var authors []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || seen[line] {
+			continue
+		}
+		seen[line] = true
+		authors = append(authors, line)
+	}
+	sort.Strings(authors)
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d authors of %s to %s\n", len(authors), *repo.Name, targetDir)
+	var content string
+	if len(authors) != 0 {
+		content = strings.Join(authors, "\n") + "\n"
+	}
+	return writeTextFile(filepath.Join(targetDir, authorsFileName), []byte(content))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// defaultDirTemplate is the name the backup directory always had:
+// 'backup__<yyMMdd_hhmmss>__<org>'
+const defaultDirTemplate = "backup__{{.Date}}__{{.Org}}"
+
+// dirTemplateVars are the variables available to -dir_template
+type dirTemplateVars struct {
+	Org string
+	// Date is the time the run started, as yyMMdd_hhmmss
+	Date string
+	// User is the name of the local user running the backup
+	User string
+}
+
+func newDirTemplateVars(org string) dirTemplateVars {
+	username := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	return dirTemplateVars{
+		Org:  org,
+		Date: runStartedAt.Format("060102_150405"),
+		User: username,
+	}
+}
+
+// expandDirTemplate executes the Go template 'tmpl' with 'vars' and returns
+// the resulting relative path
+func expandDirTemplate(tmpl string, vars dirTemplateVars) (string, error) {
+	t, err := template.New("dir_template").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, vars)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Clean(buf.String())
+	if filepath.IsAbs(dir) || dir == "." || dir == ".." ||
+		strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", print.Errorf("-dir_template %q expands to %q, which isn't a relative path",
+			tmpl, buf.String())
+	}
+	return dir, nil
+}
+
+// isFlagSet returns true if the flag 'name' was explicitly passed on the
+// command line
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	avatarFileName        = "avatar"
+	socialPreviewFileName = "social_preview"
+)
+
+// imageExtensions maps the content types http.DetectContentType finds in
+// images to the extension their file gets
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// sniffImageExtension returns the extension of the image at 'path', from its
+// first bytes, or ".img" if it's no format it knows
+func sniffImageExtension(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(fd, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if ext, ok := imageExtensions[contentType]; ok {
+		return ext, nil
+	}
+	if strings.Contains(string(head[:n]), "<svg") {
+		return ".svg", nil
+	}
+	return ".img", nil
+}
+
+// downloadImage downloads the image at 'url' to '<targetDir>/<name><ext>',
+// with the extension of its format, replacing a previous one of any format.
+// Avatars and social previews are public CDN URLs: 'httpClient' mustn't
+// send the API token to them
+func downloadImage(ctx context.Context, httpClient *http.Client, url, targetDir, name string) error {
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	partialPath := filepath.Join(targetDir, name+partialSuffix)
+	// XXX Images are small: there's nothing worth resuming from an earlier run
+	os.Remove(partialPath)
+	err = resumeDownload(ctx, httpClient, url, partialPath, -1, nil)
+	if err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+	ext, err := sniffImageExtension(partialPath)
+	if err != nil {
+		return err
+	}
+	// The image may have changed format since the last backup
+	previous, err := filepath.Glob(filepath.Join(targetDir, name+".*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range previous {
+		if path != partialPath && path != filepath.Join(targetDir, name+ext) {
+			os.Remove(path)
+		}
+	}
+	print.Debugf("Downloaded %s to %s\n", url, filepath.Join(targetDir, name+ext))
+	return os.Rename(partialPath, filepath.Join(targetDir, name+ext))
+}
+
+// backupOrgAvatar uses 'client' and 'ctx' to download the avatar of 'org' to
+// 'org__meta/avatar.<ext>'
+func backupOrgAvatar(client *github.Client, ctx context.Context, backupDirPath, org string) error {
+	print.DebugFunc()
+
+	o, resp, err := client.Organizations.Get(ctx, org)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Warnf("Skipping avatar of %s: %v\n", org, err)
+			return nil
+		}
+		return err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if len(o.GetAvatarURL()) == 0 {
+		print.Debugf("%s has no avatar\n", org)
+		return nil
+	}
+	return downloadImage(ctx, http.DefaultClient, o.GetAvatarURL(),
+		orgArtifactPath(backupDirPath, artifactMeta), avatarFileName)
+}
+
+// backupRepoSocialPreview uses 'client' and 'ctx' to download the social
+// preview image of 'repo', the one shown when it's linked to, to
+// 'social_preview.<ext>' in its meta directory.
+//
+// XXX Only an image that was uploaded is downloaded: GitHub's default one is
+// generated from the repo's description and counts, which are already in its
+// metadata. The REST API doesn't have it, so it takes a GraphQL query
+func backupRepoSocialPreview(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	const query = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    openGraphImageUrl
+    usesCustomOpenGraphImage
+  }
+}`
+	var data struct {
+		Repository struct {
+			OpenGraphImageURL        string `json:"openGraphImageUrl"`
+			UsesCustomOpenGraphImage bool   `json:"usesCustomOpenGraphImage"`
+		} `json:"repository"`
+	}
+	err := queryGraphQL(client, ctx, query, map[string]interface{}{
+		"owner": repo.GetOwner().GetLogin(),
+		"name":  repo.GetName(),
+	}, &data)
+	if err != nil {
+		if isGraphQLAccessDenied(err) {
+			print.Debugf("Skipping social preview of %s: %v\n", repo.GetName(), err)
+			return nil
+		}
+		return err
+	}
+	if !data.Repository.UsesCustomOpenGraphImage || len(data.Repository.OpenGraphImageURL) == 0 {
+		print.Debugf("%s has no custom social preview\n", repo.GetName())
+		return nil
+	}
+	err = downloadImage(ctx, http.DefaultClient, data.Repository.OpenGraphImageURL,
+		repoArtifactPath(backupDirPath, repo.GetName(), artifactMeta), socialPreviewFileName)
+	if err != nil {
+		// XXX Like attachments, an expired image link shouldn't fail the repo
+		print.Warnf("Failed to download the social preview of %s: %v\n", repo.GetName(), err)
+	}
+	return nil
+}
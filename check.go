@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// runHealthCheck uses 'client' and 'ctx' to confirm the token works and 'org'
+// exists, without listing or backing up anything: it prints the
+// authenticated login, the org, its repo count and the rate limit status
+func runHealthCheck(client *github.Client, ctx context.Context, org string) error {
+	print.DebugFunc()
+
+	// XXX Installation tokens can't read the authenticated user: the org
+	// lookup below is what checks them
+	if *githubAppFlag {
+		print.Infof("Authenticated as installation %d of GitHub App %d\n",
+			*githubAppInstallationIDFlag, *githubAppIDFlag)
+	} else {
+		user, _, err := client.Users.Get(ctx, "")
+		if err != nil {
+			return print.Errorf("token check failed: %v", err)
+		}
+		print.Infof("Authenticated as: %s\n", user.GetLogin())
+	}
+
+	o, _, err := client.Organizations.Get(ctx, org)
+	if err != nil {
+		return print.Errorf("org check failed for %s: %v", org, err)
+	}
+	print.Infof("Organization: %s (%s)\n", o.GetLogin(), o.GetName())
+	// XXX The private repo count is only visible to org members
+	print.Infof("Repos: %d public, %d private\n", o.GetPublicRepos(), o.GetTotalPrivateRepos())
+
+	limits, _, err := client.RateLimit.Get(ctx)
+	if err != nil {
+		return print.Errorf("rate limit check failed: %v", err)
+	}
+	if core := limits.GetCore(); core != nil {
+		print.Infof("Rate limit: %d/%d requests left, resets at %v\n",
+			core.Remaining, core.Limit, core.Reset.Time.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+const defaultGitCloneArgs = "--mirror --recurse-submodules -j8"
+
+// gitCloneArgs are the validated arguments from -git_clone_args. They're set
+// once the flags are parsed
+var gitCloneArgs []string
+
+var (
+	cloneArgRegexp = regexp.MustCompile(`^[A-Za-z0-9._=:/@+,-]+$`)
+	// shortCloneOptionRegexp matches a single short option, e.g. '-q', or
+	// '-j' glued to its value, e.g. '-j8'. Anything else could be a bundle
+	// of short options hiding a forbidden one, e.g. '-qu<command>'
+	shortCloneOptionRegexp = regexp.MustCompile(`^-([A-Za-z]|j[0-9]+)$`)
+)
+
+// cloneOptionsWithValue are the 'git clone' options taking their value as the
+// next argument. It's the only case a non-option argument is allowed
+var cloneOptionsWithValue = map[string]bool{
+	"-c": true, "--config": true,
+	"-j": true, "--jobs": true,
+	"-b": true, "--branch": true,
+	"-o": true, "--origin": true,
+	"--depth":           true,
+	"--filter":          true,
+	"--shallow-since":   true,
+	"--shallow-exclude": true,
+}
+
+// forbiddenCloneOptions are the 'git clone' options that make git run
+// arbitrary commands or read/write outside the target directory
+var forbiddenCloneOptions = []string{
+	"-u", "--upload-pack", "--template", "--separate-git-dir",
+	"--reference", "--reference-if-able", "--config-env",
+}
+
+// allowedConfigKeys are the only config keys, lowercased, that can be set
+// through '-c'. Too many keys make git run a command (core.askPass,
+// filter.<driver>.smudge, diff.<driver>.textconv, ...) for a denylist to be
+// safe, so anything else is rejected
+var allowedConfigKeys = map[string]bool{
+	"http.lowspeedlimit": true,
+	"http.lowspeedtime":  true,
+	"http.postbuffer":    true,
+	"core.compression":   true,
+	"pack.window":        true,
+	"pack.windowmemory":  true,
+}
+
+// parseGitCloneArgs splits 'value' on whitespace and validates every
+// argument, so -git_clone_args can't be used to run something else than a
+// plain 'git clone'. The URL and target directory are always appended by
+// cloneRepo and must not be part of 'value'
+func parseGitCloneArgs(value string) ([]string, error) {
+	args := strings.Fields(value)
+	for i, arg := range args {
+		if !cloneArgRegexp.MatchString(arg) {
+			return nil, print.Errorf("-git_clone_args: %q contains forbidden characters", arg)
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if i == 0 || !cloneOptionsWithValue[args[i-1]] {
+				return nil, print.Errorf("-git_clone_args: %q isn't an option", arg)
+			}
+			if args[i-1] == "-c" || args[i-1] == "--config" {
+				err := checkCloneConfigArg(arg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if arg == "--" {
+			return nil, print.Errorf("-git_clone_args: '--' isn't allowed")
+		}
+		if !strings.HasPrefix(arg, "--") && !shortCloneOptionRegexp.MatchString(arg) {
+			return nil, print.Errorf("-git_clone_args: %q: pass short options separately", arg)
+		}
+		name := strings.SplitN(arg, "=", 2)[0]
+		for _, forbidden := range forbiddenCloneOptions {
+			// XXX git accepts any unambiguous prefix of a long option, e.g.
+			// '--upload' for '--upload-pack'
+			isAbbreviation := strings.HasPrefix(name, "--") && len(name) > 2 &&
+				strings.HasPrefix(forbidden, name) && !cloneOptionsWithValue[name]
+			if name == forbidden || isAbbreviation {
+				return nil, print.Errorf("-git_clone_args: %s isn't allowed", forbidden)
+			}
+		}
+		if name == "--config" && strings.Contains(arg, "=") {
+			err := checkCloneConfigArg(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cloneOptionsWithValue[arg] && i == len(args)-1 {
+			return nil, print.Errorf("-git_clone_args: %s needs a value", arg)
+		}
+	}
+	return args, nil
+}
+
+func checkCloneConfigArg(value string) error {
+	key := strings.ToLower(strings.SplitN(value, "=", 2)[0])
+	if !allowedConfigKeys[key] {
+		return print.Errorf("-git_clone_args: setting %s isn't allowed", key)
+	}
+	return nil
+}
+
+// submoduleCloneOptions are the 'git clone' options that clone submodules
+// along with the repo
+var submoduleCloneOptions = []string{"--recurse-submodules", "--recursive"}
+
+// withoutSubmodules returns 'args' without the options that make 'git clone'
+// clone submodules, for -no_submodules
+func withoutSubmodules(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		name := strings.SplitN(arg, "=", 2)[0]
+		isSubmoduleOption := false
+		for _, option := range submoduleCloneOptions {
+			// XXX Like in parseGitCloneArgs, abbreviations count: '--recurse'
+			// is '--recurse-submodules'
+			if name == option || (len(name) >= len("--rec") && strings.HasPrefix(option, name)) {
+				isSubmoduleOption = true
+				break
+			}
+		}
+		if isSubmoduleOption {
+			print.Debugf("-no_submodules: dropping %s from the clone arguments\n", arg)
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// orgHealthRepoName is the repo GitHub takes an org's default community
+// health files (issue/PR templates, CONTRIBUTING, CODE_OF_CONDUCT, etc.) from
+const orgHealthRepoName = ".github"
+
+// communityFileEntry is a single file of the org's '.github' repo in
+// 'files.json'
+type communityFileEntry struct {
+	Path string `json:"path"`
+	SHA  string `json:"sha"`
+	Size int    `json:"size"`
+}
+
+// communityHealthEntry is the community profile of a single repo in
+// 'health.json', i.e. which community health files GitHub found for it
+type communityHealthEntry struct {
+	Repo    string                         `json:"repo"`
+	Metrics *github.CommunityHealthMetrics `json:"metrics"`
+}
+
+// backupOrgHealthFiles uses 'client' and 'ctx' to copy every file of the
+// default branch of the '.github' repo of 'org' to 'targetDir/files/', and
+// to list them in 'targetDir/files.json'. Orgs without one are skipped
+func backupOrgHealthFiles(client *github.Client, ctx context.Context, targetDir, org string) error {
+	repo, _, err := client.Repositories.Get(ctx, org, orgHealthRepoName)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("No %s repo in %s: %v\n", orgHealthRepoName, org, err)
+			return nil
+		}
+		return err
+	}
+	tree, _, err := client.Git.GetTree(ctx, org, orgHealthRepoName, repo.GetDefaultBranch(), true)
+	if err != nil {
+		if isAccessDenied(err) {
+			// XXX An empty repo has no tree
+			print.Debugf("Can't list the files of %s/%s: %v\n", org, orgHealthRepoName, err)
+			return nil
+		}
+		return err
+	}
+	if tree.GetTruncated() {
+		print.Warnf("%s/%s has too many files: only some of them are backed up\n", org, orgHealthRepoName)
+	}
+	index := []communityFileEntry{}
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" {
+			continue
+		}
+		path := filepath.Join(targetDir, "files", filepath.FromSlash(entry.GetPath()))
+		err = checkWritePath(path)
+		if err != nil {
+			return err
+		}
+		b, resp, err := client.Git.GetBlobRaw(ctx, org, orgHealthRepoName, entry.GetSHA())
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path, b, 0644)
+		if err != nil {
+			return err
+		}
+		index = append(index, communityFileEntry{
+			Path: entry.GetPath(),
+			SHA:  entry.GetSHA(),
+			Size: entry.GetSize(),
+		})
+		err = waitForRateLimit(ctx, resp)
+		if err != nil {
+			return err
+		}
+	}
+	return writeJSONFile(filepath.Join(targetDir, "files.json"), index)
+}
+
+// backupOrgCommunity uses 'client' and 'ctx' to back up the default
+// community health files of 'org', from its '.github' repo, and the community
+// profile of each of 'repos' to 'org__meta/community/'.
+//
+// XXX A repo's profile tells which health files apply to it, whether they're
+// its own or the org's defaults. It costs one API call per repo
+func backupOrgCommunity(client *github.Client, ctx context.Context,
+	backupDirPath, org string, repos []*github.Repository) error {
+	print.DebugFunc()
+
+	targetDir := filepath.Join(orgArtifactPath(backupDirPath, artifactMeta), "community")
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = backupOrgHealthFiles(client, ctx, targetDir, org)
+	if err != nil {
+		return err
+	}
+	health := []communityHealthEntry{}
+	for _, repo := range repos {
+		metrics, resp, err := client.Repositories.GetCommunityHealthMetrics(ctx, *repo.Owner.Login, *repo.Name)
+		if err != nil {
+			if isAccessDenied(err) {
+				print.Debugf("Skipping community profile of %s: %v\n", *repo.Name, err)
+				continue
+			}
+			return err
+		}
+		health = append(health, communityHealthEntry{Repo: *repo.Name, Metrics: metrics})
+		err = waitForRateLimit(ctx, resp)
+		if err != nil {
+			return err
+		}
+	}
+	return writeJSONFile(filepath.Join(targetDir, "health.json"), health)
+}
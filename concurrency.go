@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	// defaultConcurrencyAutoMax is the most workers -concurrency_auto ramps up
+	// to when -concurrency isn't supplied
+	defaultConcurrencyAutoMax = 8
+	// concurrencyIncreaseInterval is how long -concurrency_auto waits between
+	// two increases of the worker count
+	concurrencyIncreaseInterval = 10 * time.Second
+	// concurrencyAbuseCooldown is how long -concurrency_auto refuses to add
+	// workers after GitHub pushed back with a secondary rate limit
+	concurrencyAbuseCooldown = time.Minute
+)
+
+// concurrencyController caps how many repos are backed up at the same time.
+//
+// With 'auto', the cap starts at 1 and is tuned from the rate limit headers of
+// every API response: it grows by one at a time while more than half of the
+// rate limit is left, shrinks by one when less than a tenth is left and is
+// halved when GitHub answers with a secondary ("abuse") rate limit.
+//
+// XXX The rate limit is per token, not per worker, so every worker shares the
+// same controller
+type concurrencyController struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	auto   bool
+	max    int
+	limit  int
+	active int
+	// lastIncrease is when 'limit' was last increased
+	lastIncrease time.Time
+	// holdUntil is when 'limit' is allowed to increase again after an abuse
+	// rate limit
+	holdUntil time.Time
+}
+
+// newConcurrencyController returns a controller that runs up to 'n' workers.
+// With 'auto', 'n' is only the upper bound
+func newConcurrencyController(n int, auto bool) *concurrencyController {
+	c := &concurrencyController{auto: auto, max: n, limit: n}
+	if auto {
+		c.limit = 1
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// acquire blocks until there is room for one more worker
+func (c *concurrencyController) acquire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.active >= c.limit {
+		c.cond.Wait()
+	}
+	c.active++
+}
+
+// release hands back the room taken by acquire
+func (c *concurrencyController) release() {
+	c.mu.Lock()
+	c.active--
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// setLimitLocked changes the cap to 'limit', clamped to [1, max]. 'c.mu' must
+// be held
+func (c *concurrencyController) setLimitLocked(limit int, reason string) {
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > c.max {
+		limit = c.max
+	}
+	if limit == c.limit {
+		return
+	}
+	print.Debugf("Adjusting concurrency from %d to %d: %s\n", c.limit, limit, reason)
+	c.limit = limit
+	c.cond.Broadcast()
+}
+
+// observe tunes the cap from the rate limit headers of 'resp'. It's a no-op
+// unless the controller is in auto mode
+func (c *concurrencyController) observe(resp *http.Response) {
+	if !c.auto {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	// Secondary rate limits come back as a 403 or 429 with a Retry-After
+	if (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		len(resp.Header.Get("Retry-After")) != 0 {
+		c.holdUntil = now.Add(concurrencyAbuseCooldown)
+		c.setLimitLocked(c.limit/2, "hit a secondary rate limit")
+		return
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil || limit == 0 {
+		return
+	}
+	switch {
+	case remaining < limit/10:
+		c.setLimitLocked(c.limit-1, strconv.Itoa(remaining)+" requests left")
+	case remaining > limit/2 && now.After(c.holdUntil) &&
+		now.Sub(c.lastIncrease) >= concurrencyIncreaseInterval:
+		c.lastIncrease = now
+		c.setLimitLocked(c.limit+1, strconv.Itoa(remaining)+" requests left")
+	}
+}
+
+// observingTransport calls 'observe' with every response that goes through
+// 'base'
+type observingTransport struct {
+	base    http.RoundTripper
+	observe func(resp *http.Response)
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.observe(resp)
+	}
+	return resp, err
+}
+
+// runConcurrently calls 'work' for every index in [0, n), running as many of
+// them at the same time as 'c' allows. Once a call fails, or 'ctx' is done, no
+// new one is started and the first error is returned after the running ones
+// finish
+func runConcurrently(ctx context.Context, c *concurrencyController, n int, work func(i int) error) error {
+	return runConcurrentlyPerHost(ctx, c, nil, n, nil, work)
+}
+
+// runConcurrentlyPerHost is runConcurrently, with the indices also capped by
+// the limit 'hosts' has for the host 'hostOf' returns for each of them.
+// 'hosts' and 'hostOf' may be nil.
+//
+// XXX Each host has its own queue, started in order, and the host's slot is
+// taken before the run's: a worker waiting on a saturated host doesn't hold a
+// slot another host could use
+func runConcurrentlyPerHost(ctx context.Context, c *concurrencyController, hosts *hostConcurrency,
+	n int, hostOf func(i int) string, work func(i int) error) error {
+	var queueOrder []string
+	queues := map[string][]int{}
+	for i := 0; i < n; i++ {
+		host := ""
+		if hostOf != nil {
+			host = hostOf(i)
+		}
+		if _, ok := queues[host]; !ok {
+			queueOrder = append(queueOrder, host)
+		}
+		queues[host] = append(queues[host], i)
+	}
+
+	var wg, dispatchers sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, host := range queueOrder {
+		dispatchers.Add(1)
+		go func(hostController *concurrencyController, indices []int) {
+			defer dispatchers.Done()
+			for _, i := range indices {
+				if hostController != nil {
+					hostController.acquire()
+				}
+				c.acquire()
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed || ctx.Err() != nil {
+					c.release()
+					if hostController != nil {
+						hostController.release()
+					}
+					return
+				}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if hostController != nil {
+						defer hostController.release()
+					}
+					defer c.release()
+					err := work(i)
+					if err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+					}
+				}(i)
+			}
+		}(hosts.controller(host), queues[host])
+	}
+	// XXX Workers are only added by the dispatchers: once they're done,
+	// 'wg' can't grow anymore
+	dispatchers.Wait()
+	wg.Wait()
+	return firstErr
+}
+
+// hostConcurrency caps how many repos cloned from the same host are backed up
+// at the same time, on top of the cap of the run's concurrencyController, as
+// set by -concurrency_per_host. Hosts without a limit only get the run's cap
+type hostConcurrency struct {
+	mu          sync.Mutex
+	limits      map[string]int
+	controllers map[string]*concurrencyController
+}
+
+// parseHostConcurrency parses -concurrency_per_host: comma-separated
+// 'host=N' pairs, e.g. 'github.com=8,git.example.com=2'
+func parseHostConcurrency(value string) (*hostConcurrency, error) {
+	h := &hostConcurrency{limits: map[string]int{}, controllers: map[string]*concurrencyController{}}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		host, n, ok := strings.Cut(pair, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || len(host) == 0 {
+			return nil, print.Errorf("-concurrency_per_host: expected 'host=N', got %q", pair)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if err != nil || limit < 1 {
+			return nil, print.Errorf("-concurrency_per_host: the limit of %s must be a number of at least 1, got %q", host, n)
+		}
+		h.limits[host] = limit
+	}
+	return h, nil
+}
+
+// controller returns the controller of 'host', or nil if it doesn't have a
+// limit. 'h' may be nil
+func (h *hostConcurrency) controller(host string) *concurrencyController {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limit, ok := h.limits[host]
+	if !ok {
+		return nil
+	}
+	c, ok := h.controllers[host]
+	if !ok {
+		c = newConcurrencyController(limit, false)
+		h.controllers[host] = c
+	}
+	return c
+}
+
+// cloneHost returns the host 'repo' is cloned from, lowercased, from its
+// HTTPS clone URL, or else its SSH URL ('git@host:owner/name.git'). It's
+// empty if neither can be parsed
+func cloneHost(repo *github.Repository) string {
+	if u, err := url.Parse(repo.GetCloneURL()); err == nil && len(u.Hostname()) != 0 {
+		return strings.ToLower(u.Hostname())
+	}
+	sshURL := repo.GetSSHURL()
+	if u, err := url.Parse(sshURL); err == nil && len(u.Hostname()) != 0 {
+		return strings.ToLower(u.Hostname())
+	}
+	if _, rest, ok := strings.Cut(sshURL, "@"); ok {
+		host, _, _ := strings.Cut(rest, ":")
+		return strings.ToLower(host)
+	}
+	return ""
+}
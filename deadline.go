@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	checkpointFileName = "checkpoint.json"
+	// exitCodeDeadline is the exit code of a run stopped by -deadline, so a
+	// scheduler can tell a partial backup from a failed one
+	exitCodeDeadline = 3
+)
+
+// errDeadlineExceeded is returned when -deadline stops a run before every
+// repo is backed up
+var errDeadlineExceeded = errors.New("deadline exceeded, partial backup")
+
+// checkpoint records which repos a run stopped by -deadline did and didn't
+// back up. It's written to 'checkpoint.json' in the backup directory
+type checkpoint struct {
+	CreatedAt time.Time `json:"created_at"`
+	Deadline  time.Time `json:"deadline"`
+	Completed []string  `json:"completed"`
+	// Remaining are the repos that weren't started, or were cancelled midway
+	Remaining []string `json:"remaining"`
+}
+
+// writeCheckpoint writes the checkpoint of a run stopped at 'deadline' to
+// 'backupDirPath'. 'metas' holds the metadata of every repo of 'repos' that
+// was fully backed up, at the same index, and nil for the others
+func writeCheckpoint(backupDirPath string, deadline time.Time,
+	repos []*github.Repository, metas []*export.Repo) error {
+	c := checkpoint{
+		CreatedAt: time.Now(),
+		Deadline:  deadline,
+		Completed: []string{},
+		Remaining: []string{},
+	}
+	for i, repo := range repos {
+		if metas[i] != nil {
+			c.Completed = append(c.Completed, repo.GetName())
+		} else {
+			c.Remaining = append(c.Remaining, repo.GetName())
+		}
+	}
+	return writeStateFile(filepath.Join(backupDirPath, checkpointFileName), c)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// deploymentStatusBackup is a single state transition of a deployment
+type deploymentStatusBackup struct {
+	State          string    `json:"state"`
+	Description    string    `json:"description,omitempty"`
+	Environment    string    `json:"environment,omitempty"`
+	EnvironmentURL string    `json:"environment_url,omitempty"`
+	LogURL         string    `json:"log_url,omitempty"`
+	Creator        string    `json:"creator"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// deploymentBackup is what gets written for each deployment
+type deploymentBackup struct {
+	ID          int64     `json:"id"`
+	Environment string    `json:"environment"`
+	Ref         string    `json:"ref"`
+	SHA         string    `json:"sha"`
+	Task        string    `json:"task"`
+	Description string    `json:"description,omitempty"`
+	Creator     string    `json:"creator"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Statuses are the state transitions of the deployment, oldest first
+	Statuses []deploymentStatusBackup `json:"statuses"`
+}
+
+// backupRepoDeployments uses 'client' and 'ctx' to write every deployment of
+// 'repo', with its status transitions, to '<id>.json' in its deployments
+// directory.
+//
+// XXX Costs one API call per deployment for its statuses. Repos without
+// deployments are skipped
+func backupRepoDeployments(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	opts := &github.DeploymentsListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	deployments, err := paginate(ctx, "deployments", func(page int) ([]*github.Deployment, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return client.Repositories.ListDeployments(ctx, owner, name, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping deployments of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	if len(deployments) == 0 {
+		print.Debugf("No deployments found for repo %s\n", name)
+		return nil
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, name, artifactDeployments)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d deployments of %s to %s\n", len(deployments), name, targetDir)
+	for _, deployment := range deployments {
+		statusOpts := &github.ListOptions{PerPage: 100}
+		statuses, err := paginate(ctx, "deployment statuses", func(page int) ([]*github.DeploymentStatus, *github.Response, error) {
+			statusOpts.Page = page
+			return client.Repositories.ListDeploymentStatuses(ctx, owner, name, deployment.GetID(), statusOpts)
+		})
+		if err != nil {
+			return err
+		}
+		backup := deploymentBackup{
+			ID:          deployment.GetID(),
+			Environment: deployment.GetEnvironment(),
+			Ref:         deployment.GetRef(),
+			SHA:         deployment.GetSHA(),
+			Task:        deployment.GetTask(),
+			Description: deployment.GetDescription(),
+			Creator:     deployment.GetCreator().GetLogin(),
+			CreatedAt:   deployment.GetCreatedAt().Time,
+			Statuses:    []deploymentStatusBackup{},
+		}
+		// The API lists the most recent status first
+		for i := len(statuses) - 1; i >= 0; i-- {
+			status := statuses[i]
+			backup.Statuses = append(backup.Statuses, deploymentStatusBackup{
+				State:          status.GetState(),
+				Description:    status.GetDescription(),
+				Environment:    status.GetEnvironment(),
+				EnvironmentURL: status.GetEnvironmentURL(),
+				LogURL:         status.GetLogURL(),
+				Creator:        status.GetCreator().GetLogin(),
+				CreatedAt:      status.GetCreatedAt().Time,
+			})
+		}
+		err = writeJSONFile(filepath.Join(targetDir, fmt.Sprintf("%d.json", backup.ID)), backup)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	deviceCodeURL   = "https://github.com/login/device/code"
+	deviceTokenURL  = "https://github.com/login/oauth/access_token"
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// deviceSlowDownStep is how much longer to wait between polls each time
+	// GitHub answers 'slow_down', as RFC 8628 says
+	deviceSlowDownStep = 5 * time.Second
+)
+
+// deviceCode is GitHub's answer to a device flow request
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Error           string `json:"error"`
+	ErrorDesc       string `json:"error_description"`
+}
+
+// deviceTokenResponse is GitHub's answer to a poll for the token of a device
+// flow. 'Error' is set until the user authorized it
+type deviceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+// cachedOAuthToken is the token of a device flow, as cached to
+// -oauth_token_cache
+type cachedOAuthToken struct {
+	// ClientID is the OAuth app the token was issued to: a token of another
+	// app isn't reused
+	ClientID    string    `json:"client_id"`
+	AccessToken string    `json:"access_token"`
+	Scope       string    `json:"scope"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// deviceFlowToken returns a token for the OAuth app 'clientID' with
+// 'scopes', reusing the one cached at 'cachePath' if it still works.
+// Otherwise, the user is asked to authorize the app in a browser, and the
+// new token is cached to 'cachePath'. Nothing is cached if 'cachePath' is
+// empty.
+//
+// XXX The cache holds a live token: it's only readable by the user, like an
+// SSH key. GitHub revokes OAuth tokens unused for a year, and users can
+// revoke them from their settings, so a cached token is checked with one API
+// call before it's reused
+func deviceFlowToken(ctx context.Context, clientID, scopes, cachePath, userAgent string) (string, error) {
+	print.DebugFunc()
+
+	if len(cachePath) != 0 {
+		token, err := readCachedOAuthToken(ctx, cachePath, clientID, userAgent)
+		if err != nil {
+			return "", err
+		}
+		if len(token) != 0 {
+			print.Debugf("Reusing the OAuth token cached at %s\n", cachePath)
+			return token, nil
+		}
+	}
+	code, err := requestDeviceCode(ctx, clientID, scopes, userAgent)
+	if err != nil {
+		return "", err
+	}
+	// XXX Not through print: -list and -diff silence logs, but the user has
+	// to see this
+	fmt.Fprintf(os.Stderr, "To authorize this backup, open %s and enter the code %s\n",
+		code.VerificationURI, code.UserCode)
+	resp, err := pollDeviceToken(ctx, clientID, code, userAgent)
+	if err != nil {
+		return "", err
+	}
+	print.Infof("Authorized with scopes %q\n", resp.Scope)
+	if len(cachePath) != 0 {
+		err = writeCachedOAuthToken(cachePath, &cachedOAuthToken{
+			ClientID:    clientID,
+			AccessToken: resp.AccessToken,
+			Scope:       resp.Scope,
+			CreatedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return resp.AccessToken, nil
+}
+
+// readCachedOAuthToken returns the token cached at 'path' for 'clientID', or
+// an empty string if there's none or GitHub doesn't accept it anymore
+func readCachedOAuthToken(ctx context.Context, path, clientID, userAgent string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	cached := &cachedOAuthToken{}
+	err = json.Unmarshal(b, cached)
+	if err != nil {
+		print.Warnf("Ignoring the OAuth token cache at %s: %v\n", path, err)
+		return "", nil
+	}
+	if cached.ClientID != clientID || len(cached.AccessToken) == 0 {
+		return "", nil
+	}
+	client, _, err := getGitClient(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cached.AccessToken}),
+		userAgent, nil)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = client.Users.Get(ctx, "")
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil &&
+			errResp.Response.StatusCode == http.StatusUnauthorized {
+			print.Warnf("The OAuth token cached at %s was revoked: authorizing again\n", path)
+			return "", nil
+		}
+		return "", err
+	}
+	return cached.AccessToken, nil
+}
+
+// writeCachedOAuthToken writes 'cached' to 'path', only readable by the user
+func writeCachedOAuthToken(path string, cached *cachedOAuthToken) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, b, 0o600)
+	if err != nil {
+		return err
+	}
+	// XXX WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0o600)
+}
+
+// postDeviceForm posts 'form' to 'u', one of GitHub's device flow endpoints,
+// and decodes its JSON answer in 'v'
+func postDeviceForm(ctx context.Context, u string, form url.Values, userAgent string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(userAgent) != 0 {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return print.Errorf("POST %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// requestDeviceCode starts a device flow for the OAuth app 'clientID' with
+// 'scopes'
+func requestDeviceCode(ctx context.Context, clientID, scopes, userAgent string) (*deviceCode, error) {
+	code := &deviceCode{}
+	err := postDeviceForm(ctx, deviceCodeURL, url.Values{
+		"client_id": {clientID},
+		"scope":     {scopes},
+	}, userAgent, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(code.Error) != 0 {
+		// XXX 'device_flow_disabled' is the usual one: it has to be enabled
+		// in the OAuth app's settings
+		return nil, print.Errorf("device flow refused: %s: %s", code.Error, code.ErrorDesc)
+	}
+	return code, nil
+}
+
+// pollDeviceToken polls GitHub for the token of the device flow 'code' until
+// the user authorizes it, denies it, or 'code' expires
+func pollDeviceToken(ctx context.Context, clientID string, code *deviceCode,
+	userAgent string) (*deviceTokenResponse, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	expiresAt := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for {
+		if time.Now().After(expiresAt) {
+			return nil, print.Errorf("the device code expired before it was authorized")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		resp := &deviceTokenResponse{}
+		err := postDeviceForm(ctx, deviceTokenURL, url.Values{
+			"client_id":   {clientID},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {deviceGrantType},
+		}, userAgent, resp)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Error {
+		case "":
+			return resp, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += deviceSlowDownStep
+			if resp.Interval != 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			}
+		default:
+			// 'expired_token', 'access_denied', ...
+			return nil, print.Errorf("device flow failed: %s: %s", resp.Error, resp.ErrorDesc)
+		}
+	}
+}
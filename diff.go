@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// repoRename is a repo of the backup that's now under another name
+type repoRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// backupDiff is how the live org changed since a backup, as printed by -diff
+type backupDiff struct {
+	Added     []string     `json:"added"`
+	Removed   []string     `json:"removed"`
+	Renamed   []repoRename `json:"renamed"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// readManifest reads the manifest at the root of 'backupDirPath'
+func readManifest(backupDirPath string) (*export.Manifest, error) {
+	path := filepath.Join(backupDirPath, manifestFileName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, print.Errorf("%s has no %s: is it a backup directory?", backupDirPath, manifestFileName)
+		}
+		return nil, err
+	}
+	m := &export.Manifest{}
+	err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), m)
+	if err != nil {
+		return nil, print.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// diffBackup compares 'live', the repos of 'org' a backup would target now,
+// with the repos of the backup at 'backupDirPath', and returns which were
+// added, removed and renamed since.
+//
+// XXX Renames are told by repo IDs. Backups made before IDs were recorded
+// only have names: for those, 'client', if it isn't nil, is asked for each
+// missing repo, as GitHub redirects the old name of a renamed repo to the
+// new one. It costs one API call per missing repo
+func diffBackup(client *github.Client, ctx context.Context, backupDirPath, org string,
+	live []*github.Repository) (*backupDiff, error) {
+	print.DebugFunc()
+
+	m, err := readManifest(backupDirPath)
+	if err != nil {
+		return nil, err
+	}
+	liveByID := map[int64]*github.Repository{}
+	liveByName := map[string]*github.Repository{}
+	for _, repo := range live {
+		if repo.GetID() != 0 {
+			liveByID[repo.GetID()] = repo
+		}
+		liveByName[strings.ToLower(repo.GetName())] = repo
+	}
+	diff := &backupDiff{Added: []string{}, Removed: []string{}, Renamed: []repoRename{}}
+	matched := map[*github.Repository]bool{}
+	for _, backedUp := range m.Repos {
+		repo, ok := liveByID[backedUp.ID]
+		if backedUp.ID == 0 || !ok {
+			repo, ok = liveByName[strings.ToLower(backedUp.Name)]
+			// XXX A repo of the same name with another ID was deleted and
+			// created again: it's not the one that was backed up
+			if ok && backedUp.ID != 0 && repo.GetID() != 0 && repo.GetID() != backedUp.ID {
+				ok = false
+			}
+		}
+		if !ok && backedUp.ID == 0 && client != nil {
+			repo, err = findRenamedRepo(client, ctx, org, backedUp.Name, liveByID, liveByName)
+			if err != nil {
+				return nil, err
+			}
+			ok = repo != nil
+		}
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, backedUp.FullName)
+		case !strings.EqualFold(repo.GetName(), backedUp.Name):
+			diff.Renamed = append(diff.Renamed, repoRename{From: backedUp.FullName, To: repo.GetFullName()})
+		default:
+			diff.Unchanged++
+		}
+		if ok {
+			matched[repo] = true
+		}
+	}
+	for _, repo := range live {
+		if !matched[repo] {
+			diff.Added = append(diff.Added, repo.GetFullName())
+		}
+	}
+	return diff, nil
+}
+
+// findRenamedRepo uses 'client' and 'ctx' to look 'name' up in 'org', and
+// returns the live repo it now redirects to, or nil if there's none
+func findRenamedRepo(client *github.Client, ctx context.Context, org, name string,
+	liveByID map[int64]*github.Repository, liveByName map[string]*github.Repository) (*github.Repository, error) {
+	repo, resp, err := client.Repositories.Get(ctx, org, name)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("%s/%s is gone: %v\n", org, name, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+	// XXX A repo moved to another org redirects too, but it's not in this
+	// one anymore
+	if !strings.EqualFold(repo.GetOwner().GetLogin(), org) {
+		return nil, nil
+	}
+	if live, ok := liveByID[repo.GetID()]; ok {
+		return live, nil
+	}
+	return liveByName[strings.ToLower(repo.GetName())], nil
+}
+
+// printBackupDiff writes 'diff' to stdout: one repo per line, '+' for added,
+// '-' for removed and '~' for renamed, or as a JSON object with -json.
+// Nothing is written if nothing changed
+func printBackupDiff(diff *backupDiff) error {
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	for _, name := range diff.Added {
+		fmt.Printf("+ %s\n", name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Printf("- %s\n", name)
+	}
+	for _, rename := range diff.Renamed {
+		fmt.Printf("~ %s -> %s\n", rename.From, rename.To)
+	}
+	return nil
+}
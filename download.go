@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// downloadProgressInterval is how often the progress of a download is logged
+const downloadProgressInterval = 5 * time.Second
+
+// partialSuffix is appended to the path of a download until it's complete
+const partialSuffix = ".partial"
+
+// progressReader reports how many bytes were read from 'r' to 'onProgress'
+// and stops reading once 'ctx' is done
+type progressReader struct {
+	ctx        context.Context
+	r          io.Reader
+	total      int64
+	done       int64
+	onProgress func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	err := p.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.onProgress != nil {
+		p.onProgress(p.done, p.total)
+	}
+	return n, err
+}
+
+// logProgress returns a progress callback that logs the progress of
+// downloading 'what' at most every downloadProgressInterval, and once it's
+// complete
+func logProgress(what string) func(done, total int64) {
+	var last time.Time
+	return func(done, total int64) {
+		if done < total && time.Since(last) < downloadProgressInterval {
+			return
+		}
+		last = time.Now()
+		if total > 0 {
+			print.Debugf("Downloading %s: %d/%d bytes (%d%%)\n", what, done, total, done*100/total)
+		} else {
+			print.Debugf("Downloading %s: %d bytes\n", what, done)
+		}
+	}
+}
+
+// contentRangeTotal returns the total size in the Content-Range header
+// 'value', e.g. 'bytes 100-199/200' or 'bytes */200', or -1 if it's unknown
+func contentRangeTotal(value string) int64 {
+	i := strings.LastIndex(value, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(value[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+// fileSize returns the size of 'path', or 0 if it doesn't exist
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// resumeDownload uses 'httpClient' to GET 'url' into 'partialPath'. If
+// 'partialPath' already has some bytes, e.g. from an interrupted run, only the
+// remainder is requested, with a Range request. 'expectedSize' is the size of
+// the complete file, or -1 if it isn't known beforehand. Progress is reported
+// to 'onProgress'.
+//
+// XXX The partial file is kept when the download fails, so the next attempt
+// or run picks up where this one stopped. It's removed if the server answers
+// with a size that doesn't add up
+func resumeDownload(ctx context.Context, httpClient *http.Client, url, partialPath string,
+	expectedSize int64, onProgress func(done, total int64)) error {
+	offset := fileSize(partialPath)
+	if expectedSize >= 0 && offset == expectedSize {
+		// XXX fileSize is 0 for a missing file too: an empty file has nothing
+		// to download, but callers rename 'partialPath', so it must exist
+		fd, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		return fd.Close()
+	}
+	if expectedSize >= 0 && offset > expectedSize {
+		offset = 0
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	total := expectedSize
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(partialPath)
+			return print.Errorf("GET %s: unexpected Content-Range %s", url, resp.Header.Get("Content-Range"))
+		}
+		if total < 0 {
+			total = contentRangeTotal(resp.Header.Get("Content-Range"))
+		}
+		print.Debugf("Resuming download of %s at byte %d\n", url, offset)
+	case http.StatusOK:
+		// The server doesn't do ranges, or there was nothing to resume
+		offset = 0
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if total < 0 && resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if contentRangeTotal(resp.Header.Get("Content-Range")) == offset {
+			return nil
+		}
+		os.Remove(partialPath)
+		return print.Errorf("GET %s: %s", url, resp.Status)
+	default:
+		return print.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	fd, err := os.OpenFile(partialPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, &progressReader{ctx: ctx, r: resp.Body, total: total, done: offset, onProgress: onProgress})
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+	if size := fileSize(partialPath); total >= 0 && size != total {
+		os.Remove(partialPath)
+		return print.Errorf("downloaded %d bytes of %s, expected %d", size, url, total)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex-encoded sha256 of the content of 'path'
+func fileSHA256(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, fd)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
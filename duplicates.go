@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const issueDuplicatesQuery = `
+fragment duplicateRef on IssueOrPullRequest {
+  ... on Issue { number repository { nameWithOwner } }
+  ... on PullRequest { number repository { nameWithOwner } }
+}
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue {
+        timelineItems(first: 100, after: $cursor, itemTypes: [MARKED_AS_DUPLICATE_EVENT, UNMARKED_AS_DUPLICATE_EVENT]) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            __typename
+            ... on MarkedAsDuplicateEvent { canonical { ...duplicateRef } duplicate { ...duplicateRef } }
+            ... on UnmarkedAsDuplicateEvent { canonical { ...duplicateRef } duplicate { ...duplicateRef } }
+          }
+        }
+      }
+      ... on PullRequest {
+        timelineItems(first: 100, after: $cursor, itemTypes: [MARKED_AS_DUPLICATE_EVENT, UNMARKED_AS_DUPLICATE_EVENT]) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            __typename
+            ... on MarkedAsDuplicateEvent { canonical { ...duplicateRef } duplicate { ...duplicateRef } }
+            ... on UnmarkedAsDuplicateEvent { canonical { ...duplicateRef } duplicate { ...duplicateRef } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// graphQLIssueRef is an issue or PR as the GraphQL API references it
+type graphQLIssueRef struct {
+	Number     int `json:"number"`
+	Repository struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"repository"`
+}
+
+// issueRef returns 'r' as an export.IssueRef, relative to 'repoFullName'
+func (r *graphQLIssueRef) issueRef(repoFullName string) export.IssueRef {
+	ref := export.IssueRef{Number: r.Number}
+	if !strings.EqualFold(r.Repository.NameWithOwner, repoFullName) {
+		ref.Repo = r.Repository.NameWithOwner
+	}
+	return ref
+}
+
+// fetchIssueDuplicates uses 'client' and 'ctx' to fill which issue or PR
+// 'issue' of 'repo' was marked as a duplicate of, and which were marked as
+// its duplicates, in 'out'.
+//
+// XXX Only the timeline has this, so it's one GraphQL query per issue. The
+// events are replayed in order, so a duplicate mark that was undone later
+// isn't recorded
+func fetchIssueDuplicates(client *github.Client, ctx context.Context, repo *github.Repository,
+	issue *github.Issue, out *export.Issue) error {
+	type pair struct {
+		canonical, duplicate export.IssueRef
+	}
+	self := export.IssueRef{Number: *issue.Number}
+	marked := map[pair]bool{}
+	order := []pair{}
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				IssueOrPullRequest struct {
+					TimelineItems struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							TypeName  string           `json:"__typename"`
+							Canonical *graphQLIssueRef `json:"canonical"`
+							Duplicate *graphQLIssueRef `json:"duplicate"`
+						} `json:"nodes"`
+					} `json:"timelineItems"`
+				} `json:"issueOrPullRequest"`
+			} `json:"repository"`
+		}
+		err := queryGraphQL(client, ctx, issueDuplicatesQuery, map[string]interface{}{
+			"owner":  *repo.Owner.Login,
+			"name":   *repo.Name,
+			"number": *issue.Number,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Debugf("Skipping duplicates of issue #%d: %v\n", *issue.Number, err)
+				return nil
+			}
+			return err
+		}
+		page := data.Repository.IssueOrPullRequest.TimelineItems
+		for _, node := range page.Nodes {
+			// XXX Either side is null if it was deleted, or the token can't
+			// see its repo
+			if node.Canonical == nil || node.Duplicate == nil {
+				continue
+			}
+			p := pair{
+				canonical: node.Canonical.issueRef(repo.GetFullName()),
+				duplicate: node.Duplicate.issueRef(repo.GetFullName()),
+			}
+			switch node.TypeName {
+			case "MarkedAsDuplicateEvent":
+				if !marked[p] {
+					order = append(order, p)
+				}
+				marked[p] = true
+			case "UnmarkedAsDuplicateEvent":
+				marked[p] = false
+			}
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &page.PageInfo.EndCursor
+	}
+	for _, p := range order {
+		if !marked[p] {
+			continue
+		}
+		switch {
+		case p.duplicate == self:
+			canonical := p.canonical
+			out.DuplicateOf = &canonical
+		case p.canonical == self:
+			out.Duplicates = append(out.Duplicates, p.duplicate)
+		}
+	}
+	return nil
+}
+
+// writeIssueDuplicatesMarkdown writes what 'issue' is a duplicate of, and
+// its duplicates, to 'fd'
+func writeIssueDuplicatesMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if issue.DuplicateOf != nil {
+		fd.WriteString(fmt.Sprintf("* Duplicate of: %s\r\n", formatIssueRef(*issue.DuplicateOf)))
+	}
+	if len(issue.Duplicates) != 0 {
+		var refs []string
+		for _, ref := range issue.Duplicates {
+			refs = append(refs, formatIssueRef(ref))
+		}
+		fd.WriteString(fmt.Sprintf("* Duplicates: %s\r\n", strings.Join(refs, ", ")))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const issueEditsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue {
+        lastEditedAt
+        editor { login }
+        comments(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { databaseId lastEditedAt editor { login } }
+        }
+      }
+      ... on PullRequest {
+        lastEditedAt
+        editor { login }
+        comments(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { databaseId lastEditedAt editor { login } }
+        }
+      }
+    }
+  }
+}`
+
+// graphQLEdit is when, and by whom, an issue, PR or comment was last edited
+type graphQLEdit struct {
+	LastEditedAt *time.Time `json:"lastEditedAt"`
+	Editor       *struct {
+		Login string `json:"login"`
+	} `json:"editor"`
+}
+
+func (e graphQLEdit) editor() string {
+	if e.Editor == nil {
+		return ""
+	}
+	return e.Editor.Login
+}
+
+// fetchIssueEdits uses 'client' and 'ctx' to fill when, and by whom, the
+// issue or PR 'issue' of 'repo' and its 'comments' were last edited into
+// 'out'. 'out.Comments' must be in the same order as 'comments'.
+//
+// XXX The REST API doesn't have this, so it's one GraphQL query per issue,
+// plus one per 100 comments
+func fetchIssueEdits(client *github.Client, ctx context.Context, repo *github.Repository,
+	issue *github.Issue, comments []*github.IssueComment, out *export.Issue) error {
+	commentEdits := map[int64]graphQLEdit{}
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				IssueOrPullRequest struct {
+					graphQLEdit
+					Comments struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							graphQLEdit
+							DatabaseID int64 `json:"databaseId"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"issueOrPullRequest"`
+			} `json:"repository"`
+		}
+		err := queryGraphQL(client, ctx, issueEditsQuery, map[string]interface{}{
+			"owner":  *repo.Owner.Login,
+			"name":   *repo.Name,
+			"number": *issue.Number,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Debugf("Skipping edits of issue #%d: %v\n", *issue.Number, err)
+				return nil
+			}
+			return err
+		}
+		issueEdit := data.Repository.IssueOrPullRequest.graphQLEdit
+		out.LastEditedAt = issueEdit.LastEditedAt
+		out.Editor = issueEdit.editor()
+		for _, node := range data.Repository.IssueOrPullRequest.Comments.Nodes {
+			commentEdits[node.DatabaseID] = node.graphQLEdit
+		}
+		pageInfo := data.Repository.IssueOrPullRequest.Comments.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		cursor = &pageInfo.EndCursor
+	}
+	for i, comment := range comments {
+		edit, ok := commentEdits[comment.GetID()]
+		if !ok || i >= len(out.Comments) {
+			continue
+		}
+		out.Comments[i].LastEditedAt = edit.LastEditedAt
+		out.Comments[i].Editor = edit.editor()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+// smtpsPort is the port of SMTP over implicit TLS. Every other port gets
+// STARTTLS, if the server offers it
+const smtpsPort = "465"
+
+// parseEmailAddresses returns the comma-separated addresses of 'value'
+func parseEmailAddresses(value string) []string {
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if len(address) != 0 {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// emailReportBody returns the text of the report of a run that lasted
+// 'duration', collected in 'summary', and that failed with 'runErr' if it
+// isn't nil
+func emailReportBody(summary *runSummary, runErr error, duration time.Duration) string {
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	var b strings.Builder
+	if runErr != nil {
+		fmt.Fprintf(&b, "The backup FAILED: %v\n\n", runErr)
+	} else {
+		b.WriteString("The backup succeeded.\n\n")
+	}
+	for _, org := range summary.orgs {
+		fmt.Fprintf(&b, "Org: %s, backed up to %s\n", org.org, org.backupDirPath)
+	}
+	fmt.Fprintf(&b, "Started: %s\n", runStartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Duration: %v\n", duration.Round(time.Second))
+	fmt.Fprintf(&b, "Repos backed up: %d\n", summary.reposBackedUp)
+	fmt.Fprintf(&b, "Issues and PRs written: %d, with %d comments\n",
+		summary.totals.IssueCount, summary.totals.CommentCount)
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"orgs were skipped", summary.skippedOrgs},
+		{"repos failed to back up", summary.repoFailures},
+	}
+	var verifyFailures []string
+	for _, repoName := range summary.verifyFailuresOrder {
+		verifyFailures = append(verifyFailures, fmt.Sprintf("%s: %s", repoName, summary.verifyFailures[repoName]))
+	}
+	sections = append(sections, struct {
+		title string
+		lines []string
+	}{"repos failed verification", verifyFailures})
+	for _, section := range sections {
+		if len(section.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%d %s:\n", len(section.lines), section.title)
+		for _, line := range section.lines {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// buildEmailReport returns the MIME message of the report of a run, with the
+// manifest of every backed up org attached
+func buildEmailReport(summary *runSummary, runErr error, duration time.Duration,
+	from string, to []string) ([]byte, error) {
+	status := "succeeded"
+	if runErr != nil {
+		status = "FAILED"
+	}
+	boundaryBytes := make([]byte, 12)
+	_, err := rand.Read(boundaryBytes)
+	if err != nil {
+		return nil, err
+	}
+	boundary := "clone_your_org-" + hex.EncodeToString(boundaryBytes)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: clone_your_org: backup of %s %s\r\n", strings.Join(parseOrgNames(*OrganizationNameFlag), ", "), status)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(emailReportBody(summary, runErr, duration), "\n", "\r\n"))
+
+	for _, org := range summary.orgs {
+		manifestPath := filepath.Join(org.backupDirPath, manifestFileName)
+		// XXX A run that failed midway may not have gotten to the manifest
+		if !util.IsFile(manifestPath) {
+			continue
+		}
+		content, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+		b.WriteString("Content-Type: application/json\r\n")
+		b.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&b, "Content-Disposition: attachment; filename=\"manifest_%s.json\"\r\n\r\n", org.org)
+		encoded := base64.StdEncoding.EncodeToString(content)
+		// Base64 lines can't be longer than 76 characters
+		for len(encoded) > 76 {
+			b.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		b.WriteString(encoded + "\r\n")
+	}
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// sendMail sends 'msg' from 'from' to 'to' through the SMTP server at
+// 'addr', a 'host:port'. If 'username' isn't empty, it authenticates with it
+// and 'password'.
+//
+// XXX smtp.SendMail upgrades to STARTTLS when the server offers it, and
+// refuses to send credentials over a plain connection, except to localhost.
+// Port 465 expects TLS from the start, which smtp.SendMail doesn't do, so it's
+// dialed here
+func sendMail(addr, username, password, from string, to []string, msg []byte) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if len(username) != 0 {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	if port != smtpsPort {
+		return smtp.SendMail(addr, auth, from, to, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		err = c.Rcpt(rcpt)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// sendEmailReport emails the report of the run collected in 'summary', which
+// failed with 'runErr' if it isn't nil, to -smtp_to. It's only sent on
+// success with -email_on_success. Nothing is sent without -smtp_host
+func sendEmailReport(summary *runSummary, runErr error) error {
+	if len(*smtpHostFlag) == 0 {
+		return nil
+	}
+	if runErr == nil && !*emailOnSuccessFlag {
+		return nil
+	}
+	print.DebugFunc()
+
+	to := parseEmailAddresses(*smtpToFlag)
+	msg, err := buildEmailReport(summary, runErr, time.Since(runStartedAt), *smtpFromFlag, to)
+	if err != nil {
+		return err
+	}
+	err = sendMail(*smtpHostFlag, *smtpUsernameFlag, *smtpPasswordFlag, *smtpFromFlag, to, msg)
+	if err != nil {
+		return print.Errorf("failed to email the report to %s: %v", *smtpToFlag, err)
+	}
+	print.Infof("Emailed the report to %s\n", strings.Join(to, ", "))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// utf8BOM is the byte order mark some Windows tools need to detect UTF-8
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textEncoder encodes the text files we generate (issues, JSON documents,
+// CSVs). Everything is generated as UTF-8 and goes through it on the way to
+// disk
+type textEncoder interface {
+	// preamble returns what's written once at the start of a new file, e.g. a
+	// BOM
+	preamble() []byte
+	// wrap returns a writer that encodes the UTF-8 text written to it into 'w'
+	wrap(w io.Writer) io.Writer
+}
+
+// utf8Encoder writes UTF-8 as is, optionally starting every file with a BOM
+type utf8Encoder struct {
+	bom bool
+}
+
+func (e utf8Encoder) preamble() []byte {
+	if e.bom {
+		return utf8BOM
+	}
+	return nil
+}
+
+func (e utf8Encoder) wrap(w io.Writer) io.Writer {
+	return w
+}
+
+// outputEncoder is the encoder every text file is written with. It's set from
+// the flags in _main
+var outputEncoder textEncoder = utf8Encoder{}
+
+// textFile is a file written through 'outputEncoder'
+type textFile struct {
+	fd *os.File
+	w  io.Writer
+}
+
+// createTextFile creates (or truncates) 'path' to write text to it
+func createTextFile(path string) (*textFile, error) {
+	return openTextFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+// appendTextFile opens 'path' to append text to it, creating it if needed.
+// The preamble is only written if the file is new
+func appendTextFile(path string) (*textFile, error) {
+	return openTextFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+}
+
+func openTextFile(path string, flag int) (*textFile, error) {
+	err := checkWritePath(path)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		_, err = fd.Write(outputEncoder.preamble())
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	return &textFile{fd: fd, w: outputEncoder.wrap(fd)}, nil
+}
+
+func (f *textFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f *textFile) WriteString(s string) (int, error) {
+	return f.w.Write([]byte(s))
+}
+
+func (f *textFile) Close() error {
+	return f.fd.Close()
+}
+
+// writeTextFile writes 'b' to 'path' through 'outputEncoder'
+func writeTextFile(path string, b []byte) error {
+	f, err := createTextFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
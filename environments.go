@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// environmentReviewer is a user or team required to approve deployments
+type environmentReviewer struct {
+	Type  string `json:"type"`
+	Login string `json:"login"`
+}
+
+// environmentBackup is what gets written for each deployment environment
+type environmentBackup struct {
+	Name                  string                `json:"name"`
+	WaitTimer             int                   `json:"wait_timer"`
+	PreventSelfReview     bool                  `json:"prevent_self_review"`
+	RequiredReviewers     []environmentReviewer `json:"required_reviewers"`
+	CanAdminsBypass       bool                  `json:"can_admins_bypass"`
+	ProtectedBranchesOnly bool                  `json:"protected_branches_only"`
+	// CustomBranchPolicies are the branch/tag name patterns allowed to deploy,
+	// if the environment uses custom policies
+	CustomBranchPolicies []string `json:"custom_branch_policies"`
+	// SecretNames are only the names: secret values can't be retrieved
+	SecretNames []string `json:"secret_names"`
+}
+
+func newEnvironmentReviewer(reviewer *github.RequiredReviewer) environmentReviewer {
+	out := environmentReviewer{Type: reviewer.GetType()}
+	switch r := reviewer.Reviewer.(type) {
+	case *github.User:
+		out.Login = r.GetLogin()
+	case *github.Team:
+		out.Login = r.GetSlug()
+	}
+	return out
+}
+
+// backupRepoEnvironments uses 'client' and 'ctx' to write the deployment
+// environments of 'repo', with their protection rules, deployment branch
+// policy and secret names, to 'environments.json' in its meta directory.
+//
+// XXX Repos without environments, or which the token can't see the
+// environments of, are skipped
+func backupRepoEnvironments(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	var environments []*github.Environment
+	opts := &github.EnvironmentListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		resp, httpResp, err := client.Repositories.ListEnvironments(ctx, owner, name, opts)
+		if err != nil {
+			if isAccessDenied(err) {
+				print.Debugf("Skipping environments of %s: %v\n", name, err)
+				return nil
+			}
+			return err
+		}
+		environments = append(environments, resp.Environments...)
+		if httpResp.NextPage == 0 {
+			break
+		}
+		opts.Page = httpResp.NextPage
+	}
+	if len(environments) == 0 {
+		print.Debugf("No environments found for repo %s\n", name)
+		return nil
+	}
+
+	var out []environmentBackup
+	for _, env := range environments {
+		backup := environmentBackup{
+			Name:                 env.GetName(),
+			CanAdminsBypass:      env.GetCanAdminsBypass(),
+			RequiredReviewers:    []environmentReviewer{},
+			CustomBranchPolicies: []string{},
+			SecretNames:          []string{},
+		}
+		for _, rule := range env.ProtectionRules {
+			switch rule.GetType() {
+			case "wait_timer":
+				backup.WaitTimer = rule.GetWaitTimer()
+			case "required_reviewers":
+				backup.PreventSelfReview = rule.GetPreventSelfReview()
+				for _, reviewer := range rule.Reviewers {
+					backup.RequiredReviewers = append(backup.RequiredReviewers,
+						newEnvironmentReviewer(reviewer))
+				}
+			}
+		}
+		if policy := env.DeploymentBranchPolicy; policy != nil {
+			backup.ProtectedBranchesOnly = policy.GetProtectedBranches()
+			if policy.GetCustomBranchPolicies() {
+				policies, _, err := client.Repositories.ListDeploymentBranchPolicies(ctx,
+					owner, name, env.GetName())
+				if err != nil {
+					return err
+				}
+				for _, p := range policies.BranchPolicies {
+					backup.CustomBranchPolicies = append(backup.CustomBranchPolicies, p.GetName())
+				}
+			}
+		}
+
+		secretOpts := &github.ListOptions{PerPage: 100}
+		for {
+			secrets, resp, err := client.Actions.ListEnvSecrets(ctx, int(repo.GetID()),
+				env.GetName(), secretOpts)
+			if err != nil {
+				if isAccessDenied(err) {
+					print.Debugf("Can't list secrets of environment %s in %s: %v\n",
+						env.GetName(), name, err)
+					break
+				}
+				return err
+			}
+			for _, secret := range secrets.Secrets {
+				backup.SecretNames = append(backup.SecretNames, secret.Name)
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			secretOpts.Page = resp.NextPage
+		}
+		out = append(out, backup)
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	print.Debugf("Backing up %d environments for repo %s to %s\n", len(out), name, targetDir)
+	return writeJSONFile(filepath.Join(targetDir, "environments.json"), out)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+	"github.com/google/go-github/v76/github"
+)
+
+const etagsFileName = "etags.json"
+
+// etagValidators are what a conditional request is made with
+type etagValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// etagCache stores the validators of list endpoints across runs, in
+// 'etags.json' in the backup directory
+type etagCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]etagValidators
+}
+
+// loadETagCache reads the cache of 'backupDirPath', if there's one
+func loadETagCache(backupDirPath string) (*etagCache, error) {
+	c := &etagCache{
+		path:    filepath.Join(backupDirPath, etagsFileName),
+		entries: map[string]etagValidators{},
+	}
+	if !util.IsFile(c.path) {
+		return c, nil
+	}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	// XXX Caches of older runs went through -bom
+	err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), &c.entries)
+	if err != nil {
+		return nil, print.Errorf("can't parse %s: %v", c.path, err)
+	}
+	return c, nil
+}
+
+func (c *etagCache) get(key string) etagValidators {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *etagCache) set(key string, v etagValidators) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = v
+}
+
+// save writes the cache back to disk
+func (c *etagCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(c.path, c.entries)
+}
+
+func issuesETagKey(repo *github.Repository) string {
+	return "issues:" + repo.GetFullName()
+}
+
+// checkIssuesChanged uses 'client' and 'ctx' to ask GitHub, with a
+// conditional request, if any issue or PR of 'repo' changed since the
+// validators cached in 'cache' were stored. It returns the validators to
+// store once the issues are backed up, which are empty if nothing changed.
+//
+// XXX The request lists the single most recently updated issue: a new issue,
+// an edit or a new comment all bump an issue to the top of that list, which
+// changes its ETag. A 304 doesn't count against the rate limit
+func checkIssuesChanged(client *github.Client, ctx context.Context,
+	repo *github.Repository, cache *etagCache) (bool, etagValidators, error) {
+	u := fmt.Sprintf("repos/%v/%v/issues?state=all&sort=updated&direction=desc&per_page=1",
+		*repo.Owner.Login, *repo.Name)
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return false, etagValidators{}, err
+	}
+	cached := cache.get(issuesETagKey(repo))
+	if len(cached.ETag) != 0 {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if len(cached.LastModified) != 0 {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := client.Do(ctx, req, nil)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil &&
+			errResp.Response.StatusCode == http.StatusNotModified {
+			return false, etagValidators{}, nil
+		}
+		return false, etagValidators{}, err
+	}
+	return true, etagValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
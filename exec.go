@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// runCommand runs 'name' with 'args' in 'dir' (the current directory if
+// empty) and returns its trimmed stdout. 'env' is added to the current
+// environment. The process is killed if 'ctx' is done.
+//
+// XXX Unlike util.Exec, 'args' are passed as-is: they can contain spaces and
+// are never interpreted by a shell
+func runCommand(ctx context.Context, dir string, env []string,
+	name string, args ...string) (string, error) {
+	var outbuf, errbuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &outbuf
+	cmd.Stderr = &errbuf
+	print.Debugf("Executing command: %s\n", cmd.String())
+
+	err := cmd.Run()
+	if err != nil {
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("Command failed: %+v",
+			map[string]string{
+				"command":  cmd.String(),
+				"stdout":   outbuf.String(),
+				"stderr":   strings.TrimSpace(errbuf.String()),
+				"exitCode": strconv.Itoa(exitCode),
+				"error":    err.Error(),
+			},
+		)
+	}
+	return strings.TrimSpace(outbuf.String()), nil
+}
+
+// shellQuote quotes 's' so a POSIX shell reads it as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// gitHTTPSAuthEnv returns the environment git subprocesses need to
+// authenticate over HTTPS with the GitHub or GitLab token 'token'.
+//
+// XXX The token is passed as an extra header through GIT_CONFIG_* variables
+// rather than in the URL or with '-c': it doesn't end up in the mirror's
+// config, nor in the process list
+func gitHTTPSAuthEnv(token string) []string {
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + auth,
+	}
+}
+
+// gitSSHEnv returns the environment git subprocesses need to authenticate
+// over SSH with the private key at 'keyPath' only, ignoring the SSH agent and
+// the host's SSH config identities. It returns nil if 'keyPath' is empty
+func gitSSHEnv(keyPath string) []string {
+	if len(keyPath) == 0 {
+		return nil
+	}
+	// XXX git runs GIT_SSH_COMMAND through a shell, hence the quoting
+	return []string{fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes",
+		shellQuote(keyPath))}
+}
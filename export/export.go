@@ -0,0 +1,381 @@
+// Package export defines the structures clone_your_org serializes to disk.
+//
+// These structs are the contract downstream importers rely on. Any change to
+// them that isn't purely additive must bump SchemaVersion.
+package export
+
+import (
+	"sort"
+	"time"
+)
+
+// SchemaVersion is the version of the structs in this package. It's recorded
+// in every manifest
+const SchemaVersion = 1
+
+// RepoStats is a snapshot of a repo's popularity counters at backup time
+type RepoStats struct {
+	Stargazers int `json:"stargazers"`
+	Watchers   int `json:"watchers"`
+	Forks      int `json:"forks"`
+	OpenIssues int `json:"open_issues"`
+}
+
+// Repo is what gets written to 'repo.json' in a repo's meta directory
+type Repo struct {
+	// ID is the forge's ID of the repo, which, unlike its name, survives
+	// renames. It's 0 in backups made before it was recorded
+	ID          int64  `json:"id,omitempty"`
+	Name        string `json:"name"`
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	// Topics is empty in backups made before they were recorded
+	Topics     []string  `json:"topics,omitempty"`
+	BackedUpAt time.Time `json:"backed_up_at"`
+	Stats      RepoStats `json:"stats"`
+	// Languages maps a language name to the number of bytes written in it
+	Languages map[string]int `json:"languages"`
+	// Settings is nil in backups made before they were recorded
+	Settings *RepoSettings `json:"settings,omitempty"`
+}
+
+// RepoSettings are the merge button settings and enabled features of a repo,
+// to apply them again to a restored one. Each is nil if the forge didn't tell
+type RepoSettings struct {
+	AllowMergeCommit    *bool `json:"allow_merge_commit"`
+	AllowSquashMerge    *bool `json:"allow_squash_merge"`
+	AllowRebaseMerge    *bool `json:"allow_rebase_merge"`
+	AllowAutoMerge      *bool `json:"allow_auto_merge"`
+	DeleteBranchOnMerge *bool `json:"delete_branch_on_merge"`
+	HasIssues           *bool `json:"has_issues"`
+	HasProjects         *bool `json:"has_projects"`
+	HasWiki             *bool `json:"has_wiki"`
+	HasDiscussions      *bool `json:"has_discussions"`
+}
+
+// Comment is a single comment on an issue or PR
+type Comment struct {
+	Author string `json:"author"`
+	// AuthorAssociation is the author's relationship to the repo: OWNER,
+	// MEMBER, CONTRIBUTOR, NONE, etc.
+	AuthorAssociation string    `json:"author_association,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	// UpdatedAt is only set if it differs from CreatedAt, which usually means
+	// the comment was edited
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// LastEditedAt and Editor are only filled with -edits
+	LastEditedAt *time.Time `json:"last_edited_at,omitempty"`
+	Editor       string     `json:"editor,omitempty"`
+	Body         string     `json:"body"`
+	// IsMinimized and MinimizedReason are only filled with -minimized, e.g.
+	// for a comment hidden as spam or off-topic
+	IsMinimized     bool   `json:"is_minimized,omitempty"`
+	MinimizedReason string `json:"minimized_reason,omitempty"`
+	// Reactions and ReactionUsers are only filled with -reactions and
+	// -reactions_detailed
+	Reactions     map[string]int `json:"reactions,omitempty"`
+	ReactionUsers []Reaction     `json:"reaction_users,omitempty"`
+}
+
+// IssueRef references an issue or PR
+type IssueRef struct {
+	// Repo is the 'owner/name' of the issue's repo, if it isn't in the same
+	// repo as the issue referencing it
+	Repo   string `json:"repo,omitempty"`
+	Number int    `json:"number"`
+}
+
+// TaskListItem is a task list checkbox, e.g. '- [x] #12', referencing an issue
+// or PR
+type TaskListItem struct {
+	Issue   IssueRef `json:"issue"`
+	Checked bool     `json:"checked"`
+	// Title is only filled if the referenced issue is in the same repo
+	Title string `json:"title,omitempty"`
+}
+
+// Reaction is a single user's reaction to an issue or a comment
+type Reaction struct {
+	User string `json:"user"`
+	// Content is the reaction type: +1, -1, laugh, confused, heart, hooray,
+	// rocket or eyes
+	Content string `json:"content"`
+}
+
+// Label is a label of a repo, as it's applied to its issues and PRs
+type Label struct {
+	Name string `json:"name"`
+	// Color is the label's hex color, without the leading '#'
+	Color       string `json:"color"`
+	Description string `json:"description,omitempty"`
+}
+
+// Issue is a single issue or PR, with all of its comments
+type Issue struct {
+	Number        int       `json:"number"`
+	Title         string    `json:"title"`
+	IsPullRequest bool      `json:"is_pull_request"`
+	CreatedAt     time.Time `json:"created_at"`
+	// UpdatedAt is the last activity on the issue: an edit, a comment, a
+	// label change, etc. It's nil in issues written before it was recorded
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Author    string     `json:"author"`
+	// AuthorAssociation is the author's relationship to the repo: OWNER,
+	// MEMBER, CONTRIBUTOR, NONE, etc.
+	AuthorAssociation string `json:"author_association,omitempty"`
+	// Labels are the names of the issue's labels, and LabelDetails the same
+	// labels with their color and description
+	Labels       []string `json:"labels"`
+	LabelDetails []Label  `json:"label_details,omitempty"`
+	// State is 'open' or 'closed' at backup time, and StateReason why:
+	// 'completed', 'not_planned', 'duplicate' or 'reopened'. They're empty
+	// in issues written before they were recorded
+	State       string `json:"state,omitempty"`
+	StateReason string `json:"state_reason,omitempty"`
+	// ClosedAt and ClosedBy are only set while the issue is closed: an issue
+	// that was closed then reopened has neither
+	ClosedAt *time.Time `json:"closed_at"`
+	ClosedBy string     `json:"closed_by,omitempty"`
+	Body     *string    `json:"body"`
+	// LastEditedAt and Editor are only filled with -edits, if the body was
+	// edited
+	LastEditedAt *time.Time `json:"last_edited_at,omitempty"`
+	Editor       string     `json:"editor,omitempty"`
+	// Participants are the unique logins of the author, the commenters and
+	// the assignees, in order of appearance
+	Participants []string `json:"participants,omitempty"`
+	// Assignees, RequestedReviewers and RequestedTeams are only filled for
+	// PRs, the last two with -requested_reviewers. RequestedReviewersFetched
+	// tells "none pending" from "not fetched"
+	Assignees                 []string `json:"assignees,omitempty"`
+	RequestedReviewers        []string `json:"requested_reviewers,omitempty"`
+	RequestedTeams            []string `json:"requested_teams,omitempty"`
+	RequestedReviewersFetched bool     `json:"requested_reviewers_fetched,omitempty"`
+	// ReviewThreads is only filled for PRs, with -review_threads
+	ReviewThreads []ReviewThread `json:"review_threads,omitempty"`
+	// Subscribers is only filled with -subscribers
+	Subscribers *IssueSubscribers `json:"subscribers,omitempty"`
+	// PullRequest is only filled for PRs, with -pr_details
+	PullRequest *PullRequestDetails `json:"pull_request,omitempty"`
+	// Commits and Files are only filled for PRs, with -pr_commits
+	Commits []PullRequestCommit `json:"commits,omitempty"`
+	Files   []PullRequestFile   `json:"files,omitempty"`
+	// Reactions maps a reaction type to how many users reacted with it
+	Reactions     map[string]int `json:"reactions,omitempty"`
+	ReactionUsers []Reaction     `json:"reaction_users,omitempty"`
+	// DuplicateOf is what the issue was marked as a duplicate of, and
+	// Duplicates the issues marked as duplicates of it. They're only filled
+	// with -duplicates
+	DuplicateOf *IssueRef  `json:"duplicate_of,omitempty"`
+	Duplicates  []IssueRef `json:"duplicates,omitempty"`
+	// ParentIssue, SubIssues and TaskList are only filled with -sub_issues
+	ParentIssue *IssueRef      `json:"parent_issue,omitempty"`
+	SubIssues   []IssueRef     `json:"sub_issues,omitempty"`
+	TaskList    []TaskListItem `json:"task_list,omitempty"`
+	// TimelineEvents is only filled with -flatten_comments
+	TimelineEvents []TimelineEvent `json:"timeline_events,omitempty"`
+	Comments       []Comment       `json:"comments"`
+}
+
+// TimelineEvent is an event of an issue's timeline, e.g. 'labeled' or
+// 'closed'. Comments aren't events: they're in Issue.Comments
+type TimelineEvent struct {
+	Event     string    `json:"event"`
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Detail is what the event is about, e.g. the label of a 'labeled' event
+	// or the message of a 'committed' one
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReviewThread is a thread of review comments on a PR's diff
+type ReviewThread struct {
+	Path string `json:"path"`
+	// Line is the line the thread is on (the last one for multi-line
+	// threads), and StartLine the first one. Line is nil for comments on the
+	// whole file
+	Line      *int   `json:"line"`
+	StartLine *int   `json:"start_line,omitempty"`
+	Side      string `json:"side,omitempty"`
+	// IsResolved is false for threads with outstanding feedback
+	IsResolved bool      `json:"is_resolved"`
+	IsOutdated bool      `json:"is_outdated"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+	Comments   []Comment `json:"comments"`
+}
+
+// GetLine returns the line of the thread, or 0 for comments on the whole
+// file
+func (t *ReviewThread) GetLine() int {
+	if t.Line == nil {
+		return 0
+	}
+	return *t.Line
+}
+
+// IssueSubscribers are the users subscribed to an issue, as far as the API
+// tells. 'Note' says what's missing
+type IssueSubscribers struct {
+	Users []string `json:"users"`
+	Note  string   `json:"note"`
+}
+
+// PullRequestDetails is the state of a PR at backup time
+type PullRequestDetails struct {
+	// State is 'open' or 'closed'
+	State string `json:"state"`
+	Draft bool   `json:"draft"`
+	// Mergeable is nil if GitHub hadn't computed it yet
+	Mergeable *bool `json:"mergeable"`
+	// MergeableState is 'clean', 'dirty', 'blocked', 'behind', 'unstable',
+	// 'unknown', etc.
+	MergeableState string `json:"mergeable_state,omitempty"`
+	// AutoMerge is nil if auto-merge isn't enabled on the PR
+	AutoMerge *AutoMerge `json:"auto_merge,omitempty"`
+	// MergedAt and MergedBy are only filled for merged PRs
+	MergedAt *time.Time `json:"merged_at,omitempty"`
+	MergedBy string     `json:"merged_by,omitempty"`
+	// MergeMethod is how a merged PR was merged: 'merge', 'squash' or
+	// 'rebase'. It's told from the merge commit, and empty if it couldn't be
+	MergeMethod string `json:"merge_method,omitempty"`
+}
+
+// AutoMerge is the auto-merge a PR is set to once its checks pass
+type AutoMerge struct {
+	EnabledBy string `json:"enabled_by"`
+	// MergeMethod is 'merge', 'squash' or 'rebase'
+	MergeMethod   string `json:"merge_method"`
+	CommitTitle   string `json:"commit_title,omitempty"`
+	CommitMessage string `json:"commit_message,omitempty"`
+}
+
+// PullRequestCommit is a commit of a PR
+type PullRequestCommit struct {
+	SHA string `json:"sha"`
+	// Author is the commit's author login, or its git author name if it
+	// isn't linked to a user
+	Author  string `json:"author"`
+	Message string `json:"message"`
+}
+
+// PullRequestFile is a file a PR changes
+type PullRequestFile struct {
+	Path string `json:"path"`
+	// Status is 'added', 'removed', 'modified', 'renamed', 'copied',
+	// 'changed' or 'unchanged'
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	// PreviousPath is only set for renamed files
+	PreviousPath string `json:"previous_path,omitempty"`
+}
+
+// Kinds of Entry
+const (
+	EntryTypeIssue       = "issue"
+	EntryTypePullRequest = "pull_request"
+	EntryTypeComment     = "comment"
+	EntryTypeEvent       = "event"
+)
+
+// Entry is a single item of a flattened issue: the issue's own body is the
+// first entry, followed by its comments and timeline events, in
+// chronological order
+type Entry struct {
+	Type      string    `json:"type"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	Body      string    `json:"body"`
+	// Event is only set for timeline events, e.g. 'labeled'. Their Body is
+	// the event's detail
+	Event string `json:"event,omitempty"`
+	// MinimizedReason is only set for comments minimized by a moderator
+	MinimizedReason string `json:"minimized_reason,omitempty"`
+}
+
+// Entries flattens 'issue' into a chronological stream of entries
+func (issue *Issue) Entries() []Entry {
+	entryType := EntryTypeIssue
+	if issue.IsPullRequest {
+		entryType = EntryTypePullRequest
+	}
+	body := ""
+	if issue.Body != nil {
+		body = *issue.Body
+	}
+	entries := []Entry{{
+		Type:      entryType,
+		Author:    issue.Author,
+		Timestamp: issue.CreatedAt,
+		Body:      body,
+	}}
+	for _, comment := range issue.Comments {
+		entries = append(entries, Entry{
+			Type:            EntryTypeComment,
+			Author:          comment.Author,
+			Timestamp:       comment.CreatedAt,
+			Body:            comment.Body,
+			MinimizedReason: comment.MinimizedReason,
+		})
+	}
+	for _, event := range issue.TimelineEvents {
+		entries = append(entries, Entry{
+			Type:      EntryTypeEvent,
+			Author:    event.Actor,
+			Timestamp: event.CreatedAt,
+			Body:      event.Detail,
+			Event:     event.Event,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
+
+// ManifestRepo is the entry of a single backed up repo in the manifest
+type ManifestRepo struct {
+	// ID is the same as Repo.ID
+	ID       int64  `json:"id,omitempty"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	// IssuesPath is where the repo's issues are, relative to the backup
+	// directory
+	IssuesPath string `json:"issues_path,omitempty"`
+	// SizeBytes is the on-disk size of the repo's artifacts. It's only
+	// filled with -size_report
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+}
+
+// Manifest describes a whole backup run. It's written to the root of the
+// backup directory once all repos are done
+type Manifest struct {
+	Org           string         `json:"org"`
+	Version       string         `json:"version"`
+	SchemaVersion int            `json:"schema_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Repos         []ManifestRepo `json:"repos"`
+	// Languages is the org-wide total of bytes per language, summed over all
+	// backed up repos
+	Languages map[string]int `json:"languages"`
+	// TotalSizeBytes is the on-disk size of the whole backup directory. It's
+	// only filled with -size_report
+	TotalSizeBytes int64 `json:"total_size_bytes,omitempty"`
+}
+
+// AddRepo records 'repo', whose issues are at 'issuesPath', in the manifest
+// and adds its languages to the org-wide total
+func (m *Manifest) AddRepo(repo *Repo, issuesPath string) {
+	m.Repos = append(m.Repos, ManifestRepo{
+		ID:         repo.ID,
+		Name:       repo.Name,
+		FullName:   repo.FullName,
+		IssuesPath: issuesPath,
+	})
+	if m.Languages == nil {
+		m.Languages = map[string]int{}
+	}
+	for language, bytes := range repo.Languages {
+		m.Languages[language] += bytes
+	}
+}
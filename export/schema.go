@@ -0,0 +1,213 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema document, generated from the structs in this
+// package.
+//
+// XXX Only the subset of JSON Schema needed to describe these structs is
+// generated (and validated): type, format, properties, required,
+// additionalProperties and items
+type Schema map[string]interface{}
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schemas returns the schema of every exported document, keyed by name
+func Schemas() map[string]Schema {
+	return map[string]Schema{
+		"manifest": newDocumentSchema("manifest", Manifest{}),
+		"repo":     newDocumentSchema("repo", Repo{}),
+		"issue":    newDocumentSchema("issue", Issue{}),
+		"entries":  newDocumentSchema("entries", []Entry{}),
+	}
+}
+
+func newDocumentSchema(name string, v interface{}) Schema {
+	s := schemaForType(reflect.TypeOf(v))
+	s["$schema"] = jsonSchemaDraft
+	s["title"] = fmt.Sprintf("clone_your_org %s (schema version %d)", name, SchemaVersion)
+	return s
+}
+
+func schemaForType(t reflect.Type) Schema {
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaForType(t.Elem())
+		s["type"] = []interface{}{s["type"], "null"}
+		return s
+	case reflect.Slice:
+		// XXX nil slices are marshalled as 'null'
+		return Schema{"type": []interface{}{"array", "null"}, "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": []interface{}{"object", "null"}, "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := Schema{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitempty := jsonFieldName(field)
+			if name == "" {
+				continue
+			}
+			properties[name] = schemaForType(field.Type)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return Schema{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	}
+	panic(fmt.Sprintf("export: no schema for type %s", t))
+}
+
+// jsonFieldName returns the name 'field' is marshalled as, and whether it's
+// 'omitempty'. An empty name means the field isn't marshalled at all
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitempty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
+
+// Validate checks that the JSON document 'data' conforms to 'schema' and
+// returns every violation found. An empty return value means it conforms
+func Validate(schema Schema, data []byte) []error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []error{err}
+	}
+	return validateValue(schema, v, "$")
+}
+
+func validateValue(schema Schema, v interface{}, path string) []error {
+	actual := jsonTypeOf(v)
+	if !typeMatches(schema["type"], actual) {
+		return []error{fmt.Errorf("%s: expected type %v, got %s", path, schema["type"], actual)}
+	}
+	var errs []error
+	switch value := v.(type) {
+	case string:
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid date-time %q", path, value))
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(Schema); ok {
+			for i, item := range value {
+				errs = append(errs, validateValue(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, ok := value[name]; !ok {
+					errs = append(errs, fmt.Errorf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(Schema)
+		// Sort the keys so errors are reported in a stable order
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "." + key
+			if property, ok := properties[key].(Schema); ok {
+				errs = append(errs, validateValue(property, value[key], childPath)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					errs = append(errs, fmt.Errorf("%s: unexpected property", childPath))
+				}
+			case Schema:
+				errs = append(errs, validateValue(additional, value[key], childPath)...)
+			}
+		}
+	}
+	return errs
+}
+
+// jsonTypeOf returns the JSON Schema type name of a value decoded with
+// json.Decoder.UseNumber()
+func jsonTypeOf(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeMatches(expected interface{}, actual string) bool {
+	switch expected := expected.(type) {
+	case string:
+		return expected == actual || (expected == "number" && actual == "integer")
+	case []interface{}:
+		for _, e := range expected {
+			if typeMatches(e, actual) {
+				return true
+			}
+		}
+	}
+	return false
+}
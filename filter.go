@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// repoFilter returns true if 'repo' should be kept. If it returns false,
+// 'reason' explains why the repo was dropped
+type repoFilter func(repo *github.Repository) (keep bool, reason string)
+
+// onlyPublicRepoFilter keeps only public repos
+func onlyPublicRepoFilter(repo *github.Repository) (bool, string) {
+	if repo.GetPrivate() {
+		return false, "repo is private"
+	}
+	return true, ""
+}
+
+// onlyPrivateRepoFilter keeps only private repos
+func onlyPrivateRepoFilter(repo *github.Repository) (bool, string) {
+	if !repo.GetPrivate() {
+		return false, "repo is public"
+	}
+	return true, ""
+}
+
+// newRepoFilterChain builds the list of filters to apply from the flags
+func newRepoFilterChain() ([]repoFilter, error) {
+	if *onlyPublicFlag && *onlyPrivateFlag {
+		return nil, print.Errorf("-only_public and -only_private are mutually exclusive")
+	}
+	var filters []repoFilter
+	if *onlyPublicFlag {
+		filters = append(filters, onlyPublicRepoFilter)
+	}
+	if *onlyPrivateFlag {
+		filters = append(filters, onlyPrivateRepoFilter)
+	}
+	return filters, nil
+}
+
+// filterRepos runs every repo in 'repos' through 'filters', in order, and
+// returns the ones that passed all of them
+func filterRepos(repos []*github.Repository, filters []repoFilter) []*github.Repository {
+	var kept []*github.Repository
+	for _, repo := range repos {
+		keep := true
+		for _, filter := range filters {
+			var reason string
+			keep, reason = filter(repo)
+			if !keep {
+				print.Debugf("Skipping repo %s: %s\n", repo.GetName(), reason)
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, repo)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v76/github"
+)
+
+func testRepo(name string, private bool) *github.Repository {
+	return &github.Repository{Name: github.Ptr(name), Private: github.Ptr(private)}
+}
+
+func repoNames(repos []*github.Repository) []string {
+	names := []string{}
+	for _, repo := range repos {
+		names = append(names, repo.GetName())
+	}
+	return names
+}
+
+// setFilterFlags sets -only_public and -only_private for the duration of 't'
+func setFilterFlags(t *testing.T, onlyPublic, onlyPrivate bool) {
+	t.Helper()
+	prevPublic, prevPrivate := *onlyPublicFlag, *onlyPrivateFlag
+	*onlyPublicFlag, *onlyPrivateFlag = onlyPublic, onlyPrivate
+	t.Cleanup(func() {
+		*onlyPublicFlag, *onlyPrivateFlag = prevPublic, prevPrivate
+	})
+}
+
+func TestRepoFilterChain(t *testing.T) {
+	repos := []*github.Repository{
+		testRepo("public-app", false),
+		testRepo("private-app", true),
+		testRepo("public-docs", false),
+		testRepo("private-docs", true),
+	}
+	// Stands for any other filter of the chain
+	onlyApps := func(repo *github.Repository) (bool, string) {
+		if !strings.HasSuffix(repo.GetName(), "-app") {
+			return false, "not an app"
+		}
+		return true, ""
+	}
+	for _, tc := range []struct {
+		name        string
+		onlyPublic  bool
+		onlyPrivate bool
+		extra       []repoFilter
+		repos       []*github.Repository
+		want        []string
+		wantErr     bool
+	}{
+		{name: "no filter", repos: repos,
+			want: []string{"public-app", "private-app", "public-docs", "private-docs"}},
+		{name: "only public", onlyPublic: true, repos: repos,
+			want: []string{"public-app", "public-docs"}},
+		{name: "only private", onlyPrivate: true, repos: repos,
+			want: []string{"private-app", "private-docs"}},
+		{name: "only public and another filter", onlyPublic: true, extra: []repoFilter{onlyApps}, repos: repos,
+			want: []string{"public-app"}},
+		{name: "only private and another filter", onlyPrivate: true, extra: []repoFilter{onlyApps}, repos: repos,
+			want: []string{"private-app"}},
+		{name: "another filter alone", extra: []repoFilter{onlyApps}, repos: repos,
+			want: []string{"public-app", "private-app"}},
+		{name: "empty list", onlyPublic: true, extra: []repoFilter{onlyApps}, repos: nil,
+			want: []string{}},
+		{name: "nothing passes", onlyPrivate: true, repos: []*github.Repository{testRepo("public-app", false)},
+			want: []string{}},
+		{name: "conflicting flags", onlyPublic: true, onlyPrivate: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setFilterFlags(t, tc.onlyPublic, tc.onlyPrivate)
+			filters, err := newRepoFilterChain()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("newRepoFilterChain() = %d filters, want an error", len(filters))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newRepoFilterChain(): %v", err)
+			}
+			filters = append(filters, tc.extra...)
+			got := repoNames(filterRepos(tc.repos, filters))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("filterRepos() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
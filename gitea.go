@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// giteaPageSize is the number of items requested per page. Gitea caps it
+// server-side (MAX_RESPONSE_ITEMS, 50 by default), so pages may be shorter
+const giteaPageSize = 50
+
+// giteaProvider backs up from a Gitea (or Forgejo) instance through its REST
+// API
+type giteaProvider struct {
+	baseURL    string
+	token      string
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newGiteaProvider(baseURL, token, userAgent string) (*giteaProvider, error) {
+	if len(baseURL) == 0 {
+		return nil, print.Errorf("nil Gitea URL")
+	}
+	if len(token) == 0 {
+		return nil, print.Errorf("nil access token")
+	}
+	return &giteaProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+// Subsets of Gitea's API objects: only what maps onto go-github's types
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+type giteaRepo struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	FullName        string    `json:"full_name"`
+	Description     string    `json:"description"`
+	Owner           giteaUser `json:"owner"`
+	Private         bool      `json:"private"`
+	Fork            bool      `json:"fork"`
+	Archived        bool      `json:"archived"`
+	SSHURL          string    `json:"ssh_url"`
+	CloneURL        string    `json:"clone_url"`
+	HTMLURL         string    `json:"html_url"`
+	DefaultBranch   string    `json:"default_branch"`
+	StarsCount      int       `json:"stars_count"`
+	WatchersCount   int       `json:"watchers_count"`
+	ForksCount      int       `json:"forks_count"`
+	OpenIssuesCount int       `json:"open_issues_count"`
+}
+
+type giteaLabel struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+type giteaIssue struct {
+	Number      int          `json:"number"`
+	Title       string       `json:"title"`
+	Body        string       `json:"body"`
+	User        giteaUser    `json:"user"`
+	Labels      []giteaLabel `json:"labels"`
+	State       string       `json:"state"`
+	Assignees   []giteaUser  `json:"assignees"`
+	Comments    int          `json:"comments"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	ClosedAt    *time.Time   `json:"closed_at"`
+	HTMLURL     string       `json:"html_url"`
+	PullRequest *struct {
+		HTMLURL  string     `json:"html_url"`
+		MergedAt *time.Time `json:"merged_at"`
+	} `json:"pull_request"`
+}
+
+type giteaComment struct {
+	ID        int64     `json:"id"`
+	User      giteaUser `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u giteaUser) toGitHub() *github.User {
+	return &github.User{Login: github.String(u.Login)}
+}
+
+func (r *giteaRepo) toGitHub() *github.Repository {
+	return &github.Repository{
+		ID:              github.Int64(r.ID),
+		Name:            github.String(r.Name),
+		FullName:        github.String(r.FullName),
+		Description:     github.String(r.Description),
+		Owner:           r.Owner.toGitHub(),
+		Private:         github.Bool(r.Private),
+		Fork:            github.Bool(r.Fork),
+		Archived:        github.Bool(r.Archived),
+		SSHURL:          github.String(r.SSHURL),
+		CloneURL:        github.String(r.CloneURL),
+		HTMLURL:         github.String(r.HTMLURL),
+		DefaultBranch:   github.String(r.DefaultBranch),
+		StargazersCount: github.Int(r.StarsCount),
+		WatchersCount:   github.Int(r.WatchersCount),
+		ForksCount:      github.Int(r.ForksCount),
+		OpenIssuesCount: github.Int(r.OpenIssuesCount),
+	}
+}
+
+func (i *giteaIssue) toGitHub() *github.Issue {
+	issue := &github.Issue{
+		Number:    github.Int(i.Number),
+		Title:     github.String(i.Title),
+		Body:      github.String(i.Body),
+		User:      i.User.toGitHub(),
+		State:     github.String(i.State),
+		Comments:  github.Int(i.Comments),
+		CreatedAt: &github.Timestamp{Time: i.CreatedAt},
+		UpdatedAt: &github.Timestamp{Time: i.UpdatedAt},
+		HTMLURL:   github.String(i.HTMLURL),
+		Labels:    []*github.Label{},
+	}
+	if i.ClosedAt != nil {
+		issue.ClosedAt = &github.Timestamp{Time: *i.ClosedAt}
+	}
+	for _, label := range i.Labels {
+		issue.Labels = append(issue.Labels, &github.Label{
+			Name:        github.String(label.Name),
+			Color:       github.String(label.Color),
+			Description: github.String(label.Description),
+		})
+	}
+	for _, assignee := range i.Assignees {
+		issue.Assignees = append(issue.Assignees, assignee.toGitHub())
+	}
+	if i.PullRequest != nil {
+		issue.PullRequestLinks = &github.PullRequestLinks{
+			HTMLURL: github.String(i.PullRequest.HTMLURL),
+		}
+		if i.PullRequest.MergedAt != nil {
+			issue.PullRequestLinks.MergedAt = &github.Timestamp{Time: *i.PullRequest.MergedAt}
+		}
+	}
+	return issue
+}
+
+func (c *giteaComment) toGitHub() *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(c.ID),
+		User:      c.User.toGitHub(),
+		Body:      github.String(c.Body),
+		CreatedAt: &github.Timestamp{Time: c.CreatedAt},
+		UpdatedAt: &github.Timestamp{Time: c.UpdatedAt},
+	}
+}
+
+// get does an authenticated GET on 'path' (relative to '/api/v1') and decodes
+// the JSON response in 'v'
+func (p *giteaProvider) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := fmt.Sprintf("%s/api/v1/%s?%s", p.baseURL, path, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+p.token)
+	req.Header.Set("Accept", "application/json")
+	if len(p.userAgent) != 0 {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{url: u, resp: resp}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getAllPages calls 'fetchPage' with increasing page numbers until it returns
+// an empty page.
+//
+// XXX A short page isn't the last one: the server may cap the page size below
+// giteaPageSize
+func getAllPages(fetchPage func(page int) (int, error)) error {
+	for page := 1; ; page++ {
+		count, err := fetchPage(page)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+	}
+}
+
+func giteaPageQuery(page int) url.Values {
+	query := url.Values{}
+	query.Set("page", fmt.Sprint(page))
+	query.Set("limit", fmt.Sprint(giteaPageSize))
+	return query
+}
+
+func (p *giteaProvider) ListRepos(ctx context.Context, org string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	err := getAllPages(func(page int) (int, error) {
+		print.Debugf("Fetching repos on page %d (total fetched %d)...\n", page, len(allRepos))
+		var repos []*giteaRepo
+		err := p.get(ctx, fmt.Sprintf("orgs/%s/repos", url.PathEscape(org)),
+			giteaPageQuery(page), &repos)
+		if err != nil {
+			return 0, err
+		}
+		for _, repo := range repos {
+			allRepos = append(allRepos, repo.toGitHub())
+		}
+		return len(repos), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allRepos, nil
+}
+
+func (p *giteaProvider) ListIssues(ctx context.Context, repo *github.Repository) ([]*github.Issue, error) {
+	var allIssues []*github.Issue
+	err := getAllPages(func(page int) (int, error) {
+		print.Debugf("Fetching issues on page %d (total fetched: %d)...\n", page, len(allIssues))
+		query := giteaPageQuery(page)
+		// XXX Without 'type', Gitea returns both issues and pulls
+		query.Set("state", "all")
+		var issues []*giteaIssue
+		err := p.get(ctx, fmt.Sprintf("repos/%s/%s/issues",
+			url.PathEscape(*repo.Owner.Login), url.PathEscape(*repo.Name)), query, &issues)
+		if err != nil {
+			return 0, err
+		}
+		for _, issue := range issues {
+			allIssues = append(allIssues, issue.toGitHub())
+		}
+		return len(issues), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allIssues, nil
+}
+
+func (p *giteaProvider) ListComments(ctx context.Context, repo *github.Repository, issue *github.Issue) ([]*github.IssueComment, error) {
+	// XXX This endpoint isn't paginated: it returns every comment at once
+	var comments []*giteaComment
+	err := p.get(ctx, fmt.Sprintf("repos/%s/%s/issues/%d/comments",
+		url.PathEscape(*repo.Owner.Login), url.PathEscape(*repo.Name), issue.GetNumber()), url.Values{}, &comments)
+	if err != nil {
+		return nil, err
+	}
+	var allComments []*github.IssueComment
+	for _, comment := range comments {
+		allComments = append(allComments, comment.toGitHub())
+	}
+	return allComments, nil
+}
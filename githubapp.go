@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is how long the JWTs we sign as the app are valid for.
+	// GitHub refuses anything over 10 minutes
+	appJWTLifetime = 9 * time.Minute
+	// appTokenRefreshMargin is how long before its expiry an installation
+	// token is replaced by a new one.
+	//
+	// XXX A clone authenticates once, when it starts, so this is also the
+	// longest a clone can take without its token expiring under it
+	appTokenRefreshMargin = 10 * time.Minute
+)
+
+// loadAppPrivateKey reads the PEM encoded RSA private key of a GitHub App,
+// as downloaded from its settings page, from 'path'
+func loadAppPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, print.Errorf("%s isn't a PEM encoded private key", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, print.Errorf("can't parse private key %s: %v", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, print.Errorf("private key %s isn't an RSA key", path)
+	}
+	return key, nil
+}
+
+// newAppJWT returns a JWT, signed with 'key', that authenticates as the
+// GitHub App 'appID' from 'now' on
+func newAppJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	// XXX 'iat' is backdated a minute to allow for clock drift, as GitHub
+	// recommends
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appTokenSource mints installation access tokens for the installation
+// 'installationID' of the GitHub App 'appID'. A token is reused until it
+// nears its expiry
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	userAgent      string
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && time.Until(s.token.Expiry) > appTokenRefreshMargin {
+		return s.token, nil
+	}
+	jwt, err := newAppJWT(s.appID, s.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	appClient := github.NewClient(nil).WithAuthToken(jwt)
+	if len(s.userAgent) != 0 {
+		appClient.UserAgent = s.userAgent
+	}
+	token, _, err := appClient.Apps.CreateInstallationToken(context.Background(),
+		s.installationID, nil)
+	if err != nil {
+		return nil, print.Errorf("can't create an installation token for installation %d: %v",
+			s.installationID, err)
+	}
+	print.Debugf("Got an installation token expiring at %v\n", token.GetExpiresAt().Time)
+	s.token = &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt().Time,
+	}
+	return s.token, nil
+}
+
+// newAppTokenSource returns a token source authenticating as the
+// installation 'installationID' of the GitHub App 'appID', whose private key
+// is at 'keyPath'
+func newAppTokenSource(appID, installationID int64,
+	keyPath, userAgent string) (oauth2.TokenSource, error) {
+	key, err := loadAppPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &appTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		userAgent:      userAgent,
+	}, nil
+}
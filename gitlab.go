@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// gitlabPageSize is the number of items requested per page, GitLab's maximum
+const gitlabPageSize = 100
+
+// gitlabProvider backs up from a GitLab instance through its REST API. An
+// "organization" is a group: only its own projects are listed, not those of
+// its subgroups
+type gitlabProvider struct {
+	baseURL    string
+	token      string
+	userAgent  string
+	httpClient *http.Client
+}
+
+func newGitLabProvider(baseURL, token, userAgent string) (*gitlabProvider, error) {
+	if len(baseURL) == 0 {
+		return nil, print.Errorf("nil GitLab URL")
+	}
+	if len(token) == 0 {
+		return nil, print.Errorf("nil access token")
+	}
+	return &gitlabProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+// Subsets of GitLab's API objects: only what maps onto go-github's types
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+type gitlabProject struct {
+	ID                int64  `json:"id"`
+	Path              string `json:"path"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Description       string `json:"description"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+	Visibility        string    `json:"visibility"`
+	ForkedFromProject *struct{} `json:"forked_from_project"`
+	Archived          bool      `json:"archived"`
+	SSHURLToRepo      string    `json:"ssh_url_to_repo"`
+	HTTPURLToRepo     string    `json:"http_url_to_repo"`
+	WebURL            string    `json:"web_url"`
+	DefaultBranch     string    `json:"default_branch"`
+	StarCount         int       `json:"star_count"`
+	ForksCount        int       `json:"forks_count"`
+	OpenIssuesCount   int       `json:"open_issues_count"`
+	Topics            []string  `json:"topics"`
+}
+
+type gitlabLabel struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// gitlabIssue is either an issue or a merge request: they share these fields
+type gitlabIssue struct {
+	IID            int           `json:"iid"`
+	Title          string        `json:"title"`
+	Description    string        `json:"description"`
+	Author         gitlabUser    `json:"author"`
+	Labels         []gitlabLabel `json:"labels"`
+	State          string        `json:"state"`
+	Assignees      []gitlabUser  `json:"assignees"`
+	UserNotesCount int           `json:"user_notes_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	ClosedAt       *time.Time    `json:"closed_at"`
+	ClosedBy       *gitlabUser   `json:"closed_by"`
+	WebURL         string        `json:"web_url"`
+	// MergedAt is only set for merge requests
+	MergedAt *time.Time `json:"merged_at"`
+}
+
+type gitlabNote struct {
+	ID     int64      `json:"id"`
+	Author gitlabUser `json:"author"`
+	Body   string     `json:"body"`
+	// System notes are events, e.g. "changed the description", not comments
+	System    bool      `json:"system"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (u gitlabUser) toGitHub() *github.User {
+	return &github.User{Login: github.String(u.Username)}
+}
+
+func (p *gitlabProject) toGitHub() *github.Repository {
+	return &github.Repository{
+		ID:              github.Int64(p.ID),
+		Name:            github.String(p.Path),
+		FullName:        github.String(p.PathWithNamespace),
+		Description:     github.String(p.Description),
+		Owner:           &github.User{Login: github.String(p.Namespace.FullPath)},
+		Private:         github.Bool(p.Visibility != "public"),
+		Visibility:      github.String(p.Visibility),
+		Fork:            github.Bool(p.ForkedFromProject != nil),
+		Archived:        github.Bool(p.Archived),
+		SSHURL:          github.String(p.SSHURLToRepo),
+		CloneURL:        github.String(p.HTTPURLToRepo),
+		HTMLURL:         github.String(p.WebURL),
+		DefaultBranch:   github.String(p.DefaultBranch),
+		StargazersCount: github.Int(p.StarCount),
+		ForksCount:      github.Int(p.ForksCount),
+		OpenIssuesCount: github.Int(p.OpenIssuesCount),
+		Topics:          p.Topics,
+	}
+}
+
+// toGitHub converts 'i' to a github.Issue. 'isMergeRequest' is true if 'i' is
+// a merge request: it keeps its own number, and is told apart from the issue
+// with the same number by being a PR
+func (i *gitlabIssue) toGitHub(isMergeRequest bool) *github.Issue {
+	state := i.State
+	// GitHub only has 'open' and 'closed': merged merge requests are closed
+	if state == "opened" {
+		state = "open"
+	} else if state == "merged" {
+		state = "closed"
+	}
+	issue := &github.Issue{
+		Number:    github.Int(i.IID),
+		Title:     github.String(i.Title),
+		Body:      github.String(i.Description),
+		User:      i.Author.toGitHub(),
+		State:     github.String(state),
+		Comments:  github.Int(i.UserNotesCount),
+		CreatedAt: &github.Timestamp{Time: i.CreatedAt},
+		UpdatedAt: &github.Timestamp{Time: i.UpdatedAt},
+		HTMLURL:   github.String(i.WebURL),
+		Labels:    []*github.Label{},
+	}
+	if i.ClosedAt != nil {
+		issue.ClosedAt = &github.Timestamp{Time: *i.ClosedAt}
+	}
+	if i.ClosedBy != nil {
+		issue.ClosedBy = i.ClosedBy.toGitHub()
+	}
+	for _, label := range i.Labels {
+		issue.Labels = append(issue.Labels, &github.Label{
+			Name: github.String(label.Name),
+			// GitLab's colors have a leading '#', GitHub's don't
+			Color:       github.String(strings.TrimPrefix(label.Color, "#")),
+			Description: github.String(label.Description),
+		})
+	}
+	for _, assignee := range i.Assignees {
+		issue.Assignees = append(issue.Assignees, assignee.toGitHub())
+	}
+	if isMergeRequest {
+		issue.PullRequestLinks = &github.PullRequestLinks{HTMLURL: github.String(i.WebURL)}
+		if i.MergedAt != nil {
+			issue.PullRequestLinks.MergedAt = &github.Timestamp{Time: *i.MergedAt}
+			// XXX Merged merge requests have no closed_at
+			if issue.ClosedAt == nil {
+				issue.ClosedAt = issue.PullRequestLinks.MergedAt
+			}
+		}
+	}
+	return issue
+}
+
+func (n *gitlabNote) toGitHub() *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(n.ID),
+		User:      n.Author.toGitHub(),
+		Body:      github.String(n.Body),
+		CreatedAt: &github.Timestamp{Time: n.CreatedAt},
+		UpdatedAt: &github.Timestamp{Time: n.UpdatedAt},
+	}
+}
+
+// get does an authenticated GET on 'path' (relative to '/api/v4') and decodes
+// the JSON response in 'v'. It returns the next page number, or 0 if this was
+// the last page
+func (p *gitlabProvider) get(ctx context.Context, path string, query url.Values, v interface{}) (int, error) {
+	u := fmt.Sprintf("%s/api/v4/%s?%s", p.baseURL, path, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Accept", "application/json")
+	if len(p.userAgent) != 0 {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &httpStatusError{url: u, resp: resp}
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return 0, err
+	}
+	// XXX X-Next-Page is empty on the last page
+	nextPage, _ := strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	return nextPage, nil
+}
+
+// getAllGitLabPages calls 'fetchPage' with page 1, then with every next page
+// it returns, until there are none left
+func getAllGitLabPages(fetchPage func(page int) (int, error)) error {
+	for page := 1; page != 0; {
+		var err error
+		page, err = fetchPage(page)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gitlabPageQuery(page int) url.Values {
+	query := url.Values{}
+	query.Set("page", fmt.Sprint(page))
+	query.Set("per_page", fmt.Sprint(gitlabPageSize))
+	return query
+}
+
+// gitlabProjectPath returns the API path of 'repo', by ID: a project's path can
+// change, its ID can't
+func gitlabProjectPath(repo *github.Repository) string {
+	return fmt.Sprintf("projects/%d", repo.GetID())
+}
+
+func (p *gitlabProvider) ListRepos(ctx context.Context, org string) ([]*github.Repository, error) {
+	var allRepos []*github.Repository
+	err := getAllGitLabPages(func(page int) (int, error) {
+		print.Debugf("Fetching repos on page %d (total fetched %d)...\n", page, len(allRepos))
+		var projects []*gitlabProject
+		nextPage, err := p.get(ctx, fmt.Sprintf("groups/%s/projects", url.PathEscape(org)),
+			gitlabPageQuery(page), &projects)
+		if err != nil {
+			return 0, err
+		}
+		for _, project := range projects {
+			allRepos = append(allRepos, project.toGitHub())
+		}
+		return nextPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allRepos, nil
+}
+
+// listIssues returns every issue, or every merge request if 'isMergeRequest',
+// of 'repo'
+func (p *gitlabProvider) listIssues(ctx context.Context, repo *github.Repository,
+	isMergeRequest bool) ([]*github.Issue, error) {
+	kind := "issues"
+	if isMergeRequest {
+		kind = "merge_requests"
+	}
+	var allIssues []*github.Issue
+	err := getAllGitLabPages(func(page int) (int, error) {
+		print.Debugf("Fetching %s on page %d (total fetched: %d)...\n", kind, page, len(allIssues))
+		query := gitlabPageQuery(page)
+		query.Set("scope", "all")
+		query.Set("state", "all")
+		query.Set("with_labels_details", "true")
+		var issues []*gitlabIssue
+		nextPage, err := p.get(ctx, gitlabProjectPath(repo)+"/"+kind, query, &issues)
+		if err != nil {
+			return 0, err
+		}
+		for _, issue := range issues {
+			allIssues = append(allIssues, issue.toGitHub(isMergeRequest))
+		}
+		return nextPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allIssues, nil
+}
+
+func (p *gitlabProvider) ListIssues(ctx context.Context, repo *github.Repository) ([]*github.Issue, error) {
+	issues, err := p.listIssues(ctx, repo, false)
+	if err != nil {
+		return nil, err
+	}
+	mergeRequests, err := p.listIssues(ctx, repo, true)
+	if err != nil {
+		// XXX Projects with merge requests disabled answer with a 403
+		if !isAccessDenied(err) {
+			return nil, err
+		}
+		print.Debugf("Skipping merge requests of %s: %v\n", *repo.Name, err)
+	}
+	return append(issues, mergeRequests...), nil
+}
+
+func (p *gitlabProvider) ListComments(ctx context.Context, repo *github.Repository, issue *github.Issue) ([]*github.IssueComment, error) {
+	kind := "issues"
+	if issue.IsPullRequest() {
+		kind = "merge_requests"
+	}
+	path := fmt.Sprintf("%s/%s/%d/notes", gitlabProjectPath(repo), kind, issue.GetNumber())
+	var allComments []*github.IssueComment
+	err := getAllGitLabPages(func(page int) (int, error) {
+		query := gitlabPageQuery(page)
+		query.Set("sort", "asc")
+		query.Set("order_by", "created_at")
+		var notes []*gitlabNote
+		nextPage, err := p.get(ctx, path, query, &notes)
+		if err != nil {
+			return 0, err
+		}
+		for _, note := range notes {
+			if note.System {
+				continue
+			}
+			allComments = append(allComments, note.toGitHub())
+		}
+		return nextPage, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allComments, nil
+}
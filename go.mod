@@ -1,9 +1,29 @@
 module github.com/afjoseph/clone_your_org
 
-go 1.16
+go 1.24.0
 
 require (
 	github.com/afjoseph/commongo v1.0.3
-	github.com/google/go-github/v33 v33.0.0
+	github.com/fatih/color v1.10.0
+	github.com/google/go-github/v76 v76.0.0
+	github.com/mattn/go-isatty v0.0.20
 	golang.org/x/oauth2 v0.0.0-20210313182246-cd4f82c27b84
+	modernc.org/sqlite v1.34.5
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-colorable v0.1.8 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	google.golang.org/appengine v1.6.6 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
 )
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// graphQLError is a single error of a GraphQL response
+type graphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// graphQLErrors are the errors of a GraphQL response. GitHub answers them with
+// a 200, so go-github doesn't see them
+type graphQLErrors []graphQLError
+
+func (e graphQLErrors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+	return "GraphQL: " + strings.Join(messages, "; ")
+}
+
+// isGraphQLAccessDenied returns true if 'err' means the token can't see what
+// was queried, e.g. because it lacks a scope
+func isGraphQLAccessDenied(err error) bool {
+	var errs graphQLErrors
+	if !errors.As(err, &errs) {
+		return isAccessDenied(err)
+	}
+	for _, e := range errs {
+		switch e.Type {
+		case "FORBIDDEN", "INSUFFICIENT_SCOPES", "NOT_FOUND":
+			return true
+		}
+	}
+	return false
+}
+
+// queryGraphQL uses 'client' and 'ctx' to run the GraphQL 'query' with
+// 'variables' against GitHub's GraphQL API and decodes its data into 'out'.
+//
+// XXX go-github is REST only: this goes through its client anyway, so
+// GraphQL queries get the same authentication, User-Agent and rate limit
+// handling as everything else
+func queryGraphQL(client *github.Client, ctx context.Context,
+	query string, variables map[string]interface{}, out interface{}) error {
+	// GitHub Enterprise Server serves GraphQL at '/api/graphql', next to the
+	// REST API's '/api/v3/'
+	u := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		u = "../graphql"
+	}
+	req, err := client.NewRequest("POST", u, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	var body struct {
+		Data   json.RawMessage `json:"data"`
+		Errors graphQLErrors   `json:"errors"`
+	}
+	resp, err := client.Do(ctx, req, &body)
+	if err != nil {
+		return err
+	}
+	if len(body.Errors) != 0 {
+		return body.Errors
+	}
+	err = json.Unmarshal(body.Data, out)
+	if err != nil {
+		return err
+	}
+	return waitForRateLimit(ctx, resp)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// runPostRepoHook runs -post_repo_hook once 'repo' is backed up to
+// 'backupDirPath'. The hook gets the repo's name and the backup directory as
+// its last two arguments, and in the environment as:
+//
+//   - CLONE_YOUR_ORG_REPO: the repo's name
+//   - CLONE_YOUR_ORG_REPO_FULL_NAME: the repo's 'owner/name'
+//   - CLONE_YOUR_ORG_BACKUP_DIR: the backup directory
+//
+// A failing hook is only logged, unless -post_repo_hook_fatal is set.
+//
+// XXX The hook command is split on whitespace and isn't run through a shell:
+// use a script for anything fancier
+func runPostRepoHook(ctx context.Context, backupDirPath string, repo *github.Repository) error {
+	args := strings.Fields(*postRepoHookFlag)
+	if len(args) == 0 {
+		return nil
+	}
+	args = append(args, repo.GetName(), backupDirPath)
+	env := []string{
+		"CLONE_YOUR_ORG_REPO=" + repo.GetName(),
+		"CLONE_YOUR_ORG_REPO_FULL_NAME=" + repo.GetFullName(),
+		"CLONE_YOUR_ORG_BACKUP_DIR=" + backupDirPath,
+	}
+	out, err := runCommand(ctx, "", env, args[0], args[1:]...)
+	if err != nil {
+		if *postRepoHookFatalFlag {
+			return print.Errorf("post repo hook failed for %s: %v", repo.GetName(), err)
+		}
+		print.Warnf("Post repo hook failed for %s: %v\n", repo.GetName(), err)
+		return nil
+	}
+	if len(out) != 0 {
+		print.Debugf("Post repo hook output for %s:\n%s\n", repo.GetName(), out)
+	}
+	return nil
+}
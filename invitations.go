@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const invitationsFileName = "invitations.json"
+
+// invitationBackup is what gets written for each pending invitation
+type invitationBackup struct {
+	Invitee string `json:"invitee"`
+	Inviter string `json:"inviter,omitempty"`
+	// Permission is 'read', 'triage', 'write', 'maintain' or 'admin'
+	Permission string     `json:"permission"`
+	CreatedAt  *time.Time `json:"created_at"`
+	// Expired invitations can't be accepted anymore, but are still listed
+	// until they're deleted
+	Expired bool `json:"expired"`
+}
+
+// backupRepoInvitations uses 'client' and 'ctx' to write the pending
+// collaborator invitations of 'repo', with who was invited, by whom, with
+// what permission and when, to 'invitations.json' in its meta directory.
+//
+// XXX Listing invitations needs admin access to the repo: repos the token
+// isn't an admin of are skipped
+func backupRepoInvitations(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	opts := &github.ListOptions{PerPage: 100}
+	invitations, err := paginate(ctx, "invitations", func(page int) ([]*github.RepositoryInvitation, *github.Response, error) {
+		opts.Page = page
+		return client.Repositories.ListInvitations(ctx, owner, name, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping invitations of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	out := []invitationBackup{}
+	for _, invitation := range invitations {
+		backup := invitationBackup{
+			Invitee:    invitation.GetInvitee().GetLogin(),
+			Inviter:    invitation.GetInviter().GetLogin(),
+			Permission: invitation.GetPermissions(),
+			Expired:    invitation.GetExpired(),
+		}
+		if invitation.CreatedAt != nil {
+			backup.CreatedAt = &invitation.CreatedAt.Time
+		}
+		out = append(out, backup)
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d pending invitations of %s\n", len(out), name)
+	return writeJSONFile(filepath.Join(targetDir, invitationsFileName), out)
+}
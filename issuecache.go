@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+	"github.com/google/go-github/v76/github"
+)
+
+const issueCacheFileName = "issue_cache.json"
+
+// issueCache stores when every written issue was last updated, across runs,
+// in 'issue_cache.json' in the backup directory
+type issueCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+// loadIssueCache reads the cache of 'backupDirPath', if there's one
+func loadIssueCache(backupDirPath string) (*issueCache, error) {
+	c := &issueCache{
+		path:    filepath.Join(backupDirPath, issueCacheFileName),
+		entries: map[string]time.Time{},
+	}
+	if !util.IsFile(c.path) {
+		return c, nil
+	}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	// XXX Caches of older runs went through -bom
+	err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), &c.entries)
+	if err != nil {
+		return nil, print.Errorf("can't parse %s: %v", c.path, err)
+	}
+	return c, nil
+}
+
+func issueCacheKey(repo *github.Repository, issue *github.Issue) string {
+	// XXX GitLab's own notation for merge requests, which are numbered apart
+	// from issues
+	if issue.IsPullRequest() && hasSeparatePullRequestNumbers() {
+		return fmt.Sprintf("%s!%d", repo.GetFullName(), issue.GetNumber())
+	}
+	return fmt.Sprintf("%s#%d", repo.GetFullName(), issue.GetNumber())
+}
+
+// unchanged returns true if 'issue' of 'repo' was written by a previous run
+// and wasn't updated since
+func (c *issueCache) unchanged(repo *github.Repository, issue *github.Issue) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	updatedAt, ok := c.entries[issueCacheKey(repo, issue)]
+	return ok && updatedAt.Equal(issue.GetUpdatedAt().Time)
+}
+
+// set records that 'issue' of 'repo' was written as of its current update
+// time
+func (c *issueCache) set(repo *github.Repository, issue *github.Issue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[issueCacheKey(repo, issue)] = issue.GetUpdatedAt().Time
+}
+
+// save writes the cache back to disk
+func (c *issueCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(c.path, c.entries)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const labelsFileName = "labels.json"
+
+// newLabelExport converts 'label' to its exported form. Labels without a
+// description have an empty one
+func newLabelExport(label *github.Label) export.Label {
+	return export.Label{
+		Name:        label.GetName(),
+		Color:       label.GetColor(),
+		Description: label.GetDescription(),
+	}
+}
+
+// backupRepoLabels uses 'client' and 'ctx' to write every label of 'repo',
+// with its color and description, to 'labels.json' in its meta directory.
+//
+// XXX This includes the labels no issue uses, so they can all be recreated
+// before the issues are restored
+func backupRepoLabels(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	opts := &github.ListOptions{PerPage: 100}
+	labels, err := paginate(ctx, "labels", func(page int) ([]*github.Label, *github.Response, error) {
+		opts.Page = page
+		return client.Issues.ListLabels(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping labels of %s: %v\n", *repo.Name, err)
+			return nil
+		}
+		return err
+	}
+	out := []export.Label{}
+	for _, label := range labels {
+		out = append(out, newLabelExport(label))
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, labelsFileName), out)
+}
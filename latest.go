@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+const latestLinkName = "latest"
+
+// updateLatestLink points the 'latest' symlink next to 'backupDirPath' at it.
+// In a multi-org run, each org gets its own 'latest__<org>'.
+//
+// XXX The new symlink is created under a temporary name and renamed over the
+// old one, so whoever follows 'latest' never sees it missing. Where symlinks
+// aren't available, e.g. on Windows without developer mode, 'latest.txt'
+// gets the backup's absolute path instead
+func updateLatestLink(backupDirPath, org string, multiOrg bool) error {
+	absPath, err := filepath.Abs(backupDirPath)
+	if err != nil {
+		return err
+	}
+	name := latestLinkName
+	if multiOrg {
+		name = fmt.Sprintf("%s__%s", latestLinkName, org)
+	}
+	linkPath := filepath.Join(filepath.Dir(absPath), name)
+	tmpPath := fmt.Sprintf("%s.tmp-%d", linkPath, os.Getpid())
+
+	os.Remove(tmpPath)
+	err = os.Symlink(filepath.Base(absPath), tmpPath)
+	if err == nil {
+		err = os.Rename(tmpPath, linkPath)
+		if err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		print.Debugf("Pointed %s at %s\n", linkPath, absPath)
+		return nil
+	}
+	print.Debugf("Can't create symlink %s: %v\n", linkPath, err)
+	err = os.WriteFile(tmpPath, []byte(absPath+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, linkPath+".txt")
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	print.Debugf("Wrote %s to %s.txt\n", absPath, linkPath)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	// layoutFlat puts every artifact of a repo as siblings at the root of the
+	// backup directory: '<name>.git', '<name>__issues', '<name>__meta', ...
+	layoutFlat = "flat"
+	// layoutNested puts every artifact of a repo under a single '<name>'
+	// directory: '<name>/code.git', '<name>/issues', '<name>/meta', ...
+	layoutNested = "nested"
+)
+
+// Kinds of artifacts a repo backup is made of
+const (
+	artifactCode        = "code"
+	artifactIssues      = "issues"
+	artifactMeta        = "meta"
+	artifactPulls       = "pulls"
+	artifactSource      = "src"
+	artifactReleases    = "releases"
+	artifactDeployments = "deployments"
+)
+
+func isValidLayout(layout string) bool {
+	return layout == layoutFlat || layout == layoutNested
+}
+
+// flatIssuesDirName is the directory -dir_flat_issues puts every repo's
+// issues in, as 'issues/<name>'
+const flatIssuesDirName = "issues"
+
+// repoArtifactPath returns where the artifact 'kind' of the repo 'repoName' is
+// stored in 'backupDirPath', according to -layout and -dir_flat_issues
+func repoArtifactPath(backupDirPath, repoName, kind string) string {
+	if kind == artifactIssues && *dirFlatIssuesFlag {
+		return filepath.Join(backupDirPath, flatIssuesDirName, repoName)
+	}
+	if *layoutFlag == layoutNested {
+		if kind == artifactCode {
+			return filepath.Join(backupDirPath, repoName, "code.git")
+		}
+		return filepath.Join(backupDirPath, repoName, kind)
+	}
+	if kind == artifactCode {
+		return filepath.Join(backupDirPath, fmt.Sprintf("%s.git", repoName))
+	}
+	return filepath.Join(backupDirPath, fmt.Sprintf("%s__%s", repoName, kind))
+}
+
+// orgArtifactsRepoName is the name of the repo whose artifacts would be
+// stored where the org-level ones are with the default -layout
+const orgArtifactsRepoName = "org"
+
+// orgArtifactPath returns where the org-level artifact 'kind' is stored in
+// 'backupDirPath': 'org__<kind>'
+func orgArtifactPath(backupDirPath, kind string) string {
+	return filepath.Join(backupDirPath, fmt.Sprintf("org__%s", kind))
+}
+
+// writesOrgArtifacts returns whether the flags of the run make it store
+// org-level artifacts, with orgArtifactPath
+func writesOrgArtifacts() bool {
+	return *outsideCollaboratorsFlag || *customPropertiesFlag || *rulesetsFlag || *brandingFlag ||
+		*communityFlag || *projectsFlag || *packagesFlag || *auditLogFlag
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// listedRepo is a single repo in the output of -list -json
+type listedRepo struct {
+	FullName      string `json:"full_name"`
+	Private       bool   `json:"private"`
+	Archived      bool   `json:"archived"`
+	Fork          bool   `json:"fork"`
+	DefaultBranch string `json:"default_branch"`
+	SSHURL        string `json:"ssh_url"`
+	CloneURL      string `json:"clone_url"`
+}
+
+// printRepoList writes the full names of 'repos' to stdout, one per line, or
+// as a JSON array with -json
+func printRepoList(repos []*github.Repository) error {
+	if !*jsonFlag {
+		for _, repo := range repos {
+			fmt.Println(repo.GetFullName())
+		}
+		return nil
+	}
+	out := []listedRepo{}
+	for _, repo := range repos {
+		out = append(out, listedRepo{
+			FullName:      repo.GetFullName(),
+			Private:       repo.GetPrivate(),
+			Archived:      repo.GetArchived(),
+			Fork:          repo.GetFork(),
+			DefaultBranch: repo.GetDefaultBranch(),
+			SSHURL:        repo.GetSSHURL(),
+			CloneURL:      repo.GetCloneURL(),
+		})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -2,235 +2,1459 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/afjoseph/clone_your_org/export"
 	"github.com/afjoseph/clone_your_org/projectpath"
 	"github.com/afjoseph/commongo/print"
 	"github.com/afjoseph/commongo/util"
-	"github.com/google/go-github/v33/github"
+	"github.com/google/go-github/v76/github"
 	"golang.org/x/oauth2"
 )
 
 var (
 	GitAccessTokenFlag           = flag.String("git_access_token", "", "REQUIRED: Git OAuth2 access token")
-	OrganizationNameFlag         = flag.String("target_organization_name", "", "REQUIRED: Name of the GH organization to backup")
+	oauthDeviceFlowFlag          = flag.Bool("oauth_device_flow", false, "OPTIONAL: without -git_access_token, log in through a browser instead: a code and a URL are printed, and the token is received once they're authorized. Needs -oauth_client_id")
+	oauthClientIDFlag            = flag.String("oauth_client_id", "", "OPTIONAL: with -oauth_device_flow, the client ID of the OAuth app to authorize, with device flow enabled in its settings")
+	oauthScopesFlag              = flag.String("oauth_scopes", "repo read:org", "OPTIONAL: with -oauth_device_flow, the space-separated scopes to ask for")
+	oauthTokenCacheFlag          = flag.String("oauth_token_cache", "~/.config/clone_your_org/oauth_token.json", "OPTIONAL: with -oauth_device_flow, where the token is cached, only readable by the user, to be reused by the next runs. Empty to not cache it")
+	githubAppFlag                = flag.Bool("github_app", false, "OPTIONAL: authenticate as a GitHub App installation instead of with -git_access_token. Needs -github_app_id, -github_app_installation_id and -github_app_private_key")
+	githubAppIDFlag              = flag.Int64("github_app_id", 0, "OPTIONAL: with -github_app, the app's ID")
+	githubAppInstallationIDFlag  = flag.Int64("github_app_installation_id", 0, "OPTIONAL: with -github_app, the ID of the app's installation on the org")
+	githubAppPrivateKeyFlag      = flag.String("github_app_private_key", "", "OPTIONAL: with -github_app, path to the app's PEM private key")
+	OrganizationNameFlag         = flag.String("target_organization_name", "", "REQUIRED: Name of the GH organization to backup. Several orgs can be backed up in one run, comma-separated")
+	latestLinkFlag               = flag.Bool("latest_link", false, "OPTIONAL: once a backup completes, point a 'latest' symlink next to it at it (latest.txt with its path where symlinks aren't available)")
+	failFastFlag                 = flag.Bool("fail_fast", false, "OPTIONAL: abort the run on the first repo that fails to back up, instead of backing up the others and failing at the end")
+	concurrencyPerHostFlag       = flag.String("concurrency_per_host", "", "OPTIONAL: comma-separated 'host=N' pairs capping how many repos cloned from each host are backed up at the same time, on top of -concurrency, e.g. 'github.com=8,git.example.com=2'")
+	orgConcurrencyFlag           = flag.Int("org_concurrency", 1, "OPTIONAL: in a multi-org run, how many orgs are backed up at the same time. -concurrency still caps the repos backed up at once, across all orgs")
+	strictFlag                   = flag.Bool("strict", false, "OPTIONAL: in a multi-org run, fail instead of skipping an org the token can't see")
 	BackupDirPathFlag            = flag.String("backup_dir", "", "OPTIONAL: backup directory. If you don't supply one, it'll be created in the root of the project")
+	updateMirrorsFlag            = flag.Bool("update_mirrors", false, "OPTIONAL: fetch into the mirrors already in backup_dir with 'git remote update' instead of skipping them, and log and record in refs_delta.json which refs moved and by how many commits")
 	forceUpdateExistingReposFlag = flag.Bool("force_update_existing_repos", false, "OPTIONAL: force update existing repos, if any were found in backup_dir")
+	tuiFlag                      = flag.Bool("tui", false, "OPTIONAL: show a live dashboard of the repos in flight, issues written and rate limit left instead of the log, which still goes to run.log. Falls back to the log when stdout isn't a terminal")
+	sizeReportFlag               = flag.Bool("size_report", false, "OPTIONAL: once the backup is done, print the on-disk size of each repo, largest first, and the total, and record them in the manifest")
+	statsCSVFlag                 = flag.Bool("stats_csv", false, "OPTIONAL: append each repo's stargazers/watchers/forks/open issues counts to stats.csv in backup_dir")
+	snapshotCSVFlag              = flag.Bool("snapshot_csv", false, "OPTIONAL: append each repo's open/closed issues and open/merged PRs counts to snapshot.csv in backup_dir")
+	onlyPublicFlag               = flag.Bool("only_public", false, "OPTIONAL: only backup public repos")
+	onlyPrivateFlag              = flag.Bool("only_private", false, "OPTIONAL: only backup private repos")
+	userAgentFlag                = flag.String("user_agent", "clone_your_org/"+version, "OPTIONAL: User-Agent sent with every GitHub API request")
+	dirTemplateFlag              = flag.String("dir_template", defaultDirTemplate, "OPTIONAL: Go template for the backup directory name. Available variables: {{.Org}}, {{.Date}}, {{.User}}. It's created under backup_dir if supplied, else in the root of the project")
+	layoutFlag                   = flag.String("layout", layoutFlat, "OPTIONAL: how a repo's artifacts are laid out. 'flat' puts <name>.git, <name>__issues, <name>__meta at the root of backup_dir. 'nested' puts them under <name>/ as code.git, issues/, meta/")
+	dirFlatIssuesFlag            = flag.Bool("dir_flat_issues", false, "OPTIONAL: write every repo's issues to a single issues/<name>/ tree instead of next to the repo's other artifacts")
+	providerFlag                 = flag.String("provider", providerGitHub, "OPTIONAL: where to backup from. One of: github, gitea, gitlab")
+	giteaURLFlag                 = flag.String("gitea_url", "", "OPTIONAL: base URL of the Gitea/Forgejo instance, e.g. https://gitea.example.com. REQUIRED with -provider gitea")
+	gitlabURLFlag                = flag.String("gitlab_url", "https://gitlab.com", "OPTIONAL: with -provider gitlab, base URL of the GitLab instance")
+	verifyFlag                   = flag.Bool("verify", false, "OPTIONAL: verify each mirror after cloning it with 'git fsck' and by comparing its branches with the remote. Slow")
+	reviewThreadsFlag            = flag.Bool("review_threads", false, "OPTIONAL: record each PR's review threads, with their comments and whether they're resolved. Costs an extra GraphQL query per PR")
+	mergeSettingsFlag            = flag.Bool("merge_settings", false, "OPTIONAL: fetch each repo again for its merge button settings, which repo listings leave out. Costs one API call per repo")
+	requestedReviewersFlag       = flag.Bool("requested_reviewers", false, "OPTIONAL: record each PR's pending review requests, users and teams. Costs one API call per PR")
+	prDetailsFlag                = flag.Bool("pr_details", false, "OPTIONAL: record each PR's state, draft flag and mergeability at backup time. Costs one API call per PR")
+	prCommitsFlag                = flag.Bool("pr_commits", false, "OPTIONAL: record each PR's commits (SHA, author, message) and changed files (path, status, additions, deletions). Costs at least two API calls per PR")
+	prDiffsFlag                  = flag.Bool("pr_diffs", false, "OPTIONAL: backup the unified diff of each PR to <name>__pulls/<number>.diff")
+	prPatchesFlag                = flag.Bool("pr_patches", false, "OPTIONAL: with -pr_diffs, also backup each PR in patch format to <name>__pulls/<number>.patch")
+	skipEmptyIssuesFlag          = flag.Bool("skip_empty_issues", false, "OPTIONAL: don't write issues with an empty body and no comments, e.g. ones opened by bots. PRs are always written")
+	exportWorktreeFlag           = flag.Bool("export_worktree", false, "OPTIONAL: also check out the tip of each repo's default branch to <name>__src/, for browsing without git. The mirror stays the canonical backup")
+	authorsFlag                  = flag.Bool("authors", false, "OPTIONAL: write every distinct commit author and committer of each repo, as 'Name <email>', to authors.txt in its meta directory")
+	branchDivergenceFlag         = flag.Bool("branch_divergence", false, "OPTIONAL: also record in refs.json how many commits each branch is ahead of and behind the default branch, computed on the mirror, to spot stale or diverged branches")
+	tagsIndexFlag                = flag.Bool("tags_index", false, "OPTIONAL: write each repo's tags, with their commit SHA and date, to tags.json in its meta directory")
+	releasesFlag                 = flag.Bool("releases", false, "OPTIONAL: backup each repo's releases, and download their assets, to <name>__releases/")
+	subscribersFlag              = flag.Bool("subscribers", false, "OPTIONAL: record who's subscribed to each issue and PR, as far as the API tells, and each repo's watchers to watchers.json in its meta directory. Costs an extra GraphQL query per issue")
+	editsFlag                    = flag.Bool("edits", false, "OPTIONAL: record when, and by whom, each issue, PR and comment was last edited. Costs an extra GraphQL query per issue")
+	duplicatesFlag               = flag.Bool("duplicates", false, "OPTIONAL: record which issue or PR each one was marked as a duplicate of, and its duplicates. Costs an extra GraphQL query per issue")
+	minimizedFlag                = flag.Bool("minimized", false, "OPTIONAL: record which comments were minimized by a moderator, and why (spam, off-topic, ...), and collapse them in Markdown. Costs an extra GraphQL query per issue with comments")
+	reactionsFlag                = flag.Bool("reactions", false, "OPTIONAL: record how many of each reaction issues, PRs and comments got")
+	reactionsDetailedFlag        = flag.Bool("reactions_detailed", false, "OPTIONAL: like -reactions, but also record who reacted with what. Costs an extra API call per issue and comment with reactions")
+	subIssuesFlag                = flag.Bool("sub_issues", false, "OPTIONAL: record each issue's parent and sub-issues, and the issues its task list references. Costs an extra API call per issue")
+	milestonesFlag               = flag.Bool("milestones", false, "OPTIONAL: write each repo's milestones, with the numbers of their issues, to milestones.json and milestones.md in its meta directory")
+	securityAlertsFlag           = flag.Bool("security_alerts", false, "OPTIONAL: backup each repo's code scanning and secret scanning alerts to <name>__security/. Secret values are redacted")
+	brandingFlag                 = flag.Bool("branding", false, "OPTIONAL: download the org's avatar to org__meta/ and each repo's custom social preview image to its meta directory")
+	outsideCollaboratorsFlag     = flag.Bool("outside_collaborators", false, "OPTIONAL: write the org's outside collaborators, whether they have two-factor authentication disabled and which repos they have access to, to org__meta/outside_collaborators.json. Needs an org owner, and costs an extra API call per repo")
+	customPropertiesFlag         = flag.Bool("custom_properties", false, "OPTIONAL: backup each repo's custom property values to custom_properties.json in its meta directory, and the org's property definitions to org__meta/custom_properties.json")
+	rulesetsFlag                 = flag.Bool("rulesets", false, "OPTIONAL: backup each repo's rulesets to rulesets.json in its meta directory, and the org's to org__meta/rulesets.json")
+	pagesFlag                    = flag.Bool("pages", false, "OPTIONAL: write each repo's GitHub Pages settings (build type, source branch and path, custom domain, HTTPS enforcement) to pages.json in its meta directory. Repos without Pages are skipped")
+	environmentsFlag             = flag.Bool("environments", false, "OPTIONAL: backup each repo's deployment environments, their protection rules and secret names to environments.json in its meta directory")
+	readmeFlag                   = flag.Bool("readme", false, "OPTIONAL: write each repo's README, as is, to its meta directory")
+	readmeHTMLFlag               = flag.Bool("readme_html", false, "OPTIONAL: with -readme, also write a Markdown README rendered to HTML by GitHub to README.html in its meta directory")
+	invitationsFlag              = flag.Bool("invitations", false, "OPTIONAL: backup each repo's pending collaborator invitations (invitee, permission, creation date) to invitations.json in its meta directory. Needs admin access to the repo")
+	variablesFlag                = flag.Bool("variables", false, "OPTIONAL: backup each repo's Actions variables, with their values, to variables.json in its meta directory")
+	deploymentsFlag              = flag.Bool("deployments", false, "OPTIONAL: backup each repo's deployments and their status transitions to its deployments directory")
+	sbomFlag                     = flag.Bool("sbom", false, "OPTIONAL: write the SPDX SBOM of each repo's dependency graph to sbom.spdx.json in its meta directory")
+	dedupeAttachmentsFlag        = flag.Bool("dedupe_attachments", false, "OPTIONAL: download issue and comment attachments to a content-addressed objects/<sha256> store, and link them from the issues")
+	metaGitFlag                  = flag.Bool("meta_git", false, "OPTIONAL: copy every repo's meta directory to a __meta.git working directory in backup_dir and commit it, so its history shows what changed between runs")
+	communityFlag                = flag.Bool("community", false, "OPTIONAL: backup the org's default community health files, from its .github repo, and each repo's community profile to org__meta/community/")
+	packagesFlag                 = flag.Bool("packages", false, "OPTIONAL: backup the inventory of the org's GitHub Packages, every package with its versions, to org__packages/<type>/. Needs the read:packages scope")
+	projectsFlag                 = flag.Bool("projects", false, "OPTIONAL: backup the org's Projects (v2) boards, with their fields, views and items, to org__projects/. Needs a token with the read:project scope")
+	auditLogFlag                 = flag.Bool("audit_log", false, "OPTIONAL: backup the org's audit log to org__audit/. Needs an org owner token on GitHub Enterprise Cloud")
+	etagsFlag                    = flag.Bool("etags", false, "OPTIONAL: remember the ETag of each repo's issue listing in etags.json and skip the repo's issues if they didn't change since the last run. Only useful when reusing the same backup_dir")
+	issueCacheFlag               = flag.Bool("issue_cache", false, "OPTIONAL: remember when each written issue was last updated in issue_cache.json, and on the next run only fetch the comments of, and rewrite, the issues updated since")
+	issuesNewerThanFlag          = flag.String("issues_newer_than", "", "OPTIONAL: only write issues updated within this duration, e.g. 720h or 90d")
+	sinceFlag                    = flag.String("since", "", "OPTIONAL: only backup audit log events created since this date (YYYY-MM-DD or RFC3339)")
+	sshKeyFlag                   = flag.String("ssh_key", "", "OPTIONAL: path to the SSH private key to clone with, instead of the SSH agent's/host's default keys")
+	gitCloneArgsFlag             = flag.String("git_clone_args", defaultGitCloneArgs, "OPTIONAL: arguments passed to 'git clone', before the repo URL and target directory")
+	noSubmodulesFlag             = flag.Bool("no_submodules", false, "OPTIONAL: don't clone submodules, even if -git_clone_args asks for it")
+	streamToTarFlag              = flag.String("stream_to_tar", "", "OPTIONAL: path of a .tar, or .tgz, archive each repo is moved into as soon as it's backed up, so the backup directory never holds the whole org. The manifest is its first entry. Only supports a single org")
+	zipPerRepoFlag               = flag.Bool("zip_per_repo", false, "OPTIONAL: once a repo is backed up, zip all of its artifacts to <name>.zip in backup_dir")
+	archiveCleanupFlag           = flag.Bool("archive_cleanup", false, "OPTIONAL: with -zip_per_repo, remove a repo's directories once they're zipped")
+	smtpHostFlag                 = flag.String("smtp_host", "", "OPTIONAL: 'host:port' of the SMTP server to email a report of the run through when it fails. Port 465 is implicit TLS, others use STARTTLS if offered")
+	smtpUsernameFlag             = flag.String("smtp_username", "", "OPTIONAL: with -smtp_host, the username to authenticate with")
+	smtpPasswordFlag             = flag.String("smtp_password", "", "OPTIONAL: with -smtp_host, the password to authenticate with")
+	smtpFromFlag                 = flag.String("smtp_from", "", "OPTIONAL: with -smtp_host, the sender of the report")
+	smtpToFlag                   = flag.String("smtp_to", "", "OPTIONAL: with -smtp_host, the recipients of the report, comma-separated")
+	emailOnSuccessFlag           = flag.Bool("email_on_success", false, "OPTIONAL: with -smtp_host, email the report when the run succeeds too")
+	postRepoHookFlag             = flag.String("post_repo_hook", "", "OPTIONAL: command to run after each repo is backed up. It gets the repo's name and the backup directory as its last two arguments")
+	postRepoHookFatalFlag        = flag.Bool("post_repo_hook_fatal", false, "OPTIONAL: fail the repo if -post_repo_hook fails, instead of only logging it")
+	sqlDumpFlag                  = flag.Bool("sql_dump", false, "OPTIONAL: with -format json, also write every repo, issue, comment and label to issues.db in backup_dir, an SQLite database")
+	formatFlag                   = flag.String("format", formatMarkdown, "OPTIONAL: format issues are written in. One of: md, json, csv, tsv. csv and tsv write a single table of each repo's issues, one row per issue, to issues.csv (or issues.tsv) in its issues directory, and of the org's to backup_dir")
+	flattenCommentsFlag          = flag.Bool("flatten_comments", false, "OPTIONAL: with -format json, write each issue as a chronological JSON array of entries (the issue's body, then its comments and timeline events) to <number>.entries.json instead. Costs at least one API call per issue")
+	safeModeFlag                 = flag.Bool("safe_mode", false, "OPTIONAL: refuse to write anything that resolves to outside of the backup directory, e.g. because of a '..' in a name coming from the API or a symlink")
+	runLogsKeepFlag              = flag.Int("run_logs_keep", 10, "OPTIONAL: how many previous run.log files to keep in the backup directory, as run.log.1, run.log.2 and so on")
+	preflightFlag                = flag.Bool("preflight", false, "OPTIONAL: before backing anything up, check backup_dir is writable, git is installed and recent enough, and SSH authentication works if repos are cloned over SSH. All failures are reported at once")
+	checkFlag                    = flag.Bool("check", false, "OPTIONAL: only check the token works and the org exists, print the repo count and rate limit status, then exit")
+	deadlineFlag                 = flag.String("deadline", "", "OPTIONAL: stop the run once it's been running for this long, e.g. 6h. In-flight repos are cancelled, checkpoint.json lists what's left and the exit code is 3")
+	concurrencyFlag              = flag.Int("concurrency", 1, "OPTIONAL: how many repos to backup at the same time. With -concurrency_auto, the most it ramps up to (default 8 then)")
+	concurrencyAutoFlag          = flag.Bool("concurrency_auto", false, "OPTIONAL: start with one worker and add or remove workers depending on how much of the GitHub rate limit is left")
+	normalizeMarkdownFlag        = flag.Bool("normalize_markdown", false, "OPTIONAL: rewrite GitHub-only Markdown in issue, PR and comment bodies for other tools: task list checkboxes become (todo) and (done), @mentions are put in code spans so they don't notify anyone if uploaded again, and suggestion blocks become plain code blocks")
+	stripHTMLCommentsFlag        = flag.Bool("strip_html_comments", false, "OPTIONAL: with -normalize_markdown, also remove HTML comments, e.g. the leftovers of issue templates")
+	maxCommentBytesFlag          = flag.Int("max_comment_bytes", 0, "OPTIONAL: truncate any issue, PR or comment body longer than this many bytes, with a [truncated N bytes] marker, e.g. for bots pasting whole CI logs. 0 doesn't truncate")
+	truncatedSidecarsFlag        = flag.Bool("truncated_sidecars", false, "OPTIONAL: with -max_comment_bytes, write the full text of each truncated body next to its issue, as <number>.body.full.md or <number>.comment_<n>.full.md")
+	bomFlag                      = flag.Bool("bom", false, "OPTIONAL: start every written Markdown, JSON and CSV file with a UTF-8 byte order mark, for Windows tools that need one")
+	planOutFlag                  = flag.String("plan_out", "", "OPTIONAL: write the repos a backup would target, after filters, to this plan file, then exit. Execute it later with -plan_in")
+	planInFlag                   = flag.String("plan_in", "", "OPTIONAL: backup the repos of this plan file, written by -plan_out, instead of listing and filtering the org's repos")
+	diffFlag                     = flag.String("diff", "", "OPTIONAL: path to an existing backup directory of the org. If supplied, only print which repos were added, removed or renamed in the org since that backup, after filters, then exit")
+	listFlag                     = flag.Bool("list", false, "OPTIONAL: only print the full name of every repo a backup would target, after filters, one per line, then exit")
+	jsonFlag                     = flag.Bool("json", false, "OPTIONAL: with -list, print the repos as a JSON array instead. With -diff, print the changes as a JSON object")
+	redactUsersFlag              = flag.String("redact_users", "", "OPTIONAL: path to an existing backup directory. If supplied, a copy of it with every login, email and commit author replaced by a stable pseudonym is written to -redact_users_out, and nothing is backed up. Rewrites history")
+	redactUsersOutFlag           = flag.String("redact_users_out", "", "OPTIONAL: with -redact_users, directory the redacted copy is written to. It must not exist")
+	redactUsersMapFlag           = flag.String("redact_users_map", "", "OPTIONAL: with -redact_users, file recording who each pseudonym stands for, readable by its owner only. If it exists, its pseudonyms are reused. Keep it out of what's shared")
+	rewriteEmailsFlag            = flag.String("rewrite_emails", "", "OPTIONAL: path to an existing backup directory. If supplied, a copy of its mirrors with the author, committer and tagger emails of -email_map rewritten is written to -rewrite_emails_out, and nothing is backed up. Rewrites history")
+	emailMapFlag                 = flag.String("email_map", "", "OPTIONAL: with -rewrite_emails, file of '<old email> <new email>' or '@<old domain> @<new domain>' lines")
+	rewriteEmailsOutFlag         = flag.String("rewrite_emails_out", "", "OPTIONAL: with -rewrite_emails, directory the rewritten mirrors are written to, as <name>.git")
+	gpgSignManifestFlag          = flag.String("gpg_sign_manifest", "", "OPTIONAL: GPG key ID or email to sign the backup with, for tamper evidence: the SHA-256 of every file is written to SHA256SUMS, and it and manifest.json get detached signatures, SHA256SUMS.asc and manifest.json.asc")
+	verifySignatureFlag          = flag.String("verify_signature", "", "OPTIONAL: path to an existing backup directory signed with -gpg_sign_manifest. If supplied, its signatures are checked against -gpg_public_key, then its files against SHA256SUMS, and nothing is backed up")
+	gpgPublicKeyFlag             = flag.String("gpg_public_key", "", "OPTIONAL: with -verify_signature, the public key file the backup must be signed by")
+	validateFlag                 = flag.String("validate", "", "OPTIONAL: path to an existing backup directory. If supplied, its JSON files are validated against the export schema and nothing is backed up")
 )
 
-func getGitClient(token string) (*github.Client, context.Context, error) {
-	if len(token) == 0 {
-		return nil, nil, print.Errorf("nil access token")
+// sshKeyPath is the absolute path of -ssh_key, or empty to use the default
+// SSH identities
+var sshKeyPath string
+
+// cloneTokenSource provides the token repos are cloned over HTTPS with. It's
+// nil to clone over SSH
+var cloneTokenSource oauth2.TokenSource
+
+// hostLimits caps the repos backed up at once per clone host, with
+// -concurrency_per_host. Hosts without a limit aren't capped by it
+var hostLimits *hostConcurrency
+
+// orgCaches are the caches of an org's backup directory that let issues
+// that didn't change be skipped
+type orgCaches struct {
+	// etags caches the validators of the issue listings with -etags. It's
+	// nil otherwise
+	etags *etagCache
+	// updates caches when every written issue was last updated with
+	// -issue_cache. It's nil otherwise
+	updates *issueCache
+}
+
+// issuesCutoff is the time issues must have been updated after to be
+// written, from -issues_newer_than. It's zero to write every issue
+var issuesCutoff time.Time
+
+// runStartedAt is the time this run started. It's used to timestamp the
+// backup directory and everything written into it
+var runStartedAt time.Time
+
+// getGitClient returns a GitHub client authenticated with the tokens of 'ts'. If
+// 'observe' isn't nil, it's called with every API response
+func getGitClient(ts oauth2.TokenSource, userAgent string,
+	observe func(resp *http.Response)) (*github.Client, context.Context, error) {
+	if ts == nil {
+		return nil, nil, print.Errorf("nil token source")
 	}
 	ctx := context.Background()
-	client := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)))
+	httpClient := oauth2.NewClient(ctx, ts)
+	if observe != nil {
+		httpClient.Transport = &observingTransport{base: httpClient.Transport, observe: observe}
+	}
+	client := github.NewClient(httpClient)
+	if len(userAgent) != 0 {
+		client.UserAgent = userAgent
+	}
 	return client, ctx, nil
 }
 
 // cloneRepo uses 'client' and 'ctx' to mirror clone a 'repo'
 func cloneRepo(client *github.Client, ctx context.Context,
-	backupDirPath string, repo *github.Repository) error {
+	backupDirPath string, repo *github.Repository) (repoResult, error) {
 	print.DebugFunc()
 
-	targetDir := filepath.Join(backupDirPath, fmt.Sprintf("%s.git", *repo.Name))
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
 	print.Debugf("Cloning %s to %s...\n", *repo.SSHURL, targetDir)
+	exists := util.IsDirectory(targetDir)
 	// Skip repo if already exists
-	if !*forceUpdateExistingReposFlag && util.IsDirectory(targetDir) {
+	if exists && !*updateMirrorsFlag && !*forceUpdateExistingReposFlag {
 		print.Debugf("Skipping existing repo at %s\n", targetDir)
-		return nil
+		return repoResult{}, nil
 	}
-	_, _, _, err := util.Exec("", "git clone --mirror --recurse-submodules -j8 %s %s",
-		*repo.SSHURL, targetDir)
+	url := *repo.SSHURL
+	env := gitSSHEnv(sshKeyPath)
+	if cloneTokenSource != nil {
+		token, err := cloneTokenSource.Token()
+		if err != nil {
+			return repoResult{}, err
+		}
+		url = repo.GetCloneURL()
+		env = gitHTTPSAuthEnv(token.AccessToken)
+	}
+	started := time.Now()
+	if exists && *updateMirrorsFlag {
+		sizeBefore, err := dirSize(targetDir)
+		if err != nil {
+			return repoResult{}, err
+		}
+		err = updateMirror(ctx, backupDirPath, repo, env)
+		if err != nil {
+			return repoResult{}, err
+		}
+		size, err := dirSize(targetDir)
+		if err != nil {
+			return repoResult{}, err
+		}
+		return repoResult{BytesCloned: max(size-sizeBefore, 0), Duration: time.Since(started)}, nil
+	}
+	args := append([]string{"clone"}, gitCloneArgs...)
+	args = append(args, url, targetDir)
+	_, err := runCommand(ctx, "", env, "git", args...)
 	if err != nil {
-		return err
+		return repoResult{}, err
 	}
-	return nil
+	size, err := dirSize(targetDir)
+	if err != nil {
+		return repoResult{}, err
+	}
+	return repoResult{BytesCloned: size, Duration: time.Since(started)}, nil
 }
 
-// backupRepoIssuesAndPRs uses 'client' and 'ctx' to loop over issues in 'repo'
-// and write them to a file
+// isEmptyIssue returns true if 'issue' is an issue, not a PR, with a blank
+// body and no comments.
+//
+// XXX This goes by the comment count of the issue listing, so skipping an
+// issue doesn't cost a comment call
+func isEmptyIssue(issue *github.Issue) bool {
+	return !issue.IsPullRequest() && len(strings.TrimSpace(issue.GetBody())) == 0 &&
+		issue.GetComments() == 0
+}
+
+// backupRepoIssuesAndPRs uses 'p' and 'ctx' to loop over issues in 'repo'
+// and write them to a file. 'client' is only used for GitHub-specific details
+// and is nil for other providers. If 'attachments' isn't nil, attachments are
+// downloaded to it and linked from the written issues. 'caches' are the
+// org's, to skip what didn't change. The listed issues are
+// returned so other steps can reuse them. With -etags, nil is returned
+// instead if the issues didn't change since the last run and were skipped.
 //
 // XXX An "issue" is basically a "pull request" in GitHub's API. This function
 // iterates over all issues which will effectively give you all issues+PRs.
 // That being said, this function **won't** tell you which branch a PR is
 // merging. I don't think that's a very important detail for a backup.
 //
-// XXX This function **disregards** attachments: if there's an attachment,
-// you'll just see the GH link, but it won't explicitly download it.
-func backupRepoIssuesAndPRs(client *github.Client, ctx context.Context,
-	backupDirPath string, repo *github.Repository) error {
+// XXX Without 'attachments', this function **disregards** attachments: if
+// there's an attachment, you'll just see the GH link, but it won't explicitly
+// download it.
+func backupRepoIssuesAndPRs(p provider, client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository, attachments *attachmentStore,
+	caches *orgCaches) ([]*github.Issue, repoResult, error) {
 	print.DebugFunc()
 
-	targetDir := filepath.Join(backupDirPath, fmt.Sprintf("%s__issues", *repo.Name))
+	started := time.Now()
+	var result repoResult
+	finish := func() repoResult {
+		result.Duration = time.Since(started)
+		return result
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactIssues)
 	// if !*forceUpdateExistingReposFlag && util.IsDirectory(targetDir) {
 	// 	print.Debugf("Skipping existing issues repo at %s\n", targetDir)
-	// 	return nil
+	// 	return nil, nil
 	// }
-	var allIssues []*github.Issue
-	opts := &github.IssueListByRepoOptions{
-		State:       "all",
-		ListOptions: github.ListOptions{PerPage: 100000},
-	}
-	pageCount := 0
-	for {
-		print.Debugf("Fetching issues on page %d (total fetched: %d)...\n", pageCount, len(allIssues))
-		issues, resp, err := client.Issues.ListByRepo(ctx,
-			*repo.Owner.Login, *repo.Name, opts)
+	var validators etagValidators
+	if caches.etags != nil && client != nil {
+		changed, v, err := checkIssuesChanged(client, ctx, repo, caches.etags)
 		if err != nil {
-			return err
+			return nil, repoResult{}, err
 		}
-		allIssues = append(allIssues, issues...)
-		if resp.NextPage == 0 {
-			break
+		if !changed && util.IsDirectory(targetDir) {
+			print.Infof("Issues of %s didn't change since the last run: skipping them\n", *repo.Name)
+			if isTableFormat(issueFormat()) {
+				err = appendExistingIssueTable(backupDirPath, targetDir, repo)
+				if err != nil {
+					return nil, repoResult{}, err
+				}
+			}
+			return nil, finish(), nil
+		}
+		validators = v
+		if !changed {
+			validators = caches.etags.get(issuesETagKey(repo))
+		}
+	}
+	allIssues, err := p.ListIssues(ctx, repo)
+	if err != nil {
+		return nil, repoResult{}, err
+	}
+	if allIssues == nil {
+		allIssues = []*github.Issue{}
+	}
+	// storeETag is called once the issues are backed up
+	storeETag := func() {
+		if caches.etags != nil && client != nil {
+			caches.etags.set(issuesETagKey(repo), validators)
 		}
-		opts.Page = resp.NextPage
-		pageCount++
 	}
 	print.Debugf("Backing up %d issues for repo %s to %s\n", len(allIssues), *repo.Name, targetDir)
 	os.MkdirAll(targetDir, os.ModePerm)
+	// XXX -issues_newer_than is applied to already fetched issues: skipped
+	// issues cost no comment calls but are still listed
+	var subIssues *subIssueIndex
+	titles := map[int]string{}
+	if *subIssuesFlag {
+		if client != nil {
+			subIssues, err = fetchSubIssues(client, ctx, repo, allIssues)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		for _, issue := range allIssues {
+			titles[issue.GetNumber()] = issue.GetTitle()
+		}
+	}
+	// With -format csv or tsv, the rows of the issue table. Issues are only
+	// listed then: nothing is fetched per issue
+	var table [][]string
+	if isTableFormat(issueFormat()) {
+		table = [][]string{}
+	}
+	skippedCount := 0
+	emptyCount := 0
+	unchangedCount := 0
+	defer func() {
+		if unchangedCount != 0 {
+			print.Infof("Skipped %d issues of %s that didn't change since the last run\n",
+				unchangedCount, *repo.Name)
+		}
+		if skippedCount != 0 {
+			print.Infof("Skipped %d issues of %s not updated since %s\n",
+				skippedCount, *repo.Name, issuesCutoff.Format(time.RFC3339))
+		}
+		if emptyCount != 0 {
+			print.Infof("Skipped %d issues of %s with no body and no comments\n",
+				emptyCount, *repo.Name)
+		}
+	}()
 	for _, issue := range allIssues {
-		// XXX I think 6 digits is a pretty decent limit
-		issueFilePath := filepath.Join(targetDir, fmt.Sprintf("%06d.md", *issue.Number))
-		if !*forceUpdateExistingReposFlag && util.IsFile(issueFilePath) {
+		if !issuesCutoff.IsZero() && issue.GetUpdatedAt().Time.Before(issuesCutoff) {
+			skippedCount++
+			continue
+		}
+		if *skipEmptyIssuesFlag && isEmptyIssue(issue) {
+			emptyCount++
+			continue
+		}
+		if table != nil {
+			table = append(table, issueTableRow(issue))
+			result.IssueCount++
+			result.CommentCount += issue.GetComments()
+			progress.addIssue(issue.GetComments())
+			continue
+		}
+		issueFilePath := filepath.Join(targetDir, issueFileName(*issue.Number, issue.IsPullRequest(), issueFormat()))
+		// XXX With -issue_cache, an existing issue is only skipped, without
+		// fetching its comments, if it wasn't updated since it was written.
+		// The other issues still get written
+		if caches.updates != nil {
+			if !*forceUpdateExistingReposFlag && util.IsFile(issueFilePath) &&
+				caches.updates.unchanged(repo, issue) {
+				unchangedCount++
+				continue
+			}
+		} else if !*forceUpdateExistingReposFlag && util.IsFile(issueFilePath) {
 			print.Debugf("Skipping existing issue #%d\n", *issue.Number)
-			return nil
+			storeETag()
+			return allIssues, finish(), nil
 		}
 		print.Debugf("Backing up issue #%d to %s\n", *issue.Number, issueFilePath)
-		fd, err := os.Create(issueFilePath)
+		comments, err := p.ListComments(ctx, repo, issue)
 		if err != nil {
-			return err
+			return nil, repoResult{}, err
+		}
+		print.Debugf("Found %d comments for issue #%d\n", len(comments), *issue.Number)
+		result.CommentCount += len(comments)
+		for _, comment := range comments {
+			print.Debugf("Comment by [%s]: at [%v]\n", *comment.User.Login, *comment.CreatedAt)
+		}
+		out := newIssueExport(issue, comments)
+		if *subIssuesFlag {
+			fillIssueHierarchy(out, subIssues, repo, titles)
 		}
-		fd.WriteString(fmt.Sprintf("* Issue #%d: %s\r\n", *issue.Number, *issue.Title))
-		fd.WriteString(fmt.Sprintf("* Created at: %v\r\n", *issue.CreatedAt))
-		fd.WriteString(fmt.Sprintf("* Author: %s\r\n", *issue.User.Login))
-		if issue.Labels != nil {
-			fd.WriteString("* Labels: ")
-			for i, label := range issue.Labels {
-				if i > 0 {
-					fd.WriteString(", ")
+		if *subscribersFlag && client != nil {
+			err = fetchIssueSubscribers(client, ctx, repo, issue, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if *editsFlag && client != nil {
+			err = fetchIssueEdits(client, ctx, repo, issue, comments, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if *duplicatesFlag && client != nil {
+			err = fetchIssueDuplicates(client, ctx, repo, issue, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if *minimizedFlag && client != nil {
+			err = fetchMinimizedComments(client, ctx, repo, issue, comments, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if *reactionsDetailedFlag && client != nil {
+			err = fetchReactionUsers(client, ctx, repo, issue, comments, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if *flattenCommentsFlag && client != nil {
+			err = fetchTimelineEvents(client, ctx, repo, issue, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		if issue.IsPullRequest() {
+			fillPullRequestAssignees(issue, out)
+		}
+		if issue.IsPullRequest() && client != nil {
+			if *requestedReviewersFlag {
+				err = fetchPullRequestReviewers(client, ctx, repo, issue, out)
+				if err != nil {
+					return nil, repoResult{}, err
+				}
+			}
+			if *reviewThreadsFlag {
+				err = fetchReviewThreads(client, ctx, repo, issue, out)
+				if err != nil {
+					return nil, repoResult{}, err
+				}
+			}
+			if *prDetailsFlag {
+				err = fetchPullRequestDetails(client, ctx, repo, issue, out)
+				if err != nil {
+					return nil, repoResult{}, err
+				}
+			}
+			if *prCommitsFlag {
+				err = fetchPullRequestCommitsAndFiles(client, ctx, repo, issue, out)
+				if err != nil {
+					return nil, repoResult{}, err
+				}
+			}
+			if *prDiffsFlag {
+				err = backupPullRequestDiffs(client, ctx, backupDirPath, repo, *issue.Number)
+				if err != nil {
+					return nil, repoResult{}, err
 				}
-				fd.WriteString(*label.Name)
 			}
-			fd.WriteString("\r\n")
 		}
-		if issue.ClosedBy != nil {
-			fd.WriteString(fmt.Sprintf("* Closed at: %s\r\n", *issue.ClosedAt))
-			fd.WriteString(fmt.Sprintf("* Closed by: %s\r\n", *issue.ClosedBy.Login))
+		if *normalizeMarkdownFlag {
+			normalizeIssueMarkdown(out, *stripHTMLCommentsFlag)
 		}
-		fd.WriteString("\r\n")
-		if issue.Body != nil {
-			fd.WriteString("## Description\r\n\r\n")
-			fd.WriteString(fmt.Sprintf("%s\r\n\r\n", *issue.Body))
+		if attachments != nil {
+			attachments.rewriteIssue(ctx, targetDir, out)
 		}
-
-		comments, _, err := client.Issues.ListComments(ctx, *repo.Owner.Login,
-			*repo.Name, *issue.Number, nil)
+		if *maxCommentBytesFlag > 0 {
+			err = truncateIssueBodies(targetDir, out)
+			if err != nil {
+				return nil, repoResult{}, err
+			}
+		}
+		err = writeIssue(issueFilePath, issueFormat(), out)
 		if err != nil {
-			return err
+			return nil, repoResult{}, err
 		}
-		print.Debugf("Found %d comments for issue #%d\n", len(comments), *issue.Number)
-		for i, comment := range comments {
-			print.Debugf("Comment by [%s]: at [%v]\n", *comment.User.Login, *comment.CreatedAt)
+		result.IssueCount++
+		progress.addIssue(len(out.Comments))
+		if caches.updates != nil {
+			caches.updates.set(repo, issue)
+		}
+	}
+	if table != nil {
+		err = writeIssueTable(filepath.Join(targetDir, issueTableFileName(issueFormat())), issueFormat(), table)
+		if err != nil {
+			return nil, repoResult{}, err
+		}
+		err = appendOrgIssueTable(backupDirPath, issueFormat(), repo.GetFullName(), table)
+		if err != nil {
+			return nil, repoResult{}, err
+		}
+	}
+
+	storeETag()
+	return allIssues, finish(), nil
+}
 
-			// XXX Start counting from 1, not 0
-			fd.WriteString(fmt.Sprintf("## Comment #%d\r\n\r\n", i+1))
-			fd.WriteString(fmt.Sprintf("* By %s\r\n", *comment.User.Login))
-			fd.WriteString(fmt.Sprintf("* At %v\r\n", *comment.CreatedAt))
-			fd.WriteString(fmt.Sprintf("%s\r\n\r\n", *comment.Body))
+// backupRepo runs every enabled backup step for 'repo' and returns its
+// metadata. Verification failures are collected in 'summary' instead of
+// aborting the backup
+func backupRepo(p provider, client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository, attachments *attachmentStore,
+	caches *orgCaches, summary *runSummary) (*export.Repo, error) {
+	print.Debugf("working with %s\n", *repo.Name)
+	// XXX Check every directory the repo's artifacts go to before anything is
+	// created: the repo name comes from the API
+	for _, root := range append(repoArtifactRoots(backupDirPath, *repo.Name),
+		repoArtifactPath(backupDirPath, *repo.Name, artifactIssues)) {
+		err := checkWritePath(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	progress.setStep(*repo.Name, "cloning")
+	result, err := cloneRepo(client, ctx, backupDirPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	err = writeRestoreHint(ctx, backupDirPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	err = writeRepoRefs(ctx, backupDirPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	if *exportWorktreeFlag {
+		err = exportWorktree(ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
 		}
-		err = fd.Close()
+	}
+	if *authorsFlag {
+		err = backupRepoAuthors(ctx, backupDirPath, repo)
 		if err != nil {
-			return err
+			return nil, err
+		}
+	}
+	if *verifyFlag {
+		err = verifyRepoMirror(client, ctx, backupDirPath, repo)
+		if err != nil {
+			print.Warnf("Verification of %s failed: %v\n", *repo.Name, err)
+			summary.addVerifyFailure(*repo.Name, err)
+		}
+	}
+	progress.setStep(*repo.Name, "issues")
+	issues, issuesResult, err := backupRepoIssuesAndPRs(p, client, ctx, backupDirPath, repo, attachments, caches)
+	if err != nil {
+		return nil, err
+	}
+	result = result.add(issuesResult)
+	print.Debugf("Backed up %s: cloned %d bytes, wrote %d issues with %d comments in %v\n",
+		*repo.Name, result.BytesCloned, result.IssueCount, result.CommentCount, result.Duration)
+	if issues == nil {
+		print.Debugf("Not updating the assignees, milestones and snapshot of %s: its issues were skipped\n", *repo.Name)
+	} else {
+		err = writeRepoAssignees(backupDirPath, repo, issues)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *milestonesFlag && client != nil && issues != nil {
+		err = backupRepoMilestones(client, ctx, backupDirPath, repo, issues)
+		if err != nil {
+			return nil, err
+		}
+	}
+	progress.setStep(*repo.Name, "metadata")
+	meta, err := backupRepoMeta(client, ctx, backupDirPath, repo)
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		err = backupRepoLabels(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *tagsIndexFlag && client != nil {
+		err = backupRepoTagsIndex(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *subscribersFlag && client != nil {
+		err = backupRepoWatchers(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *releasesFlag && client != nil {
+		err = backupRepoReleases(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *customPropertiesFlag && client != nil {
+		err = backupRepoCustomProperties(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *rulesetsFlag && client != nil {
+		err = backupRepoRulesets(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *securityAlertsFlag && client != nil {
+		err = backupRepoSecurityAlerts(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *brandingFlag && client != nil {
+		err = backupRepoSocialPreview(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *pagesFlag && client != nil {
+		err = backupRepoPages(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *environmentsFlag && client != nil {
+		err = backupRepoEnvironments(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *variablesFlag && client != nil {
+		err = backupRepoVariables(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *invitationsFlag && client != nil {
+		err = backupRepoInvitations(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *deploymentsFlag && client != nil {
+		err = backupRepoDeployments(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *readmeFlag && client != nil {
+		err = backupRepoReadme(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *sbomFlag && client != nil {
+		err = backupRepoSBOM(client, ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *statsCSVFlag {
+		err = appendRepoStatsCSV(backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *snapshotCSVFlag && issues != nil {
+		err = appendRepoSnapshotCSV(backupDirPath, repo, issues)
+		if err != nil {
+			return nil, err
 		}
 	}
+	if *zipPerRepoFlag {
+		err = zipRepo(backupDirPath, *repo.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(*postRepoHookFlag) != 0 {
+		err = runPostRepoHook(ctx, backupDirPath, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	summary.addRepoResult(result)
+	return meta, nil
+}
 
-	return nil
+// parseAge parses a duration like time.ParseDuration does, but also accepts a
+// number of days, e.g. "90d"
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, print.Errorf("invalid number of days: %s", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, print.Errorf("invalid duration %s: %v", value, err)
+	}
+	return d, nil
+}
+
+// parseSince parses the -since flag. An empty value means "since forever" and
+// returns a zero time
+func parseSince(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, print.Errorf("-since %s isn't a YYYY-MM-DD date or an RFC3339 timestamp", value)
 }
 
-func _main() error {
+// _main runs the whole backup, collecting what went wrong without aborting it
+// in 'summary'
+func _main(summary *runSummary) error {
 	print.SetLevel(print.LOG_DEBUG)
+	runStartedAt = time.Now()
 
 	// Parse flags
 	// -----------
 	flag.Parse()
-	if len(*GitAccessTokenFlag) == 0 {
-		return print.Errorf("nil git access token")
+	if *listFlag || len(*diffFlag) != 0 {
+		// XXX Keep stdout for the list only, so it can be piped
+		print.SetLevel(print.LOG_SILENCE)
 	}
-	if len(*OrganizationNameFlag) == 0 {
-		return print.Errorf("nil Organization")
+	if len(*smtpHostFlag) != 0 && (len(*smtpFromFlag) == 0 || len(parseEmailAddresses(*smtpToFlag)) == 0) {
+		return print.Errorf("-smtp_host needs -smtp_from and -smtp_to")
 	}
-	var backupDirPath string
-	// If BackupDirPathFlag is supplied, use it. Else, make one in the root of the project
-	if len(*BackupDirPathFlag) != 0 {
-		backupDirPath = util.ExpandPath(*BackupDirPathFlag)
-	} else {
-		backupDirPath = filepath.Join(projectpath.Root,
-			fmt.Sprintf("backup__%s__%s",
-				// yyMMdd_hhmmss
-				time.Now().Format("060102_150405"),
-				*OrganizationNameFlag),
-		)
-		err := util.SafeDelete(projectpath.Root, backupDirPath)
+	if *emailOnSuccessFlag && len(*smtpHostFlag) == 0 {
+		return print.Errorf("-email_on_success needs -smtp_host")
+	}
+	if *jsonFlag && !*listFlag && len(*diffFlag) == 0 {
+		return print.Errorf("-json needs -list or -diff")
+	}
+	if *listFlag && len(*diffFlag) != 0 {
+		return print.Errorf("-list and -diff are mutually exclusive")
+	}
+	if len(*planOutFlag) != 0 && len(*planInFlag) != 0 {
+		return print.Errorf("-plan_out and -plan_in are mutually exclusive")
+	}
+	if len(*validateFlag) != 0 {
+		return validateBackup(util.ExpandPath(*validateFlag))
+	}
+	if len(*verifySignatureFlag) != 0 {
+		if len(*gpgPublicKeyFlag) == 0 {
+			return print.Errorf("-verify_signature needs -gpg_public_key")
+		}
+		return verifyBackupSignature(context.Background(), util.ExpandPath(*verifySignatureFlag),
+			util.ExpandPath(*gpgPublicKeyFlag))
+	}
+	if len(*rewriteEmailsFlag) != 0 {
+		if len(*emailMapFlag) == 0 || len(*rewriteEmailsOutFlag) == 0 {
+			return print.Errorf("-rewrite_emails needs -email_map and -rewrite_emails_out")
+		}
+		return rewriteBackupEmails(context.Background(), util.ExpandPath(*rewriteEmailsFlag),
+			util.ExpandPath(*emailMapFlag), util.ExpandPath(*rewriteEmailsOutFlag))
+	}
+	if len(*redactUsersFlag) != 0 {
+		if len(*redactUsersOutFlag) == 0 || len(*redactUsersMapFlag) == 0 {
+			return print.Errorf("-redact_users needs -redact_users_out and -redact_users_map")
+		}
+		return redactBackup(context.Background(), util.ExpandPath(*redactUsersFlag),
+			util.ExpandPath(*redactUsersMapFlag), util.ExpandPath(*redactUsersOutFlag))
+	}
+	if *formatFlag != formatMarkdown && *formatFlag != formatJSON && !isTableFormat(*formatFlag) {
+		return print.Errorf("unknown -format %s", *formatFlag)
+	}
+	if *flattenCommentsFlag && *formatFlag != formatJSON {
+		return print.Errorf("-flatten_comments needs -format json")
+	}
+	if *sqlDumpFlag && issueFormat() != formatJSON {
+		return print.Errorf("-sql_dump needs -format json, without -flatten_comments: it's made from the JSON issues")
+	}
+	if !isValidLayout(*layoutFlag) {
+		return print.Errorf("unknown -layout %s", *layoutFlag)
+	}
+	outputEncoder = utf8Encoder{bom: *bomFlag}
+	if *maxCommentBytesFlag < 0 {
+		return print.Errorf("-max_comment_bytes can't be negative")
+	}
+	if *truncatedSidecarsFlag && *maxCommentBytesFlag == 0 {
+		return print.Errorf("-truncated_sidecars needs -max_comment_bytes")
+	}
+	if *stripHTMLCommentsFlag && !*normalizeMarkdownFlag {
+		return print.Errorf("-strip_html_comments needs -normalize_markdown")
+	}
+	if *readmeHTMLFlag && !*readmeFlag {
+		return print.Errorf("-readme_html needs -readme")
+	}
+	if *archiveCleanupFlag && !*zipPerRepoFlag {
+		return print.Errorf("-archive_cleanup needs -zip_per_repo")
+	}
+	if *archiveCleanupFlag && *metaGitFlag {
+		return print.Errorf("-archive_cleanup can't be used with -meta_git: the meta directories would be gone by the time they're committed")
+	}
+	if len(*streamToTarFlag) != 0 {
+		// XXX These read repos back from the backup directory, or expect them
+		// to still be there on the next run, but they're streamed away
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"sql_dump", *sqlDumpFlag},
+			{"meta_git", *metaGitFlag},
+			{"size_report", *sizeReportFlag},
+			{"zip_per_repo", *zipPerRepoFlag},
+			{"update_mirrors", *updateMirrorsFlag},
+			{"issue_cache", *issueCacheFlag},
+			{"etags", *etagsFlag},
+			{"gpg_sign_manifest", len(*gpgSignManifestFlag) != 0},
+		} {
+			if f.set {
+				return print.Errorf("-stream_to_tar can't be used with -%s: repos are gone from the backup directory once they're streamed", f.name)
+			}
+		}
+	}
+	var err error
+	gitCloneArgs, err = parseGitCloneArgs(*gitCloneArgsFlag)
+	if err != nil {
+		return err
+	}
+	if *noSubmodulesFlag {
+		gitCloneArgs = withoutSubmodules(gitCloneArgs)
+	}
+	if len(*sshKeyFlag) != 0 {
+		sshKeyPath, err = filepath.Abs(util.ExpandPath(*sshKeyFlag))
+		if err != nil {
+			return err
+		}
+		if !util.IsFile(sshKeyPath) {
+			return print.Errorf("-ssh_key %s isn't a file", sshKeyPath)
+		}
+	}
+	since, err := parseSince(*sinceFlag)
+	if err != nil {
+		return err
+	}
+	if len(*issuesNewerThanFlag) != 0 {
+		maxAge, err := parseAge(*issuesNewerThanFlag)
 		if err != nil {
 			return err
 		}
+		issuesCutoff = runStartedAt.Add(-maxAge)
+	}
+	if *githubAppFlag {
+		if *providerFlag != providerGitHub {
+			return print.Errorf("-github_app is only supported with -provider github")
+		}
+		if *githubAppIDFlag == 0 || *githubAppInstallationIDFlag == 0 || len(*githubAppPrivateKeyFlag) == 0 {
+			return print.Errorf("-github_app needs -github_app_id, -github_app_installation_id and -github_app_private_key")
+		}
+		if len(sshKeyPath) != 0 {
+			return print.Errorf("-ssh_key can't be used with -github_app: repos are cloned over HTTPS with the installation token")
+		}
+	} else if *oauthDeviceFlowFlag && len(*GitAccessTokenFlag) == 0 {
+		if *providerFlag != providerGitHub {
+			return print.Errorf("-oauth_device_flow is only supported with -provider github")
+		}
+		if len(*oauthClientIDFlag) == 0 {
+			return print.Errorf("-oauth_device_flow needs -oauth_client_id")
+		}
+	} else if len(*GitAccessTokenFlag) == 0 {
+		return print.Errorf("nil git access token")
+	}
+	// XXX Before any run log is started, in case something prints it
+	registerRunLogSecret(*GitAccessTokenFlag)
+	orgs := parseOrgNames(*OrganizationNameFlag)
+	if len(orgs) == 0 {
+		return print.Errorf("nil Organization")
+	}
+	if len(orgs) > 1 && (len(*planOutFlag) != 0 || len(*planInFlag) != 0) {
+		return print.Errorf("-plan_out and -plan_in only support a single org")
+	}
+	if len(orgs) > 1 && len(*diffFlag) != 0 {
+		return print.Errorf("-diff only supports a single org")
+	}
+	if len(orgs) > 1 && len(*streamToTarFlag) != 0 {
+		return print.Errorf("-stream_to_tar only supports a single org")
+	}
+	repoFilters, err := newRepoFilterChain()
+	if err != nil {
+		return err
 	}
-	print.Debugf("git_access_token: %+v, target_organization_name: %+v, backupDirPath: %+v\n",
-		*GitAccessTokenFlag, *OrganizationNameFlag, backupDirPath)
 
 	// Get Git client
 	// -----------
-	print.Debugf("Backing up %s organization to %s...\n",
-		*OrganizationNameFlag, backupDirPath)
-	client, ctx, err := getGitClient(*GitAccessTokenFlag)
+	if *concurrencyFlag < 1 {
+		return print.Errorf("-concurrency must be at least 1")
+	}
+	if *orgConcurrencyFlag < 1 {
+		return print.Errorf("-org_concurrency must be at least 1")
+	}
+	if *orgConcurrencyFlag > 1 && (*listFlag || *tuiFlag) {
+		return print.Errorf("-org_concurrency can't be used with -list or -tui")
+	}
+	if *runLogsKeepFlag < 0 {
+		return print.Errorf("-run_logs_keep can't be negative")
+	}
+	maxWorkers := *concurrencyFlag
+	if *concurrencyAutoFlag && !isFlagSet("concurrency") {
+		maxWorkers = defaultConcurrencyAutoMax
+	}
+	controller := newConcurrencyController(maxWorkers, *concurrencyAutoFlag)
+	hostLimits, err = parseHostConcurrency(*concurrencyPerHostFlag)
 	if err != nil {
 		return err
 	}
+	if *tuiFlag {
+		if isTerminal(os.Stdout) {
+			progress = newProgressTracker()
+		} else {
+			print.Warnf("-tui: stdout isn't a terminal: logging instead\n")
+		}
+	}
+	var p provider
+	var client *github.Client
+	var ctx context.Context
+	switch *providerFlag {
+	case providerGitHub:
+		var ts oauth2.TokenSource
+		if *githubAppFlag {
+			ts, err = newAppTokenSource(*githubAppIDFlag, *githubAppInstallationIDFlag,
+				util.ExpandPath(*githubAppPrivateKeyFlag), *userAgentFlag)
+			if err != nil {
+				return err
+			}
+			cloneTokenSource = ts
+		} else {
+			token := *GitAccessTokenFlag
+			// XXX An explicit token always wins over the device flow
+			if len(token) == 0 && *oauthDeviceFlowFlag {
+				cachePath := ""
+				if len(*oauthTokenCacheFlag) != 0 {
+					cachePath = util.ExpandPath(*oauthTokenCacheFlag)
+				}
+				token, err = deviceFlowToken(context.Background(), *oauthClientIDFlag, *oauthScopesFlag,
+					cachePath, *userAgentFlag)
+				if err != nil {
+					return err
+				}
+				registerRunLogSecret(token)
+			}
+			ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		}
+		client, ctx, err = getGitClient(ts, *userAgentFlag, func(resp *http.Response) {
+			controller.observe(resp)
+			progress.observe(resp)
+		})
+		if err != nil {
+			return err
+		}
+		p = &githubProvider{client: client}
+	case providerGitea:
+		ctx = context.Background()
+		p, err = newGiteaProvider(*giteaURLFlag, *GitAccessTokenFlag, *userAgentFlag)
+		if err != nil {
+			return err
+		}
+	case providerGitLab:
+		ctx = context.Background()
+		p, err = newGitLabProvider(*gitlabURLFlag, *GitAccessTokenFlag, *userAgentFlag)
+		if err != nil {
+			return err
+		}
+		// XXX GitLab takes the token as the password of any user over HTTPS
+		if len(sshKeyPath) == 0 {
+			cloneTokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *GitAccessTokenFlag})
+		}
+	default:
+		return print.Errorf("unknown -provider %s", *providerFlag)
+	}
+
+	if len(*deadlineFlag) != 0 {
+		d, err := parseAge(*deadlineFlag)
+		if err != nil {
+			return err
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, runStartedAt.Add(d))
+		defer cancel()
+	}
+
+	if *checkFlag {
+		if client == nil {
+			return print.Errorf("-check is only supported with -provider github")
+		}
+		for _, org := range orgs {
+			err = runHealthCheck(client, ctx, org)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if *preflightFlag {
+		err = runPreflight(ctx, backupRootPath())
+		if err != nil {
+			return err
+		}
+	}
 
 	// List Org repos and start the backup process
 	// -----------
-	var allRepos []*github.Repository
-	opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
-	pageCount := 0
-	for {
-		print.Debugf("Fetching repos on page %d (total fetched %d)...\n", pageCount, len(allRepos))
-		repos, resp, err := client.Repositories.ListByOrg(ctx, *OrganizationNameFlag, opts)
+	// XXX Keep stdout for the list only, so it can be piped
+	if !*listFlag && len(*diffFlag) == 0 {
+		defer summary.print()
+	}
+	var listedRepos []*github.Repository
+	// backupOrgByName lists the repos of 'org' and backs them up. It's called
+	// from several goroutines with -org_concurrency, so it only touches what
+	// backupOrg does
+	backupOrgByName := func(org string) error {
+		var allRepos []*github.Repository
+		var err error
+		if len(*planInFlag) != 0 {
+			allRepos, err = readPlan(util.ExpandPath(*planInFlag), org)
+		} else {
+			allRepos, err = p.ListRepos(ctx, org)
+			allRepos = filterRepos(allRepos, repoFilters)
+		}
+		if err != nil {
+			// XXX In a multi-org run, an org the token can't see shouldn't
+			// stop the others from being backed up
+			if len(orgs) > 1 && !*strictFlag && !*failFastFlag && isAccessDenied(err) {
+				print.Warnf("Skipping org %s: %v\n", org, err)
+				summary.addSkippedOrg(org, err)
+				return nil
+			}
+			return err
+		}
+		if *listFlag {
+			listedRepos = append(listedRepos, allRepos...)
+			return nil
+		}
+		if len(*diffFlag) != 0 {
+			diff, err := diffBackup(client, ctx, util.ExpandPath(*diffFlag), org, allRepos)
+			if err != nil {
+				return err
+			}
+			return printBackupDiff(diff)
+		}
+		if len(*planOutFlag) != 0 {
+			return writePlan(util.ExpandPath(*planOutFlag), org, allRepos)
+		}
+		backupDirPath, err := resolveBackupDirPath(org, len(orgs) > 1)
+		if err != nil {
+			return err
+		}
+		summary.addOrg(org, backupDirPath)
+		return backupOrg(p, client, ctx, controller, backupDirPath, org, len(orgs) > 1,
+			allRepos, since, summary)
+	}
+	if *orgConcurrencyFlag > 1 {
+		// XXX Every org's repos still go through 'controller', so the cap
+		// on repos backed up at once, and its tuning from the rate limit,
+		// is shared by all orgs: they use the same token
+		err = startRunLog(backupRootPath(), *runLogsKeepFlag)
+		if err != nil {
+			return err
+		}
+		if *safeModeFlag {
+			err = enableSafeMode(backupRootPath())
+			if err != nil {
+				return err
+			}
+		}
+		err = runConcurrently(ctx, newConcurrencyController(*orgConcurrencyFlag, false), len(orgs),
+			func(i int) error {
+				return backupOrgByName(orgs[i])
+			})
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, org := range orgs {
+			err = backupOrgByName(org)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if *listFlag {
+		return printRepoList(listedRepos)
+	}
+	if n := summary.repoFailureCount(); n != 0 {
+		return print.Errorf("%d repos failed to back up", n)
+	}
+	return nil
+}
+
+// parseOrgNames returns the comma-separated org names of 'value'
+func parseOrgNames(value string) []string {
+	var orgs []string
+	for _, org := range strings.Split(value, ",") {
+		org = strings.TrimSpace(org)
+		if len(org) != 0 {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// backupRootPath returns the directory every org's backup directory is
+// created in: -backup_dir if supplied, else the root of the project
+func backupRootPath() string {
+	if len(*BackupDirPathFlag) != 0 {
+		return util.ExpandPath(*BackupDirPathFlag)
+	}
+	return projectpath.Root
+}
+
+// resolveBackupDirPath returns the backup directory of 'org', according to
+// -backup_dir and -dir_template, and deletes a previous backup there when it's
+// in the root of the project. With 'multiOrg', a -backup_dir used as-is gets a
+// subdirectory per org, so orgs don't overwrite each other's manifest
+func resolveBackupDirPath(org string, multiOrg bool) (string, error) {
+	var backupDirPath string
+	// If BackupDirPathFlag is supplied, use it as-is, unless a -dir_template
+	// was explicitly asked for. Else, make one in the root of the project
+	if len(*BackupDirPathFlag) != 0 && !isFlagSet("dir_template") {
+		backupDirPath = util.ExpandPath(*BackupDirPathFlag)
+		if multiOrg {
+			backupDirPath = filepath.Join(backupDirPath, org)
+		}
+	} else {
+		dirName, err := expandDirTemplate(*dirTemplateFlag, newDirTemplateVars(org))
+		if err != nil {
+			return "", err
+		}
+		if len(*BackupDirPathFlag) != 0 {
+			// XXX Don't delete anything here: the template might very well
+			// expand to a previous backup the user wants to update
+			backupDirPath = filepath.Join(util.ExpandPath(*BackupDirPathFlag), dirName)
+		} else {
+			backupDirPath = filepath.Join(projectpath.Root, dirName)
+			err = util.SafeDelete(projectpath.Root, backupDirPath)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	print.Debugf("target_organization_name: %+v, backupDirPath: %+v\n", org, backupDirPath)
+	return backupDirPath, nil
+}
+
+// backupOrg uses 'p' and 'ctx' to backup 'allRepos', the repos of 'org', and
+// the org-level artifacts of 'org' to 'backupDirPath'. 'client' is only used
+// for GitHub-specific details and is nil for other providers. 'multiOrg' is
+// true if 'org' is one of several orgs of the run
+func backupOrg(p provider, client *github.Client, ctx context.Context,
+	controller *concurrencyController, backupDirPath, org string, multiOrg bool,
+	allRepos []*github.Repository, since time.Time, summary *runSummary) error {
+	var err error
+	// XXX With -org_concurrency, orgs are backed up at the same time: the run
+	// log and safe mode cover every org at once, and are started by _main
+	if *orgConcurrencyFlag == 1 {
+		err = startRunLog(backupDirPath, *runLogsKeepFlag)
 		if err != nil {
 			return err
 		}
-		allRepos = append(allRepos, repos...)
-		if resp.NextPage == 0 {
-			break
+		if *safeModeFlag {
+			err = enableSafeMode(backupDirPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	print.Debugf("Backing up %s organization to %s...\n", org, backupDirPath)
+	if *dirFlatIssuesFlag && *layoutFlag == layoutNested {
+		// XXX With both, the 'issues' directory of a repo named "issues" would
+		// also hold every other repo's issues
+		for _, repo := range allRepos {
+			if repo.GetName() == flatIssuesDirName {
+				return print.Errorf("-dir_flat_issues can't be used with -layout nested: the org has a repo named %s", flatIssuesDirName)
+			}
+		}
+	}
+	if *layoutFlag != layoutNested && client != nil && writesOrgArtifacts() {
+		// XXX The org-level artifacts would overwrite the ones of a repo
+		// named "org", e.g. its rulesets.json in 'org__meta'
+		for _, repo := range allRepos {
+			if repo.GetName() == orgArtifactsRepoName {
+				return print.Errorf("the org has a repo named %s, whose artifacts the org-level ones would overwrite: use -layout nested",
+					orgArtifactsRepoName)
+			}
 		}
-		opts.Page = resp.NextPage
-		pageCount++
 	}
 
-	print.Debugf("Cloning %d repos from %s org\n", len(allRepos), *OrganizationNameFlag)
-	for _, repo := range allRepos {
-		print.Debugf("working with %s\n", *repo.Name)
-		err = cloneRepo(client, ctx, backupDirPath, repo)
+	print.Debugf("Cloning %d repos from %s org\n", len(allRepos), org)
+	var attachments *attachmentStore
+	if *dedupeAttachmentsFlag {
+		attachments, err = newAttachmentStore(backupDirPath, http.DefaultClient)
+		if err != nil {
+			return err
+		}
+	}
+	if isTableFormat(issueFormat()) {
+		err = removeOrgIssueTable(backupDirPath, issueFormat())
 		if err != nil {
 			return err
 		}
-		err = backupRepoIssuesAndPRs(client, ctx, backupDirPath, repo)
+	}
+	m := newManifest(org)
+	var stream *tarStream
+	if len(*streamToTarFlag) != 0 {
+		stream, err = openTarStream(util.ExpandPath(*streamToTarFlag))
 		if err != nil {
 			return err
 		}
+		defer stream.abort()
+		// XXX The manifest is only complete once every repo is done, when
+		// it's too late to be the first entry. The first one lists the repos
+		// that are about to be backed up, and the complete one is appended
+		// with the org-level files: extracting the archive keeps the latter
+		planned := newManifest(org)
+		for _, repo := range allRepos {
+			issuesPath, err := filepath.Rel(backupDirPath,
+				repoArtifactPath(backupDirPath, repo.GetName(), artifactIssues))
+			if err != nil {
+				return err
+			}
+			planned.Repos = append(planned.Repos, export.ManifestRepo{ID: repo.GetID(), Name: repo.GetName(),
+				FullName: repo.GetFullName(), IssuesPath: filepath.ToSlash(issuesPath)})
+		}
+		err = stream.addManifest(planned)
+		if err != nil {
+			return err
+		}
+	}
+	caches := &orgCaches{}
+	if *etagsFlag && client != nil {
+		caches.etags, err = loadETagCache(backupDirPath)
+		if err != nil {
+			return err
+		}
+	}
+	if *issueCacheFlag {
+		caches.updates, err = loadIssueCache(backupDirPath)
+		if err != nil {
+			return err
+		}
+	}
+	// Every repo's metadata is kept at its index so the manifest lists them in
+	// the same order regardless of which finished first
+	metas := make([]*export.Repo, len(allRepos))
+	var failed atomic.Int32
+	progress.startOrg(org, len(allRepos))
+	if progress != nil {
+		dashboard := startTUIDashboard(activeRunLog.stdout, progress)
+		defer dashboard.stopTUIDashboard()
+	}
+	hostOf := func(i int) string { return cloneHost(allRepos[i]) }
+	err = runConcurrentlyPerHost(ctx, controller, hostLimits, len(allRepos), hostOf, func(i int) error {
+		progress.setStep(allRepos[i].GetName(), "starting")
+		meta, err := backupRepo(p, client, ctx, backupDirPath, allRepos[i], attachments, caches, summary)
+		progress.finishRepo(allRepos[i].GetName(), err != nil)
+		// XXX A repo that fails doesn't stop the others, unless -fail_fast.
+		// Running out of time isn't a repo failure: it's checkpointed below
+		if err != nil && !*failFastFlag && ctx.Err() == nil {
+			print.Warnf("Failed to back up %s: %v\n", allRepos[i].GetName(), err)
+			summary.addRepoFailure(org, allRepos[i].GetName(), err)
+			failed.Add(1)
+			return nil
+		}
+		metas[i] = meta
+		if err == nil {
+			err = stream.addRepo(backupDirPath, allRepos[i].GetName())
+		}
+		return err
+	})
+	if caches.etags != nil {
+		saveErr := caches.etags.save()
+		if saveErr != nil {
+			return saveErr
+		}
+	}
+	if caches.updates != nil {
+		saveErr := caches.updates.save()
+		if saveErr != nil {
+			return saveErr
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		deadline, _ := ctx.Deadline()
+		print.Warnf("Deadline %v reached: writing checkpoint to %s\n", deadline, backupDirPath)
+		err = writeCheckpoint(backupDirPath, deadline, allRepos, metas)
+		if err != nil {
+			return err
+		}
+		err = stream.finish(backupDirPath)
+		if err != nil {
+			return err
+		}
+		return errDeadlineExceeded
+	}
+	if err != nil {
+		return err
+	}
+	for _, meta := range metas {
+		if meta == nil {
+			continue
+		}
+		issuesPath, err := filepath.Rel(backupDirPath,
+			repoArtifactPath(backupDirPath, meta.Name, artifactIssues))
+		if err != nil {
+			return err
+		}
+		m.AddRepo(meta, filepath.ToSlash(issuesPath))
+	}
+	if attachments != nil {
+		err = attachments.writeIndex()
+		if err != nil {
+			return err
+		}
+	}
+	if *sqlDumpFlag {
+		err = writeSQLDump(backupDirPath, metas)
+		if err != nil {
+			return err
+		}
+	}
+	if *metaGitFlag {
+		err = commitMetaGit(ctx, backupDirPath, m)
+		if err != nil {
+			return err
+		}
+	}
+	if *outsideCollaboratorsFlag && client != nil {
+		err = backupOrgOutsideCollaborators(client, ctx, backupDirPath, org, allRepos)
+		if err != nil {
+			return err
+		}
+	}
+	if *customPropertiesFlag && client != nil {
+		err = backupOrgCustomProperties(client, ctx, backupDirPath, org)
+		if err != nil {
+			return err
+		}
+	}
+	if *rulesetsFlag && client != nil {
+		err = backupOrgRulesets(client, ctx, backupDirPath, org)
+		if err != nil {
+			return err
+		}
+	}
+	if *brandingFlag && client != nil {
+		err = backupOrgAvatar(client, ctx, backupDirPath, org)
+		if err != nil {
+			return err
+		}
+	}
+	if *communityFlag && client != nil {
+		err = backupOrgCommunity(client, ctx, backupDirPath, org, allRepos)
+		if err != nil {
+			return err
+		}
+	}
+	if *projectsFlag && client != nil {
+		err = backupOrgProjects(client, ctx, backupDirPath, org)
+		if err != nil {
+			return err
+		}
+	}
+	if *packagesFlag && client != nil {
+		err = backupOrgPackages(client, ctx, backupDirPath, org)
+		if err != nil {
+			return err
+		}
+	}
+	if *auditLogFlag && client != nil {
+		err = backupOrgAuditLog(client, ctx, backupDirPath, org, since)
+		if err != nil {
+			return err
+		}
+	}
+	if *sizeReportFlag {
+		err = reportDiskUsage(backupDirPath, m)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeManifest(backupDirPath, m)
+	if err != nil {
+		return err
+	}
+	err = writeSchemas(backupDirPath)
+	if err != nil {
+		return err
+	}
+	if len(*gpgSignManifestFlag) != 0 {
+		err = signBackup(ctx, backupDirPath, *gpgSignManifestFlag)
+		if err != nil {
+			return err
+		}
+	}
+	err = stream.finish(backupDirPath)
+	if err != nil {
+		return err
+	}
+	if failed.Load() != 0 {
+		print.Warnf("%d repos of %s failed to back up\n", failed.Load(), org)
+		return nil
+	}
+	if *latestLinkFlag {
+		return updateLatestLink(backupDirPath, org, multiOrg)
 	}
 	return nil
 }
 
 func main() {
-	err := _main()
+	summary := newRunSummary()
+	err := _main(summary)
 	if err != nil {
 		print.Warnln(err)
+	}
+	if !*listFlag && len(*diffFlag) == 0 {
+		mailErr := sendEmailReport(summary, err)
+		if mailErr != nil {
+			print.Warnln(mailErr)
+		}
+	}
+	stopRunLog()
+	if err != nil {
+		if errors.Is(err, errDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+			os.Exit(exitCodeDeadline)
+		}
 		os.Exit(1)
 	}
 }
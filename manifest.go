@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/clone_your_org/export"
+)
+
+const manifestFileName = "manifest.json"
+
+func newManifest(org string) *export.Manifest {
+	return &export.Manifest{
+		Org:           org,
+		Version:       version,
+		SchemaVersion: export.SchemaVersion,
+		CreatedAt:     runStartedAt,
+		Languages:     map[string]int{},
+	}
+}
+
+// writeManifest writes 'm' to the root of 'backupDirPath'
+func writeManifest(backupDirPath string, m *export.Manifest) error {
+	err := os.MkdirAll(backupDirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(backupDirPath, manifestFileName), m)
+}
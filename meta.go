@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	statsCSVFileName    = "stats.csv"
+	snapshotCSVFileName = "snapshot.csv"
+)
+
+// csvMu serializes appends to CSV files when repos are backed up concurrently
+var csvMu sync.Mutex
+
+func newRepoStats(repo *github.Repository) export.RepoStats {
+	return export.RepoStats{
+		Stargazers: repo.GetStargazersCount(),
+		Watchers:   repo.GetWatchersCount(),
+		Forks:      repo.GetForksCount(),
+		OpenIssues: repo.GetOpenIssuesCount(),
+	}
+}
+
+// writeJSONFile marshals 'v' with indentation and writes it to 'path'
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeTextFile(path, b)
+}
+
+// writeStateFile marshals 'v' with indentation and writes it to 'path', like
+// writeJSONFile but without going through 'outputEncoder'.
+//
+// XXX For the files later runs read back (caches, indexes, checkpoints): a
+// -bom would make them unparseable
+func writeStateFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// newRepoSettings returns the merge button settings and enabled features of
+// 'repo'
+func newRepoSettings(repo *github.Repository) *export.RepoSettings {
+	return &export.RepoSettings{
+		AllowMergeCommit:    repo.AllowMergeCommit,
+		AllowSquashMerge:    repo.AllowSquashMerge,
+		AllowRebaseMerge:    repo.AllowRebaseMerge,
+		AllowAutoMerge:      repo.AllowAutoMerge,
+		DeleteBranchOnMerge: repo.DeleteBranchOnMerge,
+		HasIssues:           repo.HasIssues,
+		HasProjects:         repo.HasProjects,
+		HasWiki:             repo.HasWiki,
+		HasDiscussions:      repo.HasDiscussions,
+	}
+}
+
+// fetchRepoSettings uses 'client' and 'ctx' to return the settings of
+// 'repo'.
+//
+// XXX Repo listings leave the merge button settings out: with
+// -merge_settings, the repo is fetched again for them, which costs one API
+// call per repo. They're left out of that too without admin access to the
+// repo. Either way, missing settings are recorded as unknown
+func fetchRepoSettings(client *github.Client, ctx context.Context,
+	repo *github.Repository) (*export.RepoSettings, error) {
+	settings := newRepoSettings(repo)
+	if client == nil || !*mergeSettingsFlag || settings.AllowMergeCommit != nil || settings.AllowSquashMerge != nil ||
+		settings.AllowRebaseMerge != nil {
+		return settings, nil
+	}
+	full, resp, err := client.Repositories.Get(ctx, *repo.Owner.Login, *repo.Name)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping merge settings of %s: %v\n", *repo.Name, err)
+			return settings, nil
+		}
+		return nil, err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+	return newRepoSettings(full), nil
+}
+
+// backupRepoMeta uses 'client' and 'ctx' to write the metadata of 'repo' to
+// its meta directory. The written metadata is returned so the caller can
+// aggregate it across repos.
+//
+// XXX Apart from the languages breakdown and the merge button settings,
+// everything here comes from the repo object we already have. Both are
+// GitHub-only: they're skipped when 'client' is nil
+func backupRepoMeta(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) (*export.Repo, error) {
+	print.DebugFunc()
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	var languages map[string]int
+	if client != nil {
+		languages, _, err = client.Repositories.ListLanguages(ctx,
+			*repo.Owner.Login, *repo.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	settings, err := fetchRepoSettings(client, ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	meta := &export.Repo{
+		ID:          repo.GetID(),
+		Name:        repo.GetName(),
+		FullName:    repo.GetFullName(),
+		Description: repo.GetDescription(),
+		Topics:      repo.Topics,
+		BackedUpAt:  runStartedAt,
+		Stats:       newRepoStats(repo),
+		Languages:   languages,
+		Settings:    settings,
+	}
+	print.Debugf("Backing up metadata for repo %s to %s\n", *repo.Name, targetDir)
+	err = writeJSONFile(filepath.Join(targetDir, "repo.json"), meta)
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// appendCSVRow appends 'row' to the CSV file at 'path'. 'header' is only
+// written if the file is new
+func appendCSVRow(path string, header, row []string) error {
+	csvMu.Lock()
+	defer csvMu.Unlock()
+	isNew := !util.IsFile(path)
+	fd, err := appendTextFile(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(fd)
+	if isNew {
+		w.Write(header)
+	}
+	w.Write(row)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// appendRepoStatsCSV appends a row with the stats of 'repo' to 'stats.csv' in
+// 'backupDirPath'. The header is only written if the file is new.
+//
+// XXX Since every row is timestamped with the run time, pointing multiple runs
+// to the same -backup_dir builds a time series
+func appendRepoStatsCSV(backupDirPath string, repo *github.Repository) error {
+	stats := newRepoStats(repo)
+	return appendCSVRow(filepath.Join(backupDirPath, statsCSVFileName),
+		[]string{"timestamp", "repo", "stargazers", "watchers", "forks", "open_issues"},
+		[]string{
+			runStartedAt.Format(time.RFC3339),
+			repo.GetFullName(),
+			strconv.Itoa(stats.Stargazers),
+			strconv.Itoa(stats.Watchers),
+			strconv.Itoa(stats.Forks),
+			strconv.Itoa(stats.OpenIssues),
+		})
+}
+
+// appendRepoSnapshotCSV appends a row with the open and closed issue counts and
+// the open and merged PR counts of 'repo' to 'snapshot.csv' in
+// 'backupDirPath'. The counts are computed from 'issues', the issues already
+// fetched for the repo.
+//
+// XXX Closed PRs that weren't merged aren't counted in any column
+func appendRepoSnapshotCSV(backupDirPath string, repo *github.Repository, issues []*github.Issue) error {
+	var openIssues, closedIssues, openPRs, mergedPRs int
+	for _, issue := range issues {
+		isOpen := issue.GetState() == "open"
+		switch {
+		case !issue.IsPullRequest() && isOpen:
+			openIssues++
+		case !issue.IsPullRequest():
+			closedIssues++
+		case isOpen:
+			openPRs++
+		case issue.GetPullRequestLinks().MergedAt != nil:
+			mergedPRs++
+		}
+	}
+	return appendCSVRow(filepath.Join(backupDirPath, snapshotCSVFileName),
+		[]string{"timestamp", "repo", "open_issues", "closed_issues", "open_prs", "merged_prs"},
+		[]string{
+			runStartedAt.Format(time.RFC3339),
+			repo.GetFullName(),
+			strconv.Itoa(openIssues),
+			strconv.Itoa(closedIssues),
+			strconv.Itoa(openPRs),
+			strconv.Itoa(mergedPRs),
+		})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+const metaGitDirName = "__meta.git"
+
+// copyFile copies the regular file 'src' to 'dst'
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	err = checkWritePath(dst)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyDir recursively copies the regular files of 'src' to 'dst'
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+// commitMetaGit copies the meta directory of every repo in 'm' to the
+// '__meta.git' working directory in 'backupDirPath' and commits it, so the
+// git history of '__meta.git' shows what changed between runs: new or deleted
+// repos, topic changes, etc.
+//
+// XXX This only builds a history across runs that share the same -backup_dir
+func commitMetaGit(ctx context.Context, backupDirPath string, m *export.Manifest) error {
+	print.DebugFunc()
+
+	metaGitDir := filepath.Join(backupDirPath, metaGitDirName)
+	err := os.MkdirAll(metaGitDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if !util.IsDirectory(filepath.Join(metaGitDir, ".git")) {
+		_, err = runCommand(ctx, metaGitDir, nil, "git", "init", "-q")
+		if err != nil {
+			return err
+		}
+	}
+	// Start from a clean tree so repos that disappeared show up as deleted
+	entries, err := os.ReadDir(metaGitDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(metaGitDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	for _, repo := range m.Repos {
+		metaDir := repoArtifactPath(backupDirPath, repo.Name, artifactMeta)
+		if !util.IsDirectory(metaDir) {
+			continue
+		}
+		err = copyDir(metaDir, filepath.Join(metaGitDir, repo.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = runCommand(ctx, metaGitDir, nil, "git", "add", "-A")
+	if err != nil {
+		return err
+	}
+	status, err := runCommand(ctx, metaGitDir, nil, "git", "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if len(status) == 0 {
+		print.Debugf("No metadata changes since the last run: nothing to commit in %s\n", metaGitDir)
+		return nil
+	}
+	message := fmt.Sprintf("Backup of %s at %s", m.Org, runStartedAt.Format(time.RFC3339))
+	_, err = runCommand(ctx, metaGitDir, nil, "git",
+		"-c", "user.name=clone_your_org", "-c", "user.email=clone_your_org@localhost",
+		"commit", "-q", "-m", message)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Committed metadata changes to %s\n", metaGitDir)
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// milestoneIndexEntry is a single milestone in 'milestones.json'
+type milestoneIndexEntry struct {
+	Number       int        `json:"number"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	State        string     `json:"state"`
+	DueOn        *time.Time `json:"due_on"`
+	OpenIssues   int        `json:"open_issues"`
+	ClosedIssues int        `json:"closed_issues"`
+	// Issues are the numbers of the issues and PRs assigned to the milestone
+	Issues []int `json:"issues"`
+}
+
+// backupRepoMilestones uses 'client' and 'ctx' to write every milestone of
+// 'repo' to 'milestones.json' and 'milestones.md' in its meta directory.
+//
+// XXX The issue numbers of a milestone are computed from 'issues', the issues
+// already fetched for the repo, instead of listing them again per milestone
+func backupRepoMilestones(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository, issues []*github.Issue) error {
+	print.DebugFunc()
+
+	opts := &github.MilestoneListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	milestones, err := paginate(ctx, "milestones", func(page int) ([]*github.Milestone, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return client.Issues.ListMilestones(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	issueNumbers := map[int][]int{}
+	for _, issue := range issues {
+		if issue.Milestone == nil {
+			continue
+		}
+		number := issue.Milestone.GetNumber()
+		issueNumbers[number] = append(issueNumbers[number], issue.GetNumber())
+	}
+	index := []milestoneIndexEntry{}
+	for _, milestone := range milestones {
+		entry := milestoneIndexEntry{
+			Number:       milestone.GetNumber(),
+			Title:        milestone.GetTitle(),
+			Description:  milestone.GetDescription(),
+			State:        milestone.GetState(),
+			OpenIssues:   milestone.GetOpenIssues(),
+			ClosedIssues: milestone.GetClosedIssues(),
+			Issues:       issueNumbers[milestone.GetNumber()],
+		}
+		if milestone.DueOn != nil {
+			entry.DueOn = &milestone.DueOn.Time
+		}
+		if entry.Issues == nil {
+			entry.Issues = []int{}
+		}
+		sort.Ints(entry.Issues)
+		index = append(index, entry)
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d milestones for repo %s to %s\n", len(index), *repo.Name, targetDir)
+	err = writeJSONFile(filepath.Join(targetDir, "milestones.json"), index)
+	if err != nil {
+		return err
+	}
+	issuesDir := repoArtifactPath(backupDirPath, *repo.Name, artifactIssues)
+	return writeMilestonesMarkdown(filepath.Join(targetDir, "milestones.md"), issuesDir, index)
+}
+
+// writeMilestonesMarkdown writes 'index' to 'path', linking every issue to its
+// file in 'issuesDir'
+func writeMilestonesMarkdown(path, issuesDir string, index []milestoneIndexEntry) error {
+	issuesRelDir, err := filepath.Rel(filepath.Dir(path), issuesDir)
+	if err != nil {
+		return err
+	}
+	fd, err := createTextFile(path)
+	if err != nil {
+		return err
+	}
+	for _, milestone := range index {
+		fd.WriteString(fmt.Sprintf("## Milestone #%d: %s\r\n\r\n", milestone.Number, milestone.Title))
+		fd.WriteString(fmt.Sprintf("* State: %s\r\n", milestone.State))
+		if milestone.DueOn != nil {
+			fd.WriteString(fmt.Sprintf("* Due on: %v\r\n", *milestone.DueOn))
+		}
+		fd.WriteString(fmt.Sprintf("* Open issues: %d\r\n", milestone.OpenIssues))
+		fd.WriteString(fmt.Sprintf("* Closed issues: %d\r\n", milestone.ClosedIssues))
+		fd.WriteString("\r\n")
+		if len(milestone.Description) != 0 {
+			fd.WriteString(fmt.Sprintf("%s\r\n\r\n", milestone.Description))
+		}
+		for _, number := range milestone.Issues {
+			link := filepath.ToSlash(filepath.Join(issuesRelDir, issueFileName(number, false, issueFormat())))
+			if isTableFormat(issueFormat()) {
+				link = filepath.ToSlash(filepath.Join(issuesRelDir, issueTableFileName(issueFormat())))
+			}
+			fd.WriteString(fmt.Sprintf("* [#%d](%s)\r\n", number, link))
+		}
+		if len(milestone.Issues) != 0 {
+			fd.WriteString("\r\n")
+		}
+	}
+	return fd.Close()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const issueMinimizedQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue {
+        comments(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { databaseId isMinimized minimizedReason }
+        }
+      }
+      ... on PullRequest {
+        comments(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { databaseId isMinimized minimizedReason }
+        }
+      }
+    }
+  }
+}`
+
+// fetchMinimizedComments uses 'client' and 'ctx' to mark which 'comments' of
+// the issue or PR 'issue' of 'repo' were minimized by a moderator, and why,
+// in 'out'. 'out.Comments' must be in the same order as 'comments'.
+//
+// XXX The REST API doesn't have this, so it's one GraphQL query per issue
+// with comments, plus one per 100 comments
+func fetchMinimizedComments(client *github.Client, ctx context.Context, repo *github.Repository,
+	issue *github.Issue, comments []*github.IssueComment, out *export.Issue) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	reasons := map[int64]string{}
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				IssueOrPullRequest struct {
+					Comments struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							DatabaseID      int64  `json:"databaseId"`
+							IsMinimized     bool   `json:"isMinimized"`
+							MinimizedReason string `json:"minimizedReason"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"issueOrPullRequest"`
+			} `json:"repository"`
+		}
+		err := queryGraphQL(client, ctx, issueMinimizedQuery, map[string]interface{}{
+			"owner":  *repo.Owner.Login,
+			"name":   *repo.Name,
+			"number": *issue.Number,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Debugf("Skipping minimized comments of issue #%d: %v\n", *issue.Number, err)
+				return nil
+			}
+			return err
+		}
+		page := data.Repository.IssueOrPullRequest.Comments
+		for _, node := range page.Nodes {
+			if node.IsMinimized {
+				reasons[node.DatabaseID] = node.MinimizedReason
+			}
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &page.PageInfo.EndCursor
+	}
+	for i, comment := range comments {
+		reason, ok := reasons[comment.GetID()]
+		if !ok || i >= len(out.Comments) {
+			continue
+		}
+		out.Comments[i].IsMinimized = true
+		out.Comments[i].MinimizedReason = reason
+	}
+	return nil
+}
+
+// writeCommentBodyMarkdown writes the body of 'comment' to 'fd'. A minimized
+// comment's body is collapsed, like GitHub shows it
+func writeCommentBodyMarkdown(fd io.StringWriter, comment export.Comment) {
+	if !comment.IsMinimized {
+		fd.WriteString(fmt.Sprintf("%s\r\n\r\n", comment.Body))
+		return
+	}
+	summary := "This comment was minimized"
+	if len(comment.MinimizedReason) != 0 {
+		summary += fmt.Sprintf(" as %s", comment.MinimizedReason)
+	}
+	fd.WriteString(fmt.Sprintf("<details>\r\n<summary>%s</summary>\r\n\r\n", summary))
+	fd.WriteString(fmt.Sprintf("%s\r\n\r\n</details>\r\n\r\n", comment.Body))
+}
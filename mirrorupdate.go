@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const refsDeltaFileName = "refs_delta.json"
+
+// refChange is a branch or tag that moved during a mirror update
+type refChange struct {
+	// Ref is e.g. 'refs/heads/main' or 'refs/tags/v1.0'
+	Ref string `json:"ref"`
+	// Old is empty for created refs, New for deleted ones
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Commits is how many commits 'New' has that 'Old' doesn't. It's only
+	// set for refs that advanced
+	Commits int `json:"commits,omitempty"`
+	// Forced is true if 'Old' isn't an ancestor of 'New': history was
+	// rewritten
+	Forced bool `json:"forced,omitempty"`
+}
+
+// refDelta is what a mirror update changed, as written to
+// 'refs_delta.json'
+type refDelta struct {
+	UpdatedAt time.Time   `json:"updated_at"`
+	Advanced  []refChange `json:"advanced"`
+	Created   []refChange `json:"created"`
+	Deleted   []refChange `json:"deleted"`
+}
+
+// refsByName flattens 'snapshot' into a map of full ref names to SHAs
+func refsByName(snapshot *refSnapshot) map[string]string {
+	refs := map[string]string{}
+	for name, sha := range snapshot.Branches {
+		refs["refs/heads/"+name] = sha
+	}
+	for name, sha := range snapshot.Tags {
+		refs["refs/tags/"+name] = sha
+	}
+	return refs
+}
+
+// diffRefSnapshots returns how the mirror at 'mirrorDir' moved from 'before'
+// to 'after'
+func diffRefSnapshots(ctx context.Context, mirrorDir string, before, after *refSnapshot) (*refDelta, error) {
+	delta := &refDelta{UpdatedAt: time.Now(), Advanced: []refChange{},
+		Created: []refChange{}, Deleted: []refChange{}}
+	oldRefs, newRefs := refsByName(before), refsByName(after)
+	names := []string{}
+	for name := range newRefs {
+		names = append(names, name)
+	}
+	for name := range oldRefs {
+		if _, ok := newRefs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oldSHA, hadIt := oldRefs[name]
+		newSHA, hasIt := newRefs[name]
+		switch {
+		case !hadIt:
+			delta.Created = append(delta.Created, refChange{Ref: name, New: newSHA})
+		case !hasIt:
+			delta.Deleted = append(delta.Deleted, refChange{Ref: name, Old: oldSHA})
+		case oldSHA != newSHA:
+			out, err := runCommand(ctx, mirrorDir, nil, "git", "rev-list", "--count", oldSHA+".."+newSHA)
+			if err != nil {
+				return nil, err
+			}
+			commits, err := strconv.Atoi(out)
+			if err != nil {
+				return nil, print.Errorf("unexpected 'git rev-list --count' output %q", out)
+			}
+			// XXX merge-base exits with 1 when it's not an ancestor, which
+			// runCommand reports as an error like any other failure
+			_, err = runCommand(ctx, mirrorDir, nil, "git", "merge-base", "--is-ancestor", oldSHA, newSHA)
+			delta.Advanced = append(delta.Advanced, refChange{Ref: name, Old: oldSHA, New: newSHA,
+				Commits: commits, Forced: err != nil})
+		}
+	}
+	return delta, nil
+}
+
+// updateMirror fetches what changed upstream into the existing mirror of
+// 'repo', with 'env' to authenticate, then logs which refs advanced and by
+// how many commits, and writes it to 'refs_delta.json' in its meta
+// directory
+func updateMirror(ctx context.Context, backupDirPath string, repo *github.Repository, env []string) error {
+	print.DebugFunc()
+
+	mirrorDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
+	before, err := readRefSnapshot(ctx, mirrorDir)
+	if err != nil {
+		return err
+	}
+	_, err = runCommand(ctx, mirrorDir, env, "git", "remote", "update", "--prune")
+	if err != nil {
+		return err
+	}
+	after, err := readRefSnapshot(ctx, mirrorDir)
+	if err != nil {
+		return err
+	}
+	delta, err := diffRefSnapshots(ctx, mirrorDir, before, after)
+	if err != nil {
+		return err
+	}
+	if len(delta.Advanced) == 0 && len(delta.Created) == 0 && len(delta.Deleted) == 0 {
+		print.Infof("Updated mirror of %s: no refs moved\n", *repo.Name)
+	}
+	for _, change := range delta.Advanced {
+		if change.Forced {
+			print.Warnf("Updated mirror of %s: %s was force-pushed from %s to %s (%d new commits)\n",
+				*repo.Name, change.Ref, change.Old, change.New, change.Commits)
+			continue
+		}
+		print.Infof("Updated mirror of %s: %s advanced by %d commits (%s..%s)\n",
+			*repo.Name, change.Ref, change.Commits, change.Old, change.New)
+	}
+	for _, change := range delta.Created {
+		print.Infof("Updated mirror of %s: %s created at %s\n", *repo.Name, change.Ref, change.New)
+	}
+	for _, change := range delta.Deleted {
+		print.Infof("Updated mirror of %s: %s deleted, was at %s\n", *repo.Name, change.Ref, change.Old)
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, refsDeltaFileName), delta)
+}
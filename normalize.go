@@ -0,0 +1,100 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+)
+
+var (
+	// taskListMarkerRegexp matches the checkbox of a task list item, e.g.
+	// '- [ ] ' or '1. [x] '
+	taskListMarkerRegexp = regexp.MustCompile(`(?m)^([ \t]*(?:[-*+]|\d+[.)])[ \t]+)\[([ xX])\]([ \t])`)
+	// mentionRegexp matches an '@user' or '@org/team' mention. One preceded by
+	// a word character, a slash or a dot is part of an email or a URL
+	mentionRegexp     = regexp.MustCompile(`(^|[^\w/.@])@([A-Za-z0-9][A-Za-z0-9-]*(?:/[\w.-]+)?)`)
+	htmlCommentRegexp = regexp.MustCompile(`(?s)<!--.*?-->`)
+	codeFenceRegexp   = regexp.MustCompile("^(```+|~~~+)[ \t]*([^ \t`]*)")
+)
+
+// normalizeIssueMarkdown rewrites the bodies of 'issue', of its comments and
+// of its review comments with normalizeMarkdown
+func normalizeIssueMarkdown(issue *export.Issue, stripHTMLComments bool) {
+	if issue.Body != nil {
+		body := normalizeMarkdown(*issue.Body, stripHTMLComments)
+		issue.Body = &body
+	}
+	for i := range issue.Comments {
+		issue.Comments[i].Body = normalizeMarkdown(issue.Comments[i].Body, stripHTMLComments)
+	}
+	for i := range issue.ReviewThreads {
+		thread := &issue.ReviewThreads[i]
+		for j := range thread.Comments {
+			thread.Comments[j].Body = normalizeMarkdown(thread.Comments[j].Body, stripHTMLComments)
+		}
+	}
+}
+
+// normalizeMarkdown rewrites the GitHub-only syntax of 'body' so it reads the
+// same anywhere else: task list checkboxes become '(todo)' and '(done)',
+// mentions are put in code spans so they don't notify anyone if the text is
+// uploaded again, and suggestion blocks become plain code blocks. HTML
+// comments are removed if 'stripHTMLComments' is set.
+//
+// XXX Code blocks and code spans are left alone, but it's a line-based pass,
+// not a Markdown parser: e.g. a fence inside an HTML block is taken as a fence
+func normalizeMarkdown(body string, stripHTMLComments bool) string {
+	var out, text strings.Builder
+	flush := func() {
+		out.WriteString(normalizeMarkdownText(text.String(), stripHTMLComments))
+		text.Reset()
+	}
+	fence := ""
+	for _, line := range strings.SplitAfter(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(fence) == 0 {
+			m := codeFenceRegexp.FindStringSubmatch(trimmed)
+			if m == nil {
+				text.WriteString(line)
+				continue
+			}
+			flush()
+			fence = m[1]
+			if m[2] == "suggestion" {
+				line = strings.Replace(line, "suggestion", "", 1)
+			}
+			out.WriteString(line)
+			continue
+		}
+		out.WriteString(line)
+		// A fence is closed by one of the same character, at least as long
+		if strings.HasPrefix(trimmed, fence) && len(strings.TrimLeft(trimmed, fence[:1])) == 0 {
+			fence = ""
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// normalizeMarkdownText is normalizeMarkdown for 'text', which is outside
+// of code blocks
+func normalizeMarkdownText(text string, stripHTMLComments bool) string {
+	if stripHTMLComments {
+		text = htmlCommentRegexp.ReplaceAllString(text, "")
+	}
+	text = taskListMarkerRegexp.ReplaceAllStringFunc(text, func(match string) string {
+		m := taskListMarkerRegexp.FindStringSubmatch(match)
+		marker := "(todo)"
+		if m[2] != " " {
+			marker = "(done)"
+		}
+		return m[1] + marker + m[3]
+	})
+	// XXX Every other part is in a code span
+	parts := strings.Split(text, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = mentionRegexp.ReplaceAllString(parts[i], "$1`@$2`")
+	}
+	return strings.Join(parts, "`")
+}
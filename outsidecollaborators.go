@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const outsideCollaboratorsFileName = "outside_collaborators.json"
+
+// outsideCollaboratorsBackup is what -outside_collaborators writes
+type outsideCollaboratorsBackup struct {
+	Collaborators []outsideCollaborator `json:"collaborators"`
+	// ReposNotListed are the repos whose collaborators the token couldn't
+	// list: the access outside collaborators have to them is missing
+	ReposNotListed []string `json:"repos_not_listed,omitempty"`
+}
+
+// outsideCollaborator is a user with access to some repos of the org without
+// being a member of it
+type outsideCollaborator struct {
+	Login             string `json:"login"`
+	TwoFactorDisabled bool   `json:"two_factor_disabled"`
+	// Repos are the backed up repos the user has access to
+	Repos []outsideCollaboratorAccess `json:"repos"`
+}
+
+// outsideCollaboratorAccess is the role an outside collaborator has on a repo
+type outsideCollaboratorAccess struct {
+	Repo string `json:"repo"`
+	// Role is 'read', 'triage', 'write', 'maintain', 'admin' or a custom
+	// role
+	Role string `json:"role"`
+}
+
+// backupOrgOutsideCollaborators uses 'client' and 'ctx' to write the outside
+// collaborators of 'org', whether they have two-factor authentication
+// disabled, and which of 'repos' they have access to, to
+// 'org__meta/outside_collaborators.json'.
+//
+// XXX Listing outside collaborators needs an org owner: without one, it's
+// skipped with a warning. Which repos they have access to costs one API call
+// per repo, and repos the token can't list collaborators of are recorded as
+// such instead
+func backupOrgOutsideCollaborators(client *github.Client, ctx context.Context,
+	backupDirPath, org string, repos []*github.Repository) error {
+	print.DebugFunc()
+
+	opts := &github.ListOutsideCollaboratorsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	users, err := paginate(ctx, "outside collaborators", func(page int) ([]*github.User, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return client.Organizations.ListOutsideCollaborators(ctx, org, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Warnf("Skipping outside collaborators of %s: it needs an org owner: %v\n", org, err)
+			return nil
+		}
+		return err
+	}
+	noTwoFactorOpts := &github.ListOutsideCollaboratorsOptions{
+		Filter:      "2fa_disabled",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	noTwoFactor, err := paginate(ctx, "outside collaborators", func(page int) ([]*github.User, *github.Response, error) {
+		noTwoFactorOpts.ListOptions.Page = page
+		return client.Organizations.ListOutsideCollaborators(ctx, org, noTwoFactorOpts)
+	})
+	if err != nil {
+		return err
+	}
+
+	out := &outsideCollaboratorsBackup{Collaborators: []outsideCollaborator{}}
+	byLogin := map[string]*outsideCollaborator{}
+	for _, user := range users {
+		out.Collaborators = append(out.Collaborators, outsideCollaborator{
+			Login: user.GetLogin(),
+			Repos: []outsideCollaboratorAccess{},
+		})
+	}
+	for i := range out.Collaborators {
+		byLogin[out.Collaborators[i].Login] = &out.Collaborators[i]
+	}
+	for _, user := range noTwoFactor {
+		if collaborator, ok := byLogin[user.GetLogin()]; ok {
+			collaborator.TwoFactorDisabled = true
+		}
+	}
+
+	if len(users) != 0 {
+		for _, repo := range repos {
+			repoOpts := &github.ListCollaboratorsOptions{
+				Affiliation: "outside",
+				ListOptions: github.ListOptions{PerPage: 100},
+			}
+			collaborators, err := paginate(ctx, "collaborators", func(page int) ([]*github.User, *github.Response, error) {
+				repoOpts.ListOptions.Page = page
+				return client.Repositories.ListCollaborators(ctx, *repo.Owner.Login, *repo.Name, repoOpts)
+			})
+			if err != nil {
+				if !isAccessDenied(err) {
+					return err
+				}
+				print.Debugf("Skipping collaborators of %s: %v\n", *repo.Name, err)
+				out.ReposNotListed = append(out.ReposNotListed, repo.GetFullName())
+				continue
+			}
+			for _, user := range collaborators {
+				collaborator, ok := byLogin[user.GetLogin()]
+				if !ok {
+					continue
+				}
+				collaborator.Repos = append(collaborator.Repos, outsideCollaboratorAccess{
+					Repo: repo.GetFullName(),
+					Role: user.GetRoleName(),
+				})
+			}
+		}
+	}
+	if len(out.ReposNotListed) != 0 {
+		print.Warnf("Couldn't list the collaborators of %d repos of %s: outside collaborators' access to them isn't recorded\n",
+			len(out.ReposNotListed), org)
+	}
+
+	targetDir := orgArtifactPath(backupDirPath, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d outside collaborators of %s\n", len(out.Collaborators), org)
+	return writeJSONFile(filepath.Join(targetDir, outsideCollaboratorsFileName), out)
+}
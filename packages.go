@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const artifactPackages = "packages"
+
+// packageTypes are the package types GitHub Packages hosts. The API only
+// lists an org's packages one type at a time
+var packageTypes = []string{"npm", "maven", "rubygems", "docker", "nuget", "container"}
+
+// packageExport is what gets written for a single package
+type packageExport struct {
+	Package  *github.Package          `json:"package"`
+	Versions []*github.PackageVersion `json:"versions"`
+}
+
+// backupOrgPackages uses 'client' and 'ctx' to write every package 'org'
+// publishes to GitHub Packages, with every version of it, to
+// 'org__packages/<type>/<name>.json'.
+//
+// XXX Only the inventory is backed up, not the packages themselves: they're
+// served by each ecosystem's registry, not the REST API. Listing packages
+// needs the 'read:packages' scope: without it, this is skipped with a warning
+func backupOrgPackages(client *github.Client, ctx context.Context, backupDirPath, org string) error {
+	print.DebugFunc()
+
+	packageCount := 0
+	for _, packageType := range packageTypes {
+		opts := &github.PackageListOptions{
+			PackageType: github.Ptr(packageType),
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		packages, err := paginate(ctx, packageType+" packages", func(page int) ([]*github.Package, *github.Response, error) {
+			opts.ListOptions.Page = page
+			return client.Organizations.ListPackages(ctx, org, opts)
+		})
+		if err != nil {
+			if isAccessDenied(err) {
+				print.Warnf("Skipping packages of %s: the token needs the read:packages scope (%v)\n", org, err)
+				return nil
+			}
+			return err
+		}
+		if len(packages) == 0 {
+			continue
+		}
+		targetDir := filepath.Join(orgArtifactPath(backupDirPath, artifactPackages), packageType)
+		err = os.MkdirAll(targetDir, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range packages {
+			versionOpts := &github.PackageListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+			versions, err := paginate(ctx, "package versions", func(page int) ([]*github.PackageVersion, *github.Response, error) {
+				versionOpts.ListOptions.Page = page
+				return client.Organizations.PackageGetAllVersions(ctx, org, packageType, pkg.GetName(), versionOpts)
+			})
+			if err != nil {
+				return err
+			}
+			// XXX Container names can have slashes: escape them so every
+			// package is a single file
+			err = writeJSONFile(filepath.Join(targetDir, url.PathEscape(pkg.GetName())+".json"),
+				packageExport{Package: pkg, Versions: versions})
+			if err != nil {
+				return err
+			}
+			packageCount++
+		}
+	}
+	print.Debugf("Backed up %d packages of %s\n", packageCount, org)
+	return nil
+}
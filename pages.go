@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const pagesFileName = "pages.json"
+
+// backupRepoPages uses 'client' and 'ctx' to write the GitHub Pages settings
+// of 'repo' (build type, source branch and path, custom domain, whether HTTPS
+// is enforced) to 'pages.json' in its meta directory. Repos without Pages are
+// skipped.
+//
+// XXX The API answers 404 for a repo without Pages, even if 'has_pages' said
+// otherwise when the repo was listed
+func backupRepoPages(client *github.Client, ctx context.Context, backupDirPath string,
+	repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	if !repo.GetHasPages() {
+		print.Debugf("No Pages site for repo %s\n", name)
+		return nil
+	}
+	pages, resp, err := client.Repositories.GetPagesInfo(ctx, owner, name)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping Pages settings of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return err
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, pagesFileName), pages)
+}
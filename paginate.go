@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// paginateMaxRetries is how many times a page is retried after a transient
+// failure before giving up
+const paginateMaxRetries = 5
+
+// paginateInitialBackoff is how long paginate waits before the first retry of
+// a page. It doubles with every retry. It's a variable so tests don't wait
+var paginateInitialBackoff = time.Second
+
+// isTransientError returns true if 'err' is worth retrying: a server error or
+// a dropped connection
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.Response != nil && errResp.Response.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// paginate calls 'list' with page 0, then with every 'resp.NextPage' it
+// returns, and collects the items of all pages. 'what' names the items in
+// debug logs.
+//
+// A page failing with a rate limit error is retried once the limit resets. A
+// page failing with a transient error is retried with an exponential backoff,
+// up to 'paginateMaxRetries' times. Any other error is returned as is.
+func paginate[T any](ctx context.Context, what string,
+	list func(page int) ([]T, *github.Response, error)) ([]T, error) {
+	var all []T
+	page := 0
+	pageCount := 0
+	retries := 0
+	backoff := paginateInitialBackoff
+	for {
+		print.Debugf("Fetching %s on page %d (total fetched: %d)...\n", what, pageCount, len(all))
+		items, resp, err := list(page)
+		if err != nil {
+			if wait, ok := retryAfterRateLimit(err); ok {
+				print.Debugf("Rate limited while fetching %s: retrying in %v\n", what, wait.Round(time.Second))
+				err = sleepContext(ctx, wait)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if isTransientError(err) && retries < paginateMaxRetries {
+				retries++
+				print.Debugf("Fetching %s failed (%v): retry %d/%d in %v\n",
+					what, err, retries, paginateMaxRetries, backoff)
+				err = sleepContext(ctx, backoff)
+				if err != nil {
+					return nil, err
+				}
+				backoff *= 2
+				continue
+			}
+			return nil, err
+		}
+		retries = 0
+		backoff = paginateInitialBackoff
+		all = append(all, items...)
+		err = waitForRateLimit(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+		pageCount++
+	}
+	return all, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v76/github"
+)
+
+// fakePage is what a fake list func returns for one call
+type fakePage struct {
+	items    []int
+	nextPage int
+	err      error
+}
+
+// fakeLister returns a list func that answers with 'pages', one per call,
+// and records the page numbers it's called with
+func fakeLister(t *testing.T, pages []fakePage) (func(page int) ([]int, *github.Response, error), *[]int) {
+	t.Helper()
+	calls := []int{}
+	return func(page int) ([]int, *github.Response, error) {
+		if len(calls) >= len(pages) {
+			t.Fatalf("list called %d times, only %d pages", len(calls)+1, len(pages))
+		}
+		p := pages[len(calls)]
+		calls = append(calls, page)
+		if p.err != nil {
+			return nil, nil, p.err
+		}
+		return p.items, &github.Response{NextPage: p.nextPage}, nil
+	}, &calls
+}
+
+func errorResponse(statusCode int) error {
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: statusCode}, Message: http.StatusText(statusCode)}
+}
+
+func TestPaginate(t *testing.T) {
+	prevBackoff := paginateInitialBackoff
+	paginateInitialBackoff = time.Millisecond
+	t.Cleanup(func() { paginateInitialBackoff = prevBackoff })
+
+	rateLimited := &github.AbuseRateLimitError{
+		Response:   &http.Response{StatusCode: http.StatusForbidden},
+		RetryAfter: github.Ptr(time.Millisecond),
+	}
+	denied := errorResponse(http.StatusNotFound)
+	for _, tc := range []struct {
+		name      string
+		pages     []fakePage
+		want      []int
+		wantCalls []int
+		wantErr   error
+	}{
+		{
+			name:      "single page",
+			pages:     []fakePage{{items: []int{1, 2}}},
+			want:      []int{1, 2},
+			wantCalls: []int{0},
+		},
+		{
+			name:      "stops at NextPage 0",
+			pages:     []fakePage{{items: []int{1}, nextPage: 2}, {items: []int{2}, nextPage: 3}, {items: []int{3}}},
+			want:      []int{1, 2, 3},
+			wantCalls: []int{0, 2, 3},
+		},
+		{
+			name:      "empty",
+			pages:     []fakePage{{}},
+			wantCalls: []int{0},
+		},
+		{
+			name: "retries a 5xx",
+			pages: []fakePage{{items: []int{1}, nextPage: 2}, {err: errorResponse(http.StatusBadGateway)},
+				{err: errorResponse(http.StatusServiceUnavailable)}, {items: []int{2}}},
+			want:      []int{1, 2},
+			wantCalls: []int{0, 2, 2, 2},
+		},
+		{
+			name:      "waits out a rate limit",
+			pages:     []fakePage{{err: rateLimited}, {items: []int{1}}},
+			want:      []int{1},
+			wantCalls: []int{0, 0},
+		},
+		{
+			name:      "access denied isn't retried",
+			pages:     []fakePage{{err: denied}},
+			wantCalls: []int{0},
+			wantErr:   denied,
+		},
+		{
+			name:      "an error on a later page drops the earlier ones",
+			pages:     []fakePage{{items: []int{1}, nextPage: 2}, {err: denied}},
+			wantCalls: []int{0, 2},
+			wantErr:   denied,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			list, calls := fakeLister(t, tc.pages)
+			got, err := paginate(context.Background(), "things", list)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("paginate() error = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil && got != nil {
+				t.Errorf("paginate() = %v with an error, want nil", got)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("paginate() = %v, want %v", got, tc.want)
+			}
+			if !reflect.DeepEqual(*calls, tc.wantCalls) {
+				t.Errorf("list called with pages %v, want %v", *calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPaginateGivesUpAfterMaxRetries(t *testing.T) {
+	prevBackoff := paginateInitialBackoff
+	paginateInitialBackoff = time.Microsecond
+	t.Cleanup(func() { paginateInitialBackoff = prevBackoff })
+
+	pages := []fakePage{}
+	for i := 0; i <= paginateMaxRetries; i++ {
+		pages = append(pages, fakePage{err: errorResponse(http.StatusInternalServerError)})
+	}
+	list, calls := fakeLister(t, pages)
+	_, err := paginate(context.Background(), "things", list)
+	if err == nil {
+		t.Fatal("paginate() succeeded, want the last 5xx")
+	}
+	if len(*calls) != paginateMaxRetries+1 {
+		t.Errorf("list called %d times, want %d", len(*calls), paginateMaxRetries+1)
+	}
+}
+
+func TestPaginateHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	list, _ := fakeLister(t, []fakePage{{err: &github.AbuseRateLimitError{RetryAfter: github.Ptr(time.Hour)}}})
+	_, err := paginate(ctx, "things", list)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("paginate() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryAfterRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		name   string
+		err    error
+		wantOK bool
+		min    time.Duration
+		max    time.Duration
+	}{
+		{name: "primary", err: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: reset}}},
+			wantOK: true, min: 59 * time.Minute, max: time.Hour},
+		{name: "secondary with Retry-After", err: &github.AbuseRateLimitError{RetryAfter: github.Ptr(30 * time.Second)},
+			wantOK: true, min: 30 * time.Second, max: 30 * time.Second},
+		{name: "secondary without Retry-After", err: &github.AbuseRateLimitError{},
+			wantOK: true, min: time.Minute, max: time.Minute},
+		{name: "other", err: errorResponse(http.StatusForbidden)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wait, ok := retryAfterRateLimit(tc.err)
+			if ok != tc.wantOK {
+				t.Fatalf("retryAfterRateLimit() ok = %t, want %t", ok, tc.wantOK)
+			}
+			if ok && (wait < tc.min || wait > tc.max) {
+				t.Errorf("retryAfterRateLimit() = %v, want between %v and %v", wait, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+func TestIsAccessDenied(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "401", err: errorResponse(http.StatusUnauthorized), want: true},
+		{name: "403", err: errorResponse(http.StatusForbidden), want: true},
+		{name: "404", err: errorResponse(http.StatusNotFound), want: true},
+		{name: "other provider 404", err: &httpStatusError{url: "x", resp: &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"}}, want: true},
+		{name: "500", err: errorResponse(http.StatusInternalServerError)},
+		{name: "rate limit", err: &github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}},
+		{name: "secondary rate limit", err: &github.AbuseRateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}},
+		{name: "not an HTTP error", err: errors.New("boom")},
+		{name: "nil", err: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isAccessDenied(tc.err); got != tc.want {
+				t.Errorf("isAccessDenied(%v) = %t, want %t", tc.err, got, tc.want)
+			}
+		})
+	}
+}
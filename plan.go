@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// planVersion is the version of the plan format. -plan_in refuses plans
+// written with another version
+const planVersion = 1
+
+// plan is the resolved list of repos a backup targets, as written by
+// -plan_out and executed by -plan_in
+type plan struct {
+	Version   int       `json:"version"`
+	Org       string    `json:"org"`
+	Provider  string    `json:"provider"`
+	CreatedAt time.Time `json:"created_at"`
+	// Filters are the repo filters that were applied to get 'Repos'
+	Filters []string `json:"filters"`
+	// Repos are the repos as the API listed them, so executing the plan
+	// doesn't need to list them again
+	Repos []*github.Repository `json:"repos"`
+}
+
+// activeRepoFilters returns the names of the repo filter flags in use
+func activeRepoFilters() []string {
+	filters := []string{}
+	if *onlyPublicFlag {
+		filters = append(filters, "only_public")
+	}
+	if *onlyPrivateFlag {
+		filters = append(filters, "only_private")
+	}
+	return filters
+}
+
+// writePlan writes 'repos', the repos of 'org' left after filtering, to the
+// plan file 'path'
+func writePlan(path, org string, repos []*github.Repository) error {
+	if repos == nil {
+		repos = []*github.Repository{}
+	}
+	b, err := json.MarshalIndent(plan{
+		Version:   planVersion,
+		Org:       org,
+		Provider:  *providerFlag,
+		CreatedAt: runStartedAt,
+		Filters:   activeRepoFilters(),
+		Repos:     repos,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		return err
+	}
+	print.Infof("Wrote a plan of %d repos to %s\n", len(repos), path)
+	return nil
+}
+
+// readPlan reads the repos of the plan file 'path', which must have been
+// written for 'org' with the same provider.
+//
+// XXX The filters of the plan were already applied: the ones of this run are
+// ignored
+func readPlan(path, org string) ([]*github.Repository, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p plan
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return nil, print.Errorf("can't parse plan %s: %v", path, err)
+	}
+	if p.Version != planVersion {
+		return nil, print.Errorf("plan %s has version %d, expected %d", path, p.Version, planVersion)
+	}
+	if p.Org != org {
+		return nil, print.Errorf("plan %s is for org %s, not %s", path, p.Org, org)
+	}
+	if p.Provider != *providerFlag {
+		return nil, print.Errorf("plan %s is for provider %s, not %s", path, p.Provider, *providerFlag)
+	}
+	print.Infof("Executing the plan of %d repos made at %s from %s\n",
+		len(p.Repos), p.CreatedAt.Format(time.RFC3339), path)
+	return p.Repos, nil
+}
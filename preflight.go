@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// minHTTPSGitVersion is the oldest git that reads the GIT_CONFIG_COUNT
+// variables gitHTTPSAuthEnv passes the token in
+var minHTTPSGitVersion = [2]int{2, 31}
+
+// sshProbeTimeout is how long the SSH probe of -preflight waits for the host
+const sshProbeTimeout = 15 * time.Second
+
+// gitVersionRegexp matches the version 'git --version' prints, e.g. "git
+// version 2.39.2" or "git version 2.37.1 (Apple Git-137.1)"
+var gitVersionRegexp = regexp.MustCompile(`git version (\d+)\.(\d+)`)
+
+// parseGitVersion returns the major and minor version of the output of
+// 'git --version'
+func parseGitVersion(out string) ([2]int, error) {
+	m := gitVersionRegexp.FindStringSubmatch(out)
+	if m == nil {
+		return [2]int{}, print.Errorf("unexpected 'git --version' output %q", out)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return [2]int{major, minor}, nil
+}
+
+// checkWritable creates and deletes a file in 'dirPath', creating it first if
+// it doesn't exist
+func checkWritable(dirPath string) error {
+	err := os.MkdirAll(dirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	fd, err := os.CreateTemp(dirPath, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	fd.Close()
+	return os.Remove(fd.Name())
+}
+
+// checkGit checks git is on PATH and, if 'https' is true, recent enough to
+// clone over HTTPS with a token
+func checkGit(ctx context.Context, https bool) error {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		return err
+	}
+	out, err := runCommand(ctx, "", nil, "git", "--version")
+	if err != nil {
+		return err
+	}
+	version, err := parseGitVersion(out)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Found git %d.%d\n", version[0], version[1])
+	if https && (version[0] < minHTTPSGitVersion[0] ||
+		version[0] == minHTTPSGitVersion[0] && version[1] < minHTTPSGitVersion[1]) {
+		return print.Errorf("git %d.%d is too old to clone over HTTPS with a token: %d.%d or later is needed",
+			version[0], version[1], minHTTPSGitVersion[0], minHTTPSGitVersion[1])
+	}
+	return nil
+}
+
+// checkSSH checks 'git@<host>' accepts the SSH key that repos are cloned
+// with: the one at 'keyPath', or the agent's/host's default ones if it's
+// empty.
+//
+// XXX GitHub, GitLab and Gitea all refuse a shell, so 'ssh -T' always exits
+// with an error: what tells a working key apart is the greeting they print
+// once it's accepted
+func checkSSH(ctx context.Context, host, keyPath string) error {
+	ctx, cancel := context.WithTimeout(ctx, sshProbeTimeout)
+	defer cancel()
+	args := []string{"-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if len(keyPath) != 0 {
+		args = append(args, "-i", keyPath, "-o", "IdentitiesOnly=yes")
+	}
+	args = append(args, "git@"+host)
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	print.Debugf("Executing command: %s\n", cmd.String())
+	out, _ := cmd.CombinedOutput()
+	greeting := strings.ToLower(string(out))
+	if strings.Contains(greeting, "successfully authenticated") || strings.Contains(greeting, "welcome to gitlab") {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return print.Errorf("no answer from %s within %v", host, sshProbeTimeout)
+	}
+	return print.Errorf("git@%s didn't accept the key: %s", host, strings.TrimSpace(string(out)))
+}
+
+// sshHost returns the host repos are cloned from over SSH with -provider
+// 'providerName'
+func sshHost(providerName string) (string, error) {
+	baseURL := "https://github.com"
+	switch providerName {
+	case providerGitea:
+		baseURL = *giteaURLFlag
+	case providerGitLab:
+		baseURL = *gitlabURLFlag
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Hostname(), nil
+}
+
+// runPreflight checks the run's environment before anything is backed up:
+// that 'backupRootPath', where the backups go, is writable, that git is
+// installed, and, if repos are cloned over SSH, that the host accepts the
+// key. Every check runs, and they're all reported at once
+func runPreflight(ctx context.Context, backupRootPath string) error {
+	print.DebugFunc()
+
+	https := cloneTokenSource != nil
+	type check struct {
+		name string
+		run  func() error
+	}
+	checks := []check{
+		{fmt.Sprintf("%s is writable", backupRootPath), func() error {
+			return checkWritable(backupRootPath)
+		}},
+		{"git is installed", func() error {
+			return checkGit(ctx, https)
+		}},
+	}
+	if !https {
+		checks = append(checks, check{"SSH authentication works", func() error {
+			host, err := sshHost(*providerFlag)
+			if err != nil {
+				return err
+			}
+			return checkSSH(ctx, host, sshKeyPath)
+		}})
+	}
+	failed := 0
+	for _, c := range checks {
+		err := c.run()
+		if err != nil {
+			print.Warnf("Preflight: %s: FAILED: %v\n", c.name, err)
+			failed++
+			continue
+		}
+		print.Infof("Preflight: %s: ok\n", c.name)
+	}
+	if failed != 0 {
+		return print.Errorf("%d of %d preflight checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const artifactProjects = "projects"
+
+// graphQLPageInfo is the pagination part of a GraphQL connection
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// XXX A project's fields, views and an item's field values aren't paginated:
+// 50 is way more than projects have in practice
+const orgProjectsQuery = `
+query($org: String!, $cursor: String) {
+  organization(login: $org) {
+    projectsV2(first: 20, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        id
+        number
+        title
+        shortDescription
+        readme
+        url
+        public
+        closed
+        createdAt
+        updatedAt
+        creator { login }
+        fields(first: 50) {
+          nodes {
+            ... on ProjectV2FieldCommon { id name dataType }
+            ... on ProjectV2SingleSelectField { options { id name description color } }
+            ... on ProjectV2IterationField {
+              configuration {
+                iterations { id title startDate duration }
+                completedIterations { id title startDate duration }
+              }
+            }
+          }
+        }
+        views(first: 50) {
+          nodes { id number name layout filter }
+        }
+        repositories(first: 50) {
+          nodes { nameWithOwner }
+        }
+      }
+    }
+  }
+}`
+
+const projectItemsQuery = `
+query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on ProjectV2 {
+      items(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id
+          type
+          isArchived
+          createdAt
+          updatedAt
+          content {
+            __typename
+            ... on Issue { number title url repository { nameWithOwner } }
+            ... on PullRequest { number title url repository { nameWithOwner } }
+            ... on DraftIssue { title body }
+          }
+          fieldValues(first: 50) {
+            nodes {
+              __typename
+              ... on ProjectV2ItemFieldTextValue { text field { ... on ProjectV2FieldCommon { name } } }
+              ... on ProjectV2ItemFieldNumberValue { number field { ... on ProjectV2FieldCommon { name } } }
+              ... on ProjectV2ItemFieldDateValue { date field { ... on ProjectV2FieldCommon { name } } }
+              ... on ProjectV2ItemFieldSingleSelectValue { name field { ... on ProjectV2FieldCommon { name } } }
+              ... on ProjectV2ItemFieldIterationValue { title startDate duration field { ... on ProjectV2FieldCommon { name } } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// projectBackup is what gets written for each project: the project as the
+// GraphQL API returns it, with its fields, views and linked repos, and all of
+// its items
+type projectBackup struct {
+	Project json.RawMessage   `json:"project"`
+	Items   []json.RawMessage `json:"items"`
+}
+
+// listProjectItems uses 'client' and 'ctx' to page through every item of the
+// project 'projectID'
+func listProjectItems(client *github.Client, ctx context.Context,
+	projectID string) ([]json.RawMessage, error) {
+	items := []json.RawMessage{}
+	var cursor *string
+	for {
+		var data struct {
+			Node struct {
+				Items struct {
+					PageInfo graphQLPageInfo   `json:"pageInfo"`
+					Nodes    []json.RawMessage `json:"nodes"`
+				} `json:"items"`
+			} `json:"node"`
+		}
+		err := queryGraphQL(client, ctx, projectItemsQuery,
+			map[string]interface{}{"id": projectID, "cursor": cursor}, &data)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, data.Node.Items.Nodes...)
+		print.Debugf("Fetched %d items of project %s\n", len(items), projectID)
+		if !data.Node.Items.PageInfo.HasNextPage {
+			return items, nil
+		}
+		endCursor := data.Node.Items.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+}
+
+// backupOrgProjects uses 'client' and 'ctx' to write every Projects (v2)
+// board of 'org', with its fields, views and items, to
+// 'org__projects/<number>.json'.
+//
+// XXX Projects belong to an org (or a user), never to a repo: repo-level
+// projects are org projects linked to the repo, and are listed here along
+// with the repos they're linked to. The token needs the 'read:project' scope:
+// projects are skipped otherwise
+func backupOrgProjects(client *github.Client, ctx context.Context,
+	backupDirPath, org string) error {
+	print.DebugFunc()
+
+	type project struct {
+		ID     string `json:"id"`
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	}
+	var projects []json.RawMessage
+	var cursor *string
+	for {
+		var data struct {
+			Organization struct {
+				ProjectsV2 struct {
+					PageInfo graphQLPageInfo   `json:"pageInfo"`
+					Nodes    []json.RawMessage `json:"nodes"`
+				} `json:"projectsV2"`
+			} `json:"organization"`
+		}
+		err := queryGraphQL(client, ctx, orgProjectsQuery,
+			map[string]interface{}{"org": org, "cursor": cursor}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Warnf("Skipping projects of %s: %v\n", org, err)
+				return nil
+			}
+			return err
+		}
+		projects = append(projects, data.Organization.ProjectsV2.Nodes...)
+		if !data.Organization.ProjectsV2.PageInfo.HasNextPage {
+			break
+		}
+		endCursor := data.Organization.ProjectsV2.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+	if len(projects) == 0 {
+		print.Debugf("No projects in %s\n", org)
+		return nil
+	}
+
+	targetDir := orgArtifactPath(backupDirPath, artifactProjects)
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	for _, raw := range projects {
+		var p project
+		err = json.Unmarshal(raw, &p)
+		if err != nil {
+			return err
+		}
+		print.Debugf("Backing up project #%d (%s) to %s\n", p.Number, p.Title, targetDir)
+		items, err := listProjectItems(client, ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		err = writeJSONFile(filepath.Join(targetDir, fmt.Sprintf("%06d.json", p.Number)),
+			projectBackup{Project: raw, Items: items})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
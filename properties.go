@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const customPropertiesFileName = "custom_properties.json"
+
+// backupRepoCustomProperties uses 'client' and 'ctx' to write the custom
+// property values of 'repo' to 'custom_properties.json' in its meta
+// directory. Values are strings, lists of strings for multi-select
+// properties, or null when unset.
+//
+// XXX Custom properties only exist for repos owned by an org: other repos,
+// and tokens that can't read them, are skipped
+func backupRepoCustomProperties(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	values, resp, err := client.Repositories.GetAllCustomPropertyValues(ctx, owner, name)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping custom properties of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if values == nil {
+		values = []*github.CustomPropertyValue{}
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, customPropertiesFileName), values)
+}
+
+// backupOrgCustomProperties uses 'client' and 'ctx' to write the custom
+// properties 'org' defines for its repos (name, value type, allowed and
+// default values, whether it's required) to 'org__meta/custom_properties.json'
+func backupOrgCustomProperties(client *github.Client, ctx context.Context, backupDirPath, org string) error {
+	print.DebugFunc()
+
+	properties, resp, err := client.Organizations.GetAllCustomProperties(ctx, org)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Warnf("Skipping custom properties of %s: %v\n", org, err)
+			return nil
+		}
+		return err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return err
+	}
+	if properties == nil {
+		properties = []*github.CustomProperty{}
+	}
+	targetDir := orgArtifactPath(backupDirPath, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d custom properties of %s\n", len(properties), org)
+	return writeJSONFile(filepath.Join(targetDir, customPropertiesFileName), properties)
+}
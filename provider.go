@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	providerGitHub = "github"
+	providerGitea  = "gitea"
+	providerGitLab = "gitlab"
+)
+
+// provider is a forge repos, issues and comments are backed up from.
+//
+// XXX go-github's types are used as the common model: other providers map
+// their own API objects onto them, so the clone and file-writing code doesn't
+// have to care where the data came from
+type provider interface {
+	// ListRepos returns every repo of the organization 'org'
+	ListRepos(ctx context.Context, org string) ([]*github.Repository, error)
+	// ListIssues returns every issue and PR of 'repo', whatever their state
+	ListIssues(ctx context.Context, repo *github.Repository) ([]*github.Issue, error)
+	// ListComments returns the comments of the issue or PR 'issue' of 'repo'
+	ListComments(ctx context.Context, repo *github.Repository, issue *github.Issue) ([]*github.IssueComment, error)
+}
+
+// githubProvider is the default provider, backed by go-github
+type githubProvider struct {
+	client *github.Client
+}
+
+func (p *githubProvider) ListRepos(ctx context.Context, org string) ([]*github.Repository, error) {
+	opts := &github.RepositoryListByOrgOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	return paginate(ctx, "repos", func(page int) ([]*github.Repository, *github.Response, error) {
+		opts.Page = page
+		return p.client.Repositories.ListByOrg(ctx, org, opts)
+	})
+}
+
+func (p *githubProvider) ListIssues(ctx context.Context, repo *github.Repository) ([]*github.Issue, error) {
+	opts := &github.IssueListByRepoOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	return paginate(ctx, "issues", func(page int) ([]*github.Issue, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return p.client.Issues.ListByRepo(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+}
+
+func (p *githubProvider) ListComments(ctx context.Context, repo *github.Repository, issue *github.Issue) ([]*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	return paginate(ctx, "comments", func(page int) ([]*github.IssueComment, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return p.client.Issues.ListComments(ctx, *repo.Owner.Login, *repo.Name, issue.GetNumber(), opts)
+	})
+}
+
+// httpStatusError is returned for a non-200 answer of the API of a provider
+// that isn't backed by go-github
+type httpStatusError struct {
+	url  string
+	resp *http.Response
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.url, e.resp.Status)
+}
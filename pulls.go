@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// fillPullRequestAssignees fills the assignees of the PR 'issue', which the
+// issue listing already has, into 'out'
+func fillPullRequestAssignees(issue *github.Issue, out *export.Issue) {
+	for _, assignee := range issue.Assignees {
+		out.Assignees = append(out.Assignees, assignee.GetLogin())
+	}
+}
+
+// fetchPullRequestReviewers fills the requested reviewers (users and teams)
+// of the PR 'issue' into 'out'.
+//
+// XXX Each page of the API has both users and teams, so it's paginated as a
+// list of Reviewers, one per page
+func fetchPullRequestReviewers(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	owner, name, number := *repo.Owner.Login, *repo.Name, *issue.Number
+	opts := &github.ListOptions{PerPage: 100}
+	pages, err := paginate(ctx, "requested reviewers", func(page int) ([]*github.Reviewers, *github.Response, error) {
+		opts.Page = page
+		reviewers, resp, err := client.PullRequests.ListReviewers(ctx, owner, name, number, opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		return []*github.Reviewers{reviewers}, resp, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, reviewers := range pages {
+		for _, user := range reviewers.Users {
+			out.RequestedReviewers = append(out.RequestedReviewers, user.GetLogin())
+		}
+		for _, team := range reviewers.Teams {
+			out.RequestedTeams = append(out.RequestedTeams, team.GetSlug())
+		}
+	}
+	out.RequestedReviewersFetched = true
+	return nil
+}
+
+// fetchPullRequestDetails fills the state, draft flag, mergeability and
+// auto-merge settings of the PR 'issue' into 'out', and how it was merged if
+// it was.
+//
+// XXX GitHub computes mergeability in the background: the first request for a
+// PR that nobody looked at in a while has a nil 'mergeable' and an 'unknown'
+// state. We record that as-is instead of polling for it
+func fetchPullRequestDetails(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	pr, _, err := client.PullRequests.Get(ctx, *repo.Owner.Login, *repo.Name, *issue.Number)
+	if err != nil {
+		return err
+	}
+	out.PullRequest = &export.PullRequestDetails{
+		State:          pr.GetState(),
+		Draft:          pr.GetDraft(),
+		Mergeable:      pr.Mergeable,
+		MergeableState: pr.GetMergeableState(),
+	}
+	if autoMerge := pr.GetAutoMerge(); autoMerge != nil {
+		out.PullRequest.AutoMerge = &export.AutoMerge{
+			EnabledBy:     autoMerge.GetEnabledBy().GetLogin(),
+			MergeMethod:   autoMerge.GetMergeMethod(),
+			CommitTitle:   autoMerge.GetCommitTitle(),
+			CommitMessage: autoMerge.GetCommitMessage(),
+		}
+	}
+	if !pr.GetMerged() {
+		return nil
+	}
+	if pr.MergedAt != nil {
+		out.PullRequest.MergedAt = &pr.MergedAt.Time
+	}
+	out.PullRequest.MergedBy = pr.GetMergedBy().GetLogin()
+	method, err := deriveMergeMethod(client, ctx, repo, pr)
+	if err != nil {
+		return err
+	}
+	out.PullRequest.MergeMethod = method
+	return nil
+}
+
+// deriveMergeMethod uses 'client' and 'ctx' to tell how the merged PR 'pr'
+// was merged from its merge commit: a commit with two parents is a merge, and
+// a single-parent commit whose subject ends with the PR number, as GitHub
+// writes it, is a squash. Anything else is a rebase. It returns an empty
+// string if the merge commit can't be fetched.
+//
+// XXX It's a heuristic: GitHub doesn't record the method. A squash whose
+// title was edited to drop '(#N)' passes for a rebase, and so does a PR
+// merged by pushing its commits by hand. It costs one API call per merged PR
+func deriveMergeMethod(client *github.Client, ctx context.Context, repo *github.Repository,
+	pr *github.PullRequest) (string, error) {
+	sha := pr.GetMergeCommitSHA()
+	if len(sha) == 0 {
+		return "", nil
+	}
+	commit, resp, err := client.Git.GetCommit(ctx, *repo.Owner.Login, *repo.Name, sha)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping merge method of PR #%d: %v\n", pr.GetNumber(), err)
+			return "", nil
+		}
+		return "", err
+	}
+	err = waitForRateLimit(ctx, resp)
+	if err != nil {
+		return "", err
+	}
+	if len(commit.Parents) > 1 {
+		return "merge", nil
+	}
+	subject, _, _ := strings.Cut(commit.GetMessage(), "\n")
+	if strings.HasSuffix(strings.TrimSpace(subject), fmt.Sprintf("(#%d)", pr.GetNumber())) {
+		return "squash", nil
+	}
+	return "rebase", nil
+}
+
+// fetchPullRequestCommitsAndFiles fills the commits and the changed files of
+// the PR 'issue' into 'out'.
+//
+// XXX GitHub lists at most 250 commits and 3000 files per PR: the mirror has
+// the rest
+func fetchPullRequestCommitsAndFiles(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	owner, name, number := *repo.Owner.Login, *repo.Name, *issue.Number
+	opts := &github.ListOptions{PerPage: 100}
+	commits, err := paginate(ctx, "PR commits", func(page int) ([]*github.RepositoryCommit, *github.Response, error) {
+		opts.Page = page
+		return client.PullRequests.ListCommits(ctx, owner, name, number, opts)
+	})
+	if err != nil {
+		return err
+	}
+	out.Commits = []export.PullRequestCommit{}
+	for _, commit := range commits {
+		author := commit.GetAuthor().GetLogin()
+		if len(author) == 0 {
+			author = commit.GetCommit().GetAuthor().GetName()
+		}
+		out.Commits = append(out.Commits, export.PullRequestCommit{
+			SHA:     commit.GetSHA(),
+			Author:  author,
+			Message: commit.GetCommit().GetMessage(),
+		})
+	}
+
+	opts = &github.ListOptions{PerPage: 100}
+	files, err := paginate(ctx, "PR files", func(page int) ([]*github.CommitFile, *github.Response, error) {
+		opts.Page = page
+		return client.PullRequests.ListFiles(ctx, owner, name, number, opts)
+	})
+	if err != nil {
+		return err
+	}
+	out.Files = []export.PullRequestFile{}
+	for _, file := range files {
+		out.Files = append(out.Files, export.PullRequestFile{
+			Path:         file.GetFilename(),
+			Status:       file.GetStatus(),
+			Additions:    file.GetAdditions(),
+			Deletions:    file.GetDeletions(),
+			PreviousPath: file.GetPreviousFilename(),
+		})
+	}
+	return nil
+}
+
+// writePullRequestCommitsMarkdown writes the commits and changed files filled
+// by fetchPullRequestCommitsAndFiles, if any, to 'fd'
+func writePullRequestCommitsMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if len(issue.Commits) != 0 {
+		fd.WriteString("## Commits\r\n\r\n")
+		for _, commit := range issue.Commits {
+			// Only the subject: the full message is in the JSON and the mirror
+			subject, _, _ := strings.Cut(commit.Message, "\n")
+			fd.WriteString(fmt.Sprintf("* %s %s (%s)\r\n", commit.SHA, subject, commit.Author))
+		}
+		fd.WriteString("\r\n")
+	}
+	if len(issue.Files) != 0 {
+		fd.WriteString("## Files\r\n\r\n")
+		for _, file := range issue.Files {
+			path := file.Path
+			if len(file.PreviousPath) != 0 {
+				path = file.PreviousPath + " -> " + file.Path
+			}
+			fd.WriteString(fmt.Sprintf("* %s (%s, +%d -%d)\r\n", path, file.Status, file.Additions, file.Deletions))
+		}
+		fd.WriteString("\r\n")
+	}
+}
+
+// writePullRequestDetailsMarkdown writes the details filled by
+// fetchPullRequestDetails, if any, to 'fd'
+func writePullRequestDetailsMarkdown(fd io.StringWriter, issue *export.Issue) {
+	details := issue.PullRequest
+	if details == nil {
+		return
+	}
+	fd.WriteString(fmt.Sprintf("* Draft: %t\r\n", details.Draft))
+	mergeable := "unknown"
+	if details.Mergeable != nil {
+		mergeable = fmt.Sprintf("%t", *details.Mergeable)
+	}
+	if len(details.MergeableState) != 0 {
+		mergeable += " (" + details.MergeableState + ")"
+	}
+	fd.WriteString(fmt.Sprintf("* Mergeable: %s\r\n", mergeable))
+	if autoMerge := details.AutoMerge; autoMerge != nil {
+		fd.WriteString(fmt.Sprintf("* Auto-merge: %s, enabled by %s\r\n", autoMerge.MergeMethod, autoMerge.EnabledBy))
+	}
+	if details.MergedAt != nil {
+		merged := details.MergedAt.String()
+		if len(details.MergedBy) != 0 {
+			merged += " by " + details.MergedBy
+		}
+		if len(details.MergeMethod) != 0 {
+			merged += " (" + details.MergeMethod + ")"
+		}
+		fd.WriteString(fmt.Sprintf("* Merged: %s\r\n", merged))
+	}
+}
+
+// writePullRequestReviewersMarkdown writes the assignees and requested
+// reviewers of the PR 'issue' to 'fd'
+//
+// XXX GitHub removes a requested reviewer once they submit a review, so a
+// merged PR will very often have no requested reviewers left. We write that
+// down explicitly instead of omitting the line, unless they weren't fetched
+// at all, i.e. without -requested_reviewers or off GitHub.
+func writePullRequestReviewersMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if len(issue.Assignees) != 0 {
+		fd.WriteString(fmt.Sprintf("* Assignees: %s\r\n", strings.Join(issue.Assignees, ", ")))
+	}
+	if !issue.RequestedReviewersFetched {
+		return
+	}
+	if len(issue.RequestedReviewers) == 0 && len(issue.RequestedTeams) == 0 {
+		fd.WriteString("* Requested reviewers: none pending\r\n")
+		return
+	}
+	if len(issue.RequestedReviewers) != 0 {
+		fd.WriteString(fmt.Sprintf("* Requested reviewers: %s\r\n", strings.Join(issue.RequestedReviewers, ", ")))
+	}
+	if len(issue.RequestedTeams) != 0 {
+		fd.WriteString(fmt.Sprintf("* Requested teams: %s\r\n", strings.Join(issue.RequestedTeams, ", ")))
+	}
+}
+
+// Media types of the raw formats a PR can be downloaded in
+const (
+	pullRequestDiffMediaType  = "application/vnd.github.v3.diff"
+	pullRequestPatchMediaType = "application/vnd.github.v3.patch"
+)
+
+// downloadPullRequestRaw uses 'client' and 'ctx' to stream the PR 'number' of
+// 'repo', in the raw format 'mediaType', to 'path'.
+//
+// XXX Diffs can be huge, so this streams the response straight to disk
+// (through a temporary file, renamed once complete) instead of going through
+// PullRequests.GetRaw which buffers everything in memory. GitHub refuses to
+// render the largest ones with a 406: that PR's raw format is skipped with a
+// warning, the mirror still has its commits
+func downloadPullRequestRaw(client *github.Client, ctx context.Context,
+	repo *github.Repository, number int, mediaType string, path string) error {
+	u := fmt.Sprintf("repos/%v/%v/pulls/%d", *repo.Owner.Login, *repo.Name, number)
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", mediaType)
+	tmpPath := path + ".tmp"
+	err = checkWritePath(path)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	_, err = client.Do(ctx, req, fd)
+	if err != nil {
+		fd.Close()
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil &&
+			errResp.Response.StatusCode == http.StatusNotAcceptable {
+			print.Warnf("Skipping the %s of PR #%d of %s: too large for GitHub to render\n",
+				strings.TrimPrefix(filepath.Ext(path), "."), number, *repo.Name)
+			return nil
+		}
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// backupPullRequestDiffs writes the unified diff of the PR 'number' of 'repo'
+// to '<number>.diff' in its pulls directory and, with -pr_patches, its patch
+// series to '<number>.patch'
+func backupPullRequestDiffs(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository, number int) error {
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactPulls)
+	err := os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	diffPath := filepath.Join(targetDir, issueFileName(number, true, "diff"))
+	print.Debugf("Backing up diff of PR #%d to %s\n", number, diffPath)
+	err = downloadPullRequestRaw(client, ctx, repo, number, pullRequestDiffMediaType, diffPath)
+	if err != nil {
+		return err
+	}
+	if !*prPatchesFlag {
+		return nil
+	}
+	patchPath := filepath.Join(targetDir, issueFileName(number, true, "patch"))
+	print.Debugf("Backing up patch of PR #%d to %s\n", number, patchPath)
+	return downloadPullRequestRaw(client, ctx, repo, number, pullRequestPatchMediaType, patchPath)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// rateLimitLowWatermark is the number of remaining API requests under which
+// read-heavy loops wait for the rate limit window to reset
+const rateLimitLowWatermark = 50
+
+// sleepContext sleeps for 'd', or until 'ctx' is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForRateLimit sleeps until the rate limit window resets if 'resp' shows
+// we're about to run out of requests
+func waitForRateLimit(ctx context.Context, resp *github.Response) error {
+	if resp == nil || resp.Rate.Limit == 0 || resp.Rate.Remaining > rateLimitLowWatermark {
+		return nil
+	}
+	wait := time.Until(resp.Rate.Reset.Time)
+	print.Debugf("Only %d API requests left: waiting %v for the rate limit to reset...\n",
+		resp.Rate.Remaining, wait.Round(time.Second))
+	return sleepContext(ctx, wait)
+}
+
+// retryAfterRateLimit returns how long to wait before retrying if 'err' is a
+// (primary or secondary) rate limit error, and false otherwise
+func retryAfterRateLimit(err error) (time.Duration, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return time.Until(rateLimitErr.Rate.Reset.Time), true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return time.Minute, true
+	}
+	return 0, false
+}
+
+// isAccessDenied returns true if 'err' means the token (or the org's plan)
+// doesn't give access to the requested resource, as opposed to a transient
+// failure. GitHub answers 404 instead of 403 for a lot of those.
+func isAccessDenied(err error) bool {
+	if _, ok := retryAfterRateLimit(err); ok {
+		return false
+	}
+	var statusCode int
+	var errResp *github.ErrorResponse
+	var statusErr *httpStatusError
+	switch {
+	case errors.As(err, &errResp) && errResp.Response != nil:
+		statusCode = errResp.Response.StatusCode
+	case errors.As(err, &statusErr):
+		statusCode = statusErr.resp.StatusCode
+	default:
+		return false
+	}
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/google/go-github/v76/github"
+)
+
+// newReactionCounts returns the non-zero counts of 'r', keyed by reaction
+// type, or nil if nobody reacted
+func newReactionCounts(r *github.Reactions) map[string]int {
+	if r == nil || r.GetTotalCount() == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for content, count := range map[string]int{
+		"+1":       r.GetPlusOne(),
+		"-1":       r.GetMinusOne(),
+		"laugh":    r.GetLaugh(),
+		"confused": r.GetConfused(),
+		"heart":    r.GetHeart(),
+		"hooray":   r.GetHooray(),
+		"rocket":   r.GetRocket(),
+		"eyes":     r.GetEyes(),
+	} {
+		if count != 0 {
+			counts[content] = count
+		}
+	}
+	return counts
+}
+
+// listReactions pages through 'list' and converts every reaction it returns
+func listReactions(ctx context.Context,
+	list func(opts *github.ListReactionOptions) ([]*github.Reaction, *github.Response, error),
+) ([]export.Reaction, error) {
+	opts := &github.ListReactionOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	all, err := paginate(ctx, "reactions", func(page int) ([]*github.Reaction, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return list(opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reactions []export.Reaction
+	for _, r := range all {
+		reactions = append(reactions, export.Reaction{
+			User:    r.GetUser().GetLogin(),
+			Content: r.GetContent(),
+		})
+	}
+	return reactions, nil
+}
+
+// fetchReactionUsers fills who reacted to 'issue' and to each of its
+// 'comments' into 'out'. 'comments' must be in the same order as
+// 'out.Comments'.
+//
+// XXX Issues and comments nobody reacted to are skipped: their counts come
+// with the issue and comment listings, so this only costs a call for the ones
+// that have reactions
+func fetchReactionUsers(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, comments []*github.IssueComment,
+	out *export.Issue) error {
+	owner, name := *repo.Owner.Login, *repo.Name
+	var err error
+	if issue.GetReactions().GetTotalCount() != 0 {
+		out.ReactionUsers, err = listReactions(ctx,
+			func(opts *github.ListReactionOptions) ([]*github.Reaction, *github.Response, error) {
+				return client.Reactions.ListIssueReactions(ctx, owner, name, *issue.Number, opts)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	for i, comment := range comments {
+		if comment.GetReactions().GetTotalCount() == 0 {
+			continue
+		}
+		out.Comments[i].ReactionUsers, err = listReactions(ctx,
+			func(opts *github.ListReactionOptions) ([]*github.Reaction, *github.Response, error) {
+				return client.Reactions.ListIssueCommentReactions(ctx, owner, name, comment.GetID(), opts)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReactionsMarkdown writes the reaction 'counts' and, if any, who
+// reacted with what ('users') to 'fd'
+func writeReactionsMarkdown(fd io.StringWriter, counts map[string]int, users []export.Reaction) {
+	if len(counts) == 0 {
+		return
+	}
+	var contents []string
+	for content := range counts {
+		contents = append(contents, content)
+	}
+	sort.Strings(contents)
+	var parts []string
+	for _, content := range contents {
+		part := fmt.Sprintf("%s x%d", content, counts[content])
+		var logins []string
+		for _, user := range users {
+			if user.Content == content {
+				logins = append(logins, user.User)
+			}
+		}
+		if len(logins) != 0 {
+			part += fmt.Sprintf(" (%s)", strings.Join(logins, ", "))
+		}
+		parts = append(parts, part)
+	}
+	fd.WriteString(fmt.Sprintf("* Reactions: %s\r\n", strings.Join(parts, ", ")))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// readmeHTMLFileName is where -readme_html writes the rendered README
+const readmeHTMLFileName = "README.html"
+
+// isMarkdownFileName returns true if 'name' looks like a Markdown file
+func isMarkdownFileName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", "":
+		return true
+	}
+	return false
+}
+
+// backupRepoReadme uses 'client' and 'ctx' to write the README of 'repo' to
+// its meta directory, under its original name, e.g. 'README.md'. With
+// -readme_html, a Markdown README is also rendered by GitHub to
+// 'README.html'.
+//
+// XXX Repos without a README are skipped
+func backupRepoReadme(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	readme, _, err := client.Repositories.GetReadme(ctx, *repo.Owner.Login, *repo.Name, nil)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping README of %s: %v\n", *repo.Name, err)
+			return nil
+		}
+		return err
+	}
+	content, err := readme.GetContent()
+	if err != nil {
+		// XXX The API doesn't return the content of READMEs over 1MB
+		print.Warnf("Can't decode README of %s: %v\n", *repo.Name, err)
+		return nil
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	// XXX Only the base name is kept: the README can be in a subdirectory,
+	// e.g. '.github/README.md'
+	name := filepath.Base(readme.GetName())
+	print.Debugf("Backing up %s of %s to %s\n", name, *repo.Name, targetDir)
+	err = checkWritePath(filepath.Join(targetDir, name))
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(targetDir, name), []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+	if !*readmeHTMLFlag || !isMarkdownFileName(name) {
+		return nil
+	}
+	html, _, err := client.Markdown.Render(ctx, content, &github.MarkdownOptions{
+		Mode:    "gfm",
+		Context: repo.GetFullName(),
+	})
+	if err != nil {
+		return err
+	}
+	return writeTextFile(filepath.Join(targetDir, readmeHTMLFileName), []byte(html))
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+const (
+	// redactedEmailDomain is the domain of the pseudonymous emails. '.invalid'
+	// can't ever resolve
+	redactedEmailDomain = "redacted.invalid"
+	// pseudonymHashLength is how many hex characters of its hash a pseudonym
+	// has. It grows by two for as long as it collides with another's
+	pseudonymHashLength = 6
+)
+
+// Kinds of identities -redact_users replaces
+const (
+	identityLogin = "login"
+	identityEmail = "email"
+	identityName  = "name"
+)
+
+// redactionLoginKeys are the JSON keys whose strings, or arrays of strings,
+// are logins, in the export files and the API objects written as-is.
+// Objects under them, like the 'user' of an API object, are walked into
+var redactionLoginKeys = map[string]bool{
+	"login": true, "author": true, "actor": true, "closed_by": true, "editor": true, "resolved_by": true,
+	"user": true, "users": true, "assignees": true, "participants": true, "requested_reviewers": true,
+}
+
+// redactionMarkdownPrefixes are the lines of markdown issues that end with
+// logins, comma-separated
+var redactionMarkdownPrefixes = []string{
+	"* Author: ", "* By ", "* Participants: ", "* Closed by: ", "* Assignees: ",
+	"* Requested reviewers: ", "* Subscribers: ",
+}
+
+// redactionArchiveExtensions are the files -redact_users can't look into.
+// They're left out of the copy rather than shared unredacted
+var redactionArchiveExtensions = map[string]bool{
+	".zip": true, ".tar": true, ".gz": true, ".tgz": true, ".bundle": true,
+}
+
+var (
+	loginPattern      = regexp.MustCompile(`^[A-Za-z0-9]+(-[A-Za-z0-9]+)*$`)
+	loginTokenPattern = regexp.MustCompile(`[A-Za-z0-9]+(?:-[A-Za-z0-9]+)*`)
+	emailPattern      = `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+`
+)
+
+// redactionIdentity is an entry of the mapping file of -redact_users
+type redactionIdentity struct {
+	Kind      string `json:"kind"`
+	Value     string `json:"value"`
+	Pseudonym string `json:"pseudonym"`
+}
+
+// redactionMap is the mapping file of -redact_users. 'Salt' keys the hashes
+// pseudonyms are made of, so they can't be recomputed from public logins
+type redactionMap struct {
+	Salt       string              `json:"salt"`
+	Identities []redactionIdentity `json:"identities"`
+}
+
+// userRedactor replaces logins, emails and git author names with stable
+// pseudonyms, 'user_<hash>'
+type userRedactor struct {
+	salt []byte
+	// pseudonyms maps '<kind>:<value>' to its pseudonym. Logins and emails
+	// are lowercased, as both are case-insensitive
+	pseudonyms map[string]string
+	// taken maps a pseudonym to the '<kind>:<value>' it was made for
+	taken      map[string]string
+	identities []redactionIdentity
+	// pattern matches emails, names and login-like tokens, in that order
+	pattern *regexp.Regexp
+}
+
+// loadUserRedactor returns a redactor with the pseudonyms of the mapping
+// file at 'mapPath', or with a new salt if it doesn't exist yet
+func loadUserRedactor(mapPath string) (*userRedactor, error) {
+	r := &userRedactor{pseudonyms: map[string]string{}, taken: map[string]string{}}
+	if !util.IsFile(mapPath) {
+		r.salt = make([]byte, 32)
+		_, err := rand.Read(r.salt)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	b, err := os.ReadFile(mapPath)
+	if err != nil {
+		return nil, err
+	}
+	var m redactionMap
+	err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), &m)
+	if err != nil {
+		return nil, print.Errorf("%s: %v", mapPath, err)
+	}
+	r.salt, err = hex.DecodeString(m.Salt)
+	if err != nil || len(r.salt) == 0 {
+		return nil, print.Errorf("%s: invalid salt", mapPath)
+	}
+	for _, identity := range m.Identities {
+		key := identityKey(identity.Kind, identity.Value)
+		r.pseudonyms[key] = identity.Pseudonym
+		if _, ok := r.taken[identity.Pseudonym]; !ok {
+			r.taken[identity.Pseudonym] = key
+		}
+		r.identities = append(r.identities, identity)
+	}
+	return r, nil
+}
+
+// identityKey returns the key of the identity 'value' of 'kind' in
+// userRedactor.pseudonyms
+func identityKey(kind, value string) string {
+	if kind != identityName {
+		value = strings.ToLower(value)
+	}
+	return kind + ":" + value
+}
+
+// add returns the pseudonym of the identity 'value' of 'kind', making one if
+// it doesn't have one yet
+func (r *userRedactor) add(kind, value string) string {
+	key := identityKey(kind, value)
+	if p, ok := r.pseudonyms[key]; ok {
+		return p
+	}
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(key))
+	sum := hex.EncodeToString(mac.Sum(nil))
+	var p string
+	for n := pseudonymHashLength; n <= len(sum); n += 2 {
+		p = "user_" + sum[:n]
+		if _, ok := r.taken[p]; !ok {
+			break
+		}
+	}
+	r.pseudonyms[key] = p
+	r.taken[p] = key
+	r.identities = append(r.identities, redactionIdentity{Kind: kind, Value: value, Pseudonym: p})
+	return p
+}
+
+// addLogin adds 'login', or a git name if it isn't shaped like a login, as
+// the export files fall back to the git author name of commits without one.
+// Bots aren't people, and are left alone
+func (r *userRedactor) addLogin(login string) {
+	login = strings.TrimSpace(login)
+	if len(login) == 0 || strings.HasSuffix(login, "[bot]") {
+		return
+	}
+	if loginPattern.MatchString(login) {
+		r.add(identityLogin, login)
+		return
+	}
+	r.add(identityName, login)
+}
+
+// addIdent adds the git identity 'name <email>'. The name gets the same
+// pseudonym as the email, so 'Name <email>' stays the same person
+func (r *userRedactor) addIdent(name, email string) string {
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	if len(email) == 0 {
+		if len(name) != 0 {
+			return r.add(identityName, name)
+		}
+		return ""
+	}
+	p := r.add(identityEmail, email)
+	key := identityKey(identityName, name)
+	if _, ok := r.pseudonyms[key]; len(name) != 0 && !ok {
+		r.pseudonyms[key] = p
+		r.identities = append(r.identities, redactionIdentity{Kind: identityName, Value: name, Pseudonym: p})
+	}
+	return p
+}
+
+// compile builds the pattern 'redact' replaces identities with. It must be
+// called once every identity is added
+func (r *userRedactor) compile() error {
+	var names []string
+	for _, identity := range r.identities {
+		// XXX Names too short to be told apart from words aren't looked for
+		// in text: their email and login still are
+		if identity.Kind == identityName && len(identity.Value) >= 2 {
+			names = append(names, identity.Value)
+		}
+	}
+	// Longest first, so a name isn't cut short by another it starts with
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	alternatives := []string{emailPattern}
+	for _, name := range names {
+		quoted := regexp.QuoteMeta(name)
+		if isWordByte(name[0]) {
+			quoted = `\b` + quoted
+		}
+		if isWordByte(name[len(name)-1]) {
+			quoted += `\b`
+		}
+		alternatives = append(alternatives, quoted)
+	}
+	alternatives = append(alternatives, loginTokenPattern.String())
+	var err error
+	r.pattern, err = regexp.Compile(strings.Join(alternatives, "|"))
+	return err
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// redactLogins replaces the logins among the login-like tokens of 's'
+func (r *userRedactor) redactLogins(s string) string {
+	return loginTokenPattern.ReplaceAllStringFunc(s, func(token string) string {
+		if p, ok := r.pseudonyms[identityKey(identityLogin, token)]; ok {
+			return p
+		}
+		return token
+	})
+}
+
+// redact replaces every known email, name and login of 's' with its
+// pseudonym.
+//
+// XXX Logins are looked for as whole tokens, wherever they are, including in
+// issue bodies and @-mentions: a login that's also a word gets replaced where
+// it's used as a word too. Unknown emails, e.g. GitHub's
+// '<id>+<login>@users.noreply.github.com', get the logins they contain
+// replaced
+func (r *userRedactor) redact(s string) string {
+	return r.pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.Contains(match, "@") {
+			if p, ok := r.pseudonyms[identityKey(identityEmail, match)]; ok {
+				return p + "@" + redactedEmailDomain
+			}
+			return r.redactLogins(match)
+		}
+		if p, ok := r.pseudonyms[identityKey(identityName, match)]; ok {
+			return p
+		}
+		if p, ok := r.pseudonyms[identityKey(identityLogin, match)]; ok {
+			return p
+		}
+		return match
+	})
+}
+
+// rewriteIdentLine replaces the name and email of 'line', an 'author',
+// 'committer' or 'tagger' line of a fast-export stream, with the pseudonym
+// of the email
+func (r *userRedactor) rewriteIdentLine(line string) (string, bool) {
+	kind, rest, ok := strings.Cut(line, " ")
+	start := strings.Index(rest, "<")
+	end := strings.Index(rest, ">")
+	if !ok || start < 0 || end < start {
+		return line, false
+	}
+	p := r.addIdent(rest[:start], rest[start+1:end])
+	if len(p) == 0 {
+		return line, false
+	}
+	return kind + " " + p + " <" + p + "@" + redactedEmailDomain + rest[end:], true
+}
+
+// redactJSON replaces the identities of the string values of 'b', a JSON
+// document, leaving its keys and its formatting alone
+func (r *userRedactor) redactJSON(b []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(b); {
+		if b[i] != '"' {
+			out.WriteByte(b[i])
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(b) && b[end] != '"' {
+			if b[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end = min(end+1, len(b))
+		literal := b[i:end]
+		i = end
+		next := bytes.TrimLeft(b[end:], " \t\r\n")
+		var value string
+		if (len(next) != 0 && next[0] == ':') || json.Unmarshal(literal, &value) != nil {
+			out.Write(literal)
+			continue
+		}
+		redacted := r.redact(value)
+		if redacted == value {
+			out.Write(literal)
+			continue
+		}
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		enc.Encode(redacted)
+		// XXX Encode ends with a newline
+		out.Truncate(out.Len() - 1)
+	}
+	return out.Bytes()
+}
+
+func (r *userRedactor) rewriteMessage(msg []byte) []byte {
+	return []byte(r.redact(string(msg)))
+}
+
+// save writes the mapping file of 'r' to 'mapPath', readable by its owner
+// only
+func (r *userRedactor) save(mapPath string) error {
+	b, err := json.MarshalIndent(redactionMap{Salt: hex.EncodeToString(r.salt), Identities: r.identities}, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(mapPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(mapPath, b, 0o600)
+	if err != nil {
+		return err
+	}
+	// XXX WriteFile keeps the mode of an existing file
+	return os.Chmod(mapPath, 0o600)
+}
+
+// collectJSONIdentities adds the logins, emails and git identities of 'v', a
+// decoded JSON value. 'isLogin' is true if 'v' is under a login key
+func (r *userRedactor) collectJSONIdentities(v interface{}, isLogin bool) {
+	switch v := v.(type) {
+	case string:
+		if isLogin {
+			r.addLogin(v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.collectJSONIdentities(item, isLogin)
+		}
+	case map[string]interface{}:
+		// Git identities, e.g. the 'author' of an API commit object
+		name, _ := v["name"].(string)
+		email, hasEmail := v["email"].(string)
+		if hasEmail {
+			r.addIdent(name, email)
+		}
+		for key, item := range v {
+			r.collectJSONIdentities(item, redactionLoginKeys[key])
+		}
+	}
+}
+
+// collectMarkdownIdentities adds the logins of the lines of 'content', a
+// markdown issue, that name users
+func (r *userRedactor) collectMarkdownIdentities(content string) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		for _, prefix := range redactionMarkdownPrefixes {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			for _, login := range strings.Split(strings.TrimPrefix(line, prefix), ",") {
+				r.addLogin(login)
+			}
+		}
+		if strings.HasPrefix(line, "* Last edited: ") {
+			if i := strings.LastIndex(line, " by "); i >= 0 {
+				r.addLogin(line[i+len(" by "):])
+			}
+		}
+	}
+}
+
+// collectMirrorIdentities adds the authors, committers and taggers of the
+// mirror 'mirrorDir'
+func (r *userRedactor) collectMirrorIdentities(ctx context.Context, mirrorDir string) error {
+	out, err := runCommand(ctx, mirrorDir, nil, "git", "log", "--all", "--format=%an%x00%ae%n%cn%x00%ce")
+	if err != nil {
+		return err
+	}
+	tags, err := runCommand(ctx, mirrorDir, nil, "git", "for-each-ref", "refs/tags",
+		"--format=%(taggername)%00%(taggeremail:trim)")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(out+"\n"+tags, "\n") {
+		name, email, ok := strings.Cut(line, "\x00")
+		if ok {
+			r.addIdent(name, email)
+		}
+	}
+	return nil
+}
+
+// isBinary returns whether 'b' looks like binary content, the way git tells:
+// a NUL byte in its first 8000 bytes
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b[:min(len(b), 8000)], 0) >= 0
+}
+
+// isInDir returns whether 'path' is 'dir' or inside it. Both must be
+// absolute, cleaned paths
+func isInDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// redactBackup writes a copy of the backup 'backupDirPath' to 'outDirPath'
+// with every login, email and git author name replaced with a pseudonym, and
+// records who each pseudonym stands for in the mapping file 'mapPath'. If
+// 'mapPath' exists, its pseudonyms are kept, so a user is the same
+// pseudonym in every copy made with it. The backup itself is left untouched.
+//
+// XXX Mirrors are rewritten through 'git fast-export | git fast-import', like
+// -rewrite_emails. Other git repos, like -meta_git's history, and archives
+// can't be redacted and are left out. Other binary files, like attachments,
+// are copied as-is
+func redactBackup(ctx context.Context, backupDirPath, mapPath, outDirPath string) error {
+	print.DebugFunc()
+
+	// XXX Relative and absolute paths to the same file must compare equal:
+	// a mapping file copied along would undo the redaction, as its salt is
+	// enough to recompute every pseudonym from public logins
+	var err error
+	for _, path := range []*string{&backupDirPath, &mapPath, &outDirPath} {
+		*path, err = filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+	}
+	if util.IsDirectory(outDirPath) {
+		return print.Errorf("%s already exists: not overwriting it", outDirPath)
+	}
+	if isInDir(outDirPath, mapPath) {
+		return print.Errorf("-redact_users_map can't be in -redact_users_out: it undoes the redaction")
+	}
+	if isInDir(backupDirPath, mapPath) {
+		return print.Errorf("-redact_users_map can't be in -redact_users: it would be copied along, undoing the redaction")
+	}
+	r, err := loadUserRedactor(mapPath)
+	if err != nil {
+		return err
+	}
+	mirrors, err := findMirrors(backupDirPath)
+	if err != nil {
+		return err
+	}
+	isMirror := map[string]bool{}
+	for _, mirrorDir := range mirrors {
+		isMirror[mirrorDir] = true
+		err = r.collectMirrorIdentities(ctx, mirrorDir)
+		if err != nil {
+			return err
+		}
+	}
+	// skipDir tells the directories that aren't copied the same way
+	skipDir := func(path string) bool {
+		return isMirror[path] || filepath.Base(path) == ".git"
+	}
+	err = filepath.Walk(backupDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skipDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case filepath.Ext(path) == ".json":
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var v interface{}
+			// XXX Not every JSON file is an export file: anything that
+			// doesn't parse is still redacted as text
+			if json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), &v) == nil {
+				r.collectJSONIdentities(v, false)
+			}
+		case filepath.Ext(path) == ".md":
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			r.collectMarkdownIdentities(string(b))
+		case filepath.Base(path) == authorsFileName:
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(string(b), "\n") {
+				start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+				if start >= 0 && end > start {
+					r.addIdent(line[:start], line[start+1:end])
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = r.compile()
+	if err != nil {
+		return err
+	}
+
+	print.Warnf("Redacting users rewrites history: the commits of the redacted mirrors get new SHAs, " +
+		"and commit and tag signatures are dropped. Only push them to a new remote\n")
+	err = filepath.Walk(backupDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(backupDirPath, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(outDirPath, rel)
+		if info.IsDir() {
+			switch {
+			case isMirror[path]:
+				err = os.MkdirAll(filepath.Dir(dstPath), os.ModePerm)
+				if err != nil {
+					return err
+				}
+				err = rewriteMirrorEmails(ctx, path, dstPath, r)
+				if err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			case skipDir(path):
+				print.Warnf("Leaving %s out: its history can't be redacted\n", path)
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(dstPath, os.ModePerm)
+		}
+		if redactionArchiveExtensions[strings.ToLower(filepath.Ext(path))] {
+			print.Warnf("Leaving %s out: archives can't be redacted\n", path)
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isBinary(b):
+		case filepath.Ext(path) == ".json":
+			b = r.redactJSON(b)
+		default:
+			b = []byte(r.redact(string(b)))
+		}
+		return os.WriteFile(dstPath, b, info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+	err = r.save(mapPath)
+	if err != nil {
+		return err
+	}
+	print.Infof("Wrote a redacted copy of %s to %s, with %d identities. Who each pseudonym stands for is in %s\n",
+		backupDirPath, outDirPath, len(r.identities), mapPath)
+	return nil
+}
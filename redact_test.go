@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestRedactor returns a redactor, with a new salt, that knows the logins
+// 'logins' and the git identities 'idents', as name and email pairs
+func newTestRedactor(t *testing.T, logins []string, idents [][2]string) *userRedactor {
+	t.Helper()
+	r, err := loadUserRedactor(filepath.Join(t.TempDir(), "map.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, login := range logins {
+		r.addLogin(login)
+	}
+	for _, ident := range idents {
+		r.addIdent(ident[0], ident[1])
+	}
+	err = r.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRedact(t *testing.T) {
+	r := newTestRedactor(t, []string{"jane", "bob-smith"},
+		[][2]string{{"Jane Doe", "jane@corp.example"}, {"Jane", "jd@corp.example"}})
+	jane := r.pseudonyms[identityKey(identityLogin, "jane")]
+	bob := r.pseudonyms[identityKey(identityLogin, "bob-smith")]
+	janeEmail := r.pseudonyms[identityKey(identityEmail, "jane@corp.example")]
+	jdEmail := r.pseudonyms[identityKey(identityEmail, "jd@corp.example")]
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "login", in: "thanks @jane!", want: "thanks @" + jane + "!"},
+		{name: "logins are case-insensitive", in: "JANE", want: jane},
+		{name: "login with a dash", in: "cc bob-smith", want: "cc " + bob},
+		{name: "part of a longer token", in: "janet and bob-smithy", want: "janet and bob-smithy"},
+		{name: "email of a login is an email, not a login",
+			in: "mail jane@corp.example", want: "mail " + janeEmail + "@" + redactedEmailDomain},
+		{name: "unknown email keeps its domain, loses its logins",
+			in: "123+jane@users.noreply.github.com", want: "123+" + jane + "@users.noreply.github.com"},
+		{name: "name before the logins it contains", in: "by Jane Doe", want: "by " + janeEmail},
+		{name: "longest name first", in: "Jane Doe and Jane", want: janeEmail + " and " + jdEmail},
+		{name: "nothing to redact", in: "nothing here", want: "nothing here"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := r.redact(tc.in); got != tc.want {
+				t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	r := newTestRedactor(t, []string{"jane"}, nil)
+	jane := r.pseudonyms[identityKey(identityLogin, "jane")]
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "value", in: `{"author": "jane"}`, want: `{"author": "` + jane + `"}`},
+		{name: "keys are left alone", in: `{"jane": 1}`, want: `{"jane": 1}`},
+		{name: "escaped quote in a key", in: `{"a\"jane": "jane"}`, want: `{"a\"jane": "` + jane + `"}`},
+		{name: "escaped quotes in a value", in: `{"body": "say \"jane\""}`,
+			want: `{"body": "say \"` + jane + `\""}`},
+		{name: "escaped backslash before the closing quote", in: `{"body": "jane\\", "login": "jane"}`,
+			want: `{"body": "` + jane + `\\", "login": "` + jane + `"}`},
+		{name: "HTML isn't escaped", in: `{"body": "<b>jane</b> & co"}`,
+			want: `{"body": "<b>` + jane + `</b> & co"}`},
+		{name: "unchanged values keep their escapes", in: `{"body": "été"}`,
+			want: `{"body": "été"}`},
+		{name: "arrays and formatting", in: "[\n  \"jane\",\n  \"bob\"\n]", want: "[\n  \"" + jane + "\",\n  \"bob\"\n]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(r.redactJSON([]byte(tc.in)))
+			if got != tc.want {
+				t.Errorf("redactJSON(%s) = %s, want %s", tc.in, got, tc.want)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("redactJSON(%s) = %s, which isn't valid JSON", tc.in, got)
+			}
+		})
+	}
+}
+
+func TestCollectJSONIdentities(t *testing.T) {
+	r := newTestRedactor(t, nil, nil)
+	var v interface{}
+	err := json.Unmarshal([]byte(`{
+		"author": "jane",
+		"assignees": ["bob", "dependabot[bot]"],
+		"title": "not-a-login",
+		"commit": {"author": {"name": "Jane Doe", "email": "jane@corp.example"}},
+		"user": {"login": "alice", "id": 1}
+	}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.collectJSONIdentities(v, false)
+	var got []string
+	for key := range r.pseudonyms {
+		got = append(got, key)
+	}
+	want := []string{"email:jane@corp.example", "login:alice", "login:bob", "login:jane", "name:Jane Doe"}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %v, want %v", got, want)
+	}
+}
+
+func TestCollectMarkdownIdentities(t *testing.T) {
+	r := newTestRedactor(t, nil, nil)
+	r.collectMarkdownIdentities("* Author: jane\r\n* Assignees: bob, alice\r\n" +
+		"* Last edited: 2024-01-02 03:04:05 +0000 UTC by carol\r\n* Title: by dave\r\n\r\nAuthor: erin\r\n")
+	var got []string
+	for key := range r.pseudonyms {
+		got = append(got, key)
+	}
+	sort.Strings(got)
+	want := []string{"login:alice", "login:bob", "login:carol", "login:jane"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collected %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const refsFileName = "refs.json"
+
+// refSnapshot is every branch and tag of a repo with the commit it's at, as
+// written to 'refs.json'. Maps are written with sorted keys, so two snapshots
+// diff cleanly
+type refSnapshot struct {
+	Branches map[string]string `json:"branches"`
+	// Tags map to the commit they point to: annotated tags are peeled
+	Tags map[string]string `json:"tags"`
+	// DefaultBranch and Divergence are only filled with -branch_divergence.
+	// Divergence maps every other branch to how far it is from the default
+	// one
+	DefaultBranch string                      `json:"default_branch,omitempty"`
+	Divergence    map[string]branchDivergence `json:"divergence,omitempty"`
+}
+
+// branchDivergence is how many commits a branch has that the default branch
+// hasn't (Ahead), and the other way around (Behind)
+type branchDivergence struct {
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+}
+
+// readRefSnapshot returns the branches and tags of the mirror at 'mirrorDir'
+func readRefSnapshot(ctx context.Context, mirrorDir string) (*refSnapshot, error) {
+	out, err := runCommand(ctx, mirrorDir, nil, "git", "for-each-ref",
+		"--format=%(refname) %(objectname) %(*objectname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &refSnapshot{Branches: map[string]string{}, Tags: map[string]string{}}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ref, sha := fields[0], fields[1]
+		if len(fields) == 3 {
+			sha = fields[2]
+		}
+		switch {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			snapshot.Branches[strings.TrimPrefix(ref, "refs/heads/")] = sha
+		case strings.HasPrefix(ref, "refs/tags/"):
+			snapshot.Tags[strings.TrimPrefix(ref, "refs/tags/")] = sha
+		}
+	}
+	return snapshot, nil
+}
+
+// writeRepoRefs writes every branch and tag of 'repo', with the commit it's
+// at, to 'refs.json' in its meta directory, so what moved between two runs
+// is a diff away. It's read from the repo's mirror, which must already be
+// cloned
+func writeRepoRefs(ctx context.Context, backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	mirrorDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
+	snapshot, err := readRefSnapshot(ctx, mirrorDir)
+	if err != nil {
+		return err
+	}
+	if *branchDivergenceFlag {
+		err = fillBranchDivergence(ctx, mirrorDir, repo.GetDefaultBranch(), snapshot)
+		if err != nil {
+			return err
+		}
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d branches and %d tags of %s to %s\n",
+		len(snapshot.Branches), len(snapshot.Tags), *repo.Name, targetDir)
+	return writeJSONFile(filepath.Join(targetDir, refsFileName), snapshot)
+}
+
+// fillBranchDivergence fills how many commits each branch of 'snapshot' is
+// ahead of and behind 'defaultBranch' in the mirror at 'mirrorDir'. Nothing
+// is filled if the mirror doesn't have 'defaultBranch', e.g. for an empty
+// repo.
+//
+// XXX It's one 'git rev-list' per branch, on the mirror: no API call, but it
+// walks history back to where each branch forked
+func fillBranchDivergence(ctx context.Context, mirrorDir, defaultBranch string, snapshot *refSnapshot) error {
+	if _, ok := snapshot.Branches[defaultBranch]; !ok {
+		print.Debugf("No default branch %q in %s: not computing branch divergence\n", defaultBranch, mirrorDir)
+		return nil
+	}
+	snapshot.DefaultBranch = defaultBranch
+	snapshot.Divergence = map[string]branchDivergence{}
+	for branch := range snapshot.Branches {
+		if branch == defaultBranch {
+			continue
+		}
+		out, err := runCommand(ctx, mirrorDir, nil, "git", "rev-list", "--left-right", "--count",
+			"refs/heads/"+defaultBranch+"...refs/heads/"+branch)
+		if err != nil {
+			return err
+		}
+		var d branchDivergence
+		_, err = fmt.Sscanf(out, "%d %d", &d.Behind, &d.Ahead)
+		if err != nil {
+			return print.Errorf("unexpected 'git rev-list' output for %s: %q", branch, out)
+		}
+		snapshot.Divergence[branch] = d
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	releasesFileName = "releases.json"
+	// releaseAssetAttempts is how many times an asset is downloaded before
+	// giving up on a size mismatch
+	releaseAssetAttempts = 3
+)
+
+// releaseDirName returns the directory the assets of 'release' are stored in,
+// named after its tag
+func releaseDirName(release *github.RepositoryRelease) string {
+	if len(release.GetTagName()) == 0 {
+		return fmt.Sprintf("release_%d", release.GetID())
+	}
+	return strings.ReplaceAll(release.GetTagName(), "/", "_")
+}
+
+// downloadReleaseAsset uses 'client' and 'ctx' to download 'asset' of 'repo'
+// to 'path', reporting progress to 'onProgress'.
+//
+// XXX The asset goes to '<path>.partial', which is only renamed to 'path' once
+// its size, and its sha256 if the API has it, match. An interrupted download
+// is resumed from where it stopped, by the next attempt or the next run. A
+// mismatch starts over, up to releaseAssetAttempts times
+func downloadReleaseAsset(client *github.Client, ctx context.Context,
+	repo *github.Repository, asset *github.ReleaseAsset, path string,
+	onProgress func(done, total int64)) error {
+	var err error
+	for attempt := 1; attempt <= releaseAssetAttempts; attempt++ {
+		err = downloadReleaseAssetOnce(client, ctx, repo, asset, path, onProgress)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		print.Warnf("Attempt %d/%d at downloading %s failed: %v\n",
+			attempt, releaseAssetAttempts, asset.GetName(), err)
+	}
+	return err
+}
+
+func downloadReleaseAssetOnce(client *github.Client, ctx context.Context,
+	repo *github.Repository, asset *github.ReleaseAsset, path string,
+	onProgress func(done, total int64)) error {
+	partialPath := path + partialSuffix
+	size := int64(asset.GetSize())
+	// XXX Without a client to follow redirects, we get the signed URL the
+	// asset is served from, and download it ourselves so the request can have
+	// a Range. That URL is on another host, which must not get the API's
+	// Authorization header: http.DefaultClient doesn't have it
+	rc, redirectURL, err := client.Repositories.DownloadReleaseAsset(ctx, *repo.Owner.Login, *repo.Name,
+		asset.GetID(), nil)
+	if err != nil {
+		return err
+	}
+	if rc != nil {
+		// The asset was served directly, e.g. by some GitHub Enterprise
+		// Server setups: there's no resuming it
+		defer rc.Close()
+		fd, err := os.Create(partialPath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fd, &progressReader{ctx: ctx, r: rc, total: size, onProgress: onProgress})
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		err = fd.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		err = resumeDownload(ctx, http.DefaultClient, redirectURL, partialPath, size, onProgress)
+		if err != nil {
+			return err
+		}
+	}
+	if n := fileSize(partialPath); n != size {
+		os.Remove(partialPath)
+		return print.Errorf("downloaded %d bytes of %s, expected %d", n, asset.GetName(), size)
+	}
+	if digest := asset.GetDigest(); strings.HasPrefix(digest, "sha256:") {
+		sum, err := fileSHA256(partialPath)
+		if err != nil {
+			return err
+		}
+		if sum != strings.TrimPrefix(digest, "sha256:") {
+			os.Remove(partialPath)
+			return print.Errorf("%s has sha256 %s, expected %s", asset.GetName(), sum, digest)
+		}
+	}
+	return os.Rename(partialPath, path)
+}
+
+// backupRepoReleases uses 'client' and 'ctx' to write every release of 'repo'
+// to 'releases.json' in its releases directory, and to download their assets
+// to '<tag>/<asset name>' next to it. Assets already downloaded with the
+// right size are skipped
+func backupRepoReleases(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	opts := &github.ListOptions{PerPage: 100}
+	releases, err := paginate(ctx, "releases", func(page int) ([]*github.RepositoryRelease, *github.Response, error) {
+		opts.Page = page
+		return client.Repositories.ListReleases(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping releases of %s: %v\n", *repo.Name, err)
+			return nil
+		}
+		return err
+	}
+	if len(releases) == 0 {
+		return nil
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactReleases)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = writeJSONFile(filepath.Join(targetDir, releasesFileName), releases)
+	if err != nil {
+		return err
+	}
+	for _, release := range releases {
+		releaseDir := filepath.Join(targetDir, releaseDirName(release))
+		for _, asset := range release.Assets {
+			assetPath := filepath.Join(releaseDir, asset.GetName())
+			if info, err := os.Stat(assetPath); err == nil && info.Size() == int64(asset.GetSize()) {
+				print.Debugf("Skipping existing release asset %s\n", assetPath)
+				continue
+			}
+			err = checkWritePath(assetPath)
+			if err != nil {
+				return err
+			}
+			err = os.MkdirAll(releaseDir, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			print.Debugf("Backing up release asset %s to %s\n", asset.GetName(), assetPath)
+			err = downloadReleaseAsset(client, ctx, repo, asset, assetPath,
+				logProgress(release.GetTagName()+"/"+asset.GetName()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	formatMarkdown = "md"
+	formatJSON     = "json"
+	// formatEntries is used with -flatten_comments: each issue is written as
+	// a JSON array of chronological entries
+	formatEntries = "entries"
+)
+
+// newIssueExport converts 'issue' and its 'comments' to their exported form.
+// PR-only fields are filled separately
+func newIssueExport(issue *github.Issue, comments []*github.IssueComment) *export.Issue {
+	out := &export.Issue{
+		Number:            *issue.Number,
+		Title:             *issue.Title,
+		IsPullRequest:     issue.IsPullRequest(),
+		CreatedAt:         issue.CreatedAt.Time,
+		Author:            *issue.User.Login,
+		AuthorAssociation: issue.GetAuthorAssociation(),
+		Body:              issue.Body,
+		Comments:          []export.Comment{},
+	}
+	if issue.UpdatedAt != nil {
+		out.UpdatedAt = &issue.UpdatedAt.Time
+	}
+	if issue.Labels != nil {
+		out.Labels = []string{}
+		out.LabelDetails = []export.Label{}
+		for _, label := range issue.Labels {
+			out.Labels = append(out.Labels, label.GetName())
+			out.LabelDetails = append(out.LabelDetails, newLabelExport(label))
+		}
+	}
+	out.State = issue.GetState()
+	out.StateReason = issue.GetStateReason()
+	// XXX The API keeps 'closed_by' once an issue is reopened, and some
+	// providers keep 'closed_at' too: they're only recorded while it's closed
+	if out.State != "open" {
+		if issue.ClosedAt != nil {
+			out.ClosedAt = &issue.ClosedAt.Time
+		}
+		if issue.ClosedBy != nil {
+			out.ClosedBy = issue.ClosedBy.GetLogin()
+		}
+	}
+	if *reactionsFlag || *reactionsDetailedFlag {
+		out.Reactions = newReactionCounts(issue.Reactions)
+	}
+	out.Participants = issueParticipants(issue, comments)
+	for _, comment := range comments {
+		c := export.Comment{
+			Author:            *comment.User.Login,
+			AuthorAssociation: comment.GetAuthorAssociation(),
+			CreatedAt:         comment.CreatedAt.Time,
+			Body:              *comment.Body,
+		}
+		if comment.UpdatedAt != nil && !comment.UpdatedAt.Time.Equal(comment.CreatedAt.Time) {
+			c.UpdatedAt = &comment.UpdatedAt.Time
+		}
+		if *reactionsFlag || *reactionsDetailedFlag {
+			c.Reactions = newReactionCounts(comment.Reactions)
+		}
+		out.Comments = append(out.Comments, c)
+	}
+	return out
+}
+
+// issueParticipants returns the unique logins of the author of 'issue', of
+// the authors of its 'comments' and of its assignees
+func issueParticipants(issue *github.Issue, comments []*github.IssueComment) []string {
+	var participants []string
+	seen := map[string]bool{}
+	add := func(user *github.User) {
+		login := user.GetLogin()
+		if len(login) == 0 || seen[login] {
+			return
+		}
+		seen[login] = true
+		participants = append(participants, login)
+	}
+	add(issue.User)
+	for _, comment := range comments {
+		add(comment.User)
+	}
+	for _, assignee := range issue.Assignees {
+		add(assignee)
+	}
+	return participants
+}
+
+// issueFormat returns the format issues are written in, from -format and
+// -flatten_comments
+func issueFormat() string {
+	if *flattenCommentsFlag && *formatFlag == formatJSON {
+		return formatEntries
+	}
+	return *formatFlag
+}
+
+// mergeRequestFilePrefix starts the file names of GitLab's merge requests:
+// GitLab numbers them apart from issues, so issue #12 and merge request !12
+// would otherwise be written to the same file
+const mergeRequestFilePrefix = "mr_"
+
+// hasSeparatePullRequestNumbers returns whether the provider numbers PRs
+// apart from issues
+func hasSeparatePullRequestNumbers() bool {
+	return *providerFlag == providerGitLab
+}
+
+// issueFileStem returns the name, without extension, of the files of the
+// issue 'number', or of the PR 'number' if 'isPullRequest'
+func issueFileStem(number int, isPullRequest bool) string {
+	// XXX I think 6 digits is a pretty decent limit
+	stem := fmt.Sprintf("%06d", number)
+	if isPullRequest && hasSeparatePullRequestNumbers() {
+		return mergeRequestFilePrefix + stem
+	}
+	return stem
+}
+
+// issueFileName returns the name of the file the issue 'number', or the PR
+// 'number' if 'isPullRequest', is written to for 'format'
+func issueFileName(number int, isPullRequest bool, format string) string {
+	ext := format
+	if format == formatEntries {
+		ext = "entries.json"
+	}
+	return issueFileStem(number, isPullRequest) + "." + ext
+}
+
+// writeIssue writes 'issue' to 'path' in 'format'
+func writeIssue(path string, format string, issue *export.Issue) error {
+	switch format {
+	case formatJSON:
+		return writeJSONFile(path, issue)
+	case formatEntries:
+		return writeJSONFile(path, issue.Entries())
+	default:
+		return writeIssueMarkdown(path, issue)
+	}
+}
+
+// formatEdit returns when, and by whom if known, something was last edited
+func formatEdit(at time.Time, editor string) string {
+	if len(editor) == 0 {
+		return fmt.Sprintf("%v", at)
+	}
+	return fmt.Sprintf("%v by %s", at, editor)
+}
+
+func writeIssueMarkdown(path string, issue *export.Issue) error {
+	fd, err := createTextFile(path)
+	if err != nil {
+		return err
+	}
+	fd.WriteString(fmt.Sprintf("* Issue #%d: %s\r\n", issue.Number, issue.Title))
+	fd.WriteString(fmt.Sprintf("* Created at: %v\r\n", issue.CreatedAt))
+	if issue.UpdatedAt != nil {
+		fd.WriteString(fmt.Sprintf("* Updated at: %v\r\n", *issue.UpdatedAt))
+	}
+	fd.WriteString(fmt.Sprintf("* Author: %s\r\n", issue.Author))
+	if len(issue.AuthorAssociation) != 0 {
+		fd.WriteString(fmt.Sprintf("* Author association: %s\r\n", issue.AuthorAssociation))
+	}
+	if len(issue.Participants) != 0 {
+		fd.WriteString(fmt.Sprintf("* Participants: %s\r\n", strings.Join(issue.Participants, ", ")))
+	}
+	if issue.Labels != nil {
+		fd.WriteString("* Labels: ")
+		for i, label := range issue.Labels {
+			if i > 0 {
+				fd.WriteString(", ")
+			}
+			fd.WriteString(label)
+		}
+		fd.WriteString("\r\n")
+		for _, label := range issue.LabelDetails {
+			fd.WriteString(fmt.Sprintf("  * %s: #%s", label.Name, label.Color))
+			if len(label.Description) != 0 {
+				fd.WriteString(fmt.Sprintf(", %s", label.Description))
+			}
+			fd.WriteString("\r\n")
+		}
+	}
+	if issue.LastEditedAt != nil {
+		fd.WriteString(fmt.Sprintf("* Last edited: %s\r\n", formatEdit(*issue.LastEditedAt, issue.Editor)))
+	}
+	if len(issue.State) != 0 {
+		if len(issue.StateReason) != 0 {
+			fd.WriteString(fmt.Sprintf("* State: %s (%s)\r\n", issue.State, issue.StateReason))
+		} else {
+			fd.WriteString(fmt.Sprintf("* State: %s\r\n", issue.State))
+		}
+	}
+	// XXX The API can return who closed an issue without when, or the other
+	// way around
+	if issue.ClosedAt != nil {
+		fd.WriteString(fmt.Sprintf("* Closed at: %s\r\n", *issue.ClosedAt))
+	}
+	if len(issue.ClosedBy) != 0 {
+		fd.WriteString(fmt.Sprintf("* Closed by: %s\r\n", issue.ClosedBy))
+	}
+	if issue.IsPullRequest {
+		writePullRequestDetailsMarkdown(fd, issue)
+		writePullRequestReviewersMarkdown(fd, issue)
+	}
+	writeIssueSubscribersMarkdown(fd, issue)
+	writeReactionsMarkdown(fd, issue.Reactions, issue.ReactionUsers)
+	writeIssueHierarchyMarkdown(fd, issue)
+	writeIssueDuplicatesMarkdown(fd, issue)
+	fd.WriteString("\r\n")
+	if issue.Body != nil {
+		fd.WriteString("## Description\r\n\r\n")
+		fd.WriteString(fmt.Sprintf("%s\r\n\r\n", *issue.Body))
+	}
+	for i, comment := range issue.Comments {
+		// XXX Start counting from 1, not 0
+		fd.WriteString(fmt.Sprintf("## Comment #%d\r\n\r\n", i+1))
+		fd.WriteString(fmt.Sprintf("* By %s\r\n", comment.Author))
+		if len(comment.AuthorAssociation) != 0 {
+			fd.WriteString(fmt.Sprintf("* Author association: %s\r\n", comment.AuthorAssociation))
+		}
+		fd.WriteString(fmt.Sprintf("* At %v\r\n", comment.CreatedAt))
+		if comment.LastEditedAt != nil {
+			fd.WriteString(fmt.Sprintf("* Last edited: %s\r\n", formatEdit(*comment.LastEditedAt, comment.Editor)))
+		} else if comment.UpdatedAt != nil {
+			fd.WriteString(fmt.Sprintf("* Updated at: %v\r\n", *comment.UpdatedAt))
+		}
+		writeReactionsMarkdown(fd, comment.Reactions, comment.ReactionUsers)
+		writeCommentBodyMarkdown(fd, comment)
+	}
+	writeReviewThreadsMarkdown(fd, issue)
+	writePullRequestCommitsMarkdown(fd, issue)
+	return fd.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const restoreHintFileName = "restore_hint.json"
+
+// restoreHint documents how to turn a repo's mirror back into a live repo.
+// It's written to 'restore_hint.json' in the repo's meta directory
+type restoreHint struct {
+	SSHURL   string `json:"ssh_url"`
+	CloneURL string `json:"clone_url"`
+	// DefaultBranch is the repo's default branch according to the API, and
+	// MirrorHEAD the branch the mirror's HEAD points to. They only differ if
+	// the default branch changed since the mirror was first cloned
+	DefaultBranch string `json:"default_branch"`
+	MirrorHEAD    string `json:"mirror_head"`
+	// MirrorPath is where the mirror is, relative to the backup directory
+	MirrorPath string `json:"mirror_path"`
+	// PushCommand pushes every ref of the mirror to a new, empty remote. It's
+	// meant to be run from the backup directory, after replacing
+	// <new-remote-url>
+	PushCommand string `json:"push_command"`
+}
+
+// writeRestoreHint writes the restore hint of 'repo', whose mirror must
+// already be cloned, to its meta directory
+func writeRestoreHint(ctx context.Context, backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	mirrorDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
+	mirrorPath, err := filepath.Rel(backupDirPath, mirrorDir)
+	if err != nil {
+		return err
+	}
+	// XXX This fails on a mirror whose HEAD is detached, which 'git clone'
+	// never produces
+	head, err := runCommand(ctx, mirrorDir, nil, "git", "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+	mirrorPath = filepath.ToSlash(mirrorPath)
+	hint := restoreHint{
+		SSHURL:        repo.GetSSHURL(),
+		CloneURL:      repo.GetCloneURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		MirrorHEAD:    head,
+		MirrorPath:    mirrorPath,
+		PushCommand:   "git -C " + shellQuote(mirrorPath) + " push --mirror <new-remote-url>",
+	}
+
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, restoreHintFileName), hint)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// repoResult is what a backup step of a repo amounted to. Each step only
+// fills the fields it knows about: see add
+type repoResult struct {
+	// IssueCount and CommentCount are the issues and PRs written, and the
+	// comments fetched for them
+	IssueCount   int
+	CommentCount int
+	// BytesCloned is the size of the mirror on disk, if it was cloned by this
+	// run, or how much it grew, if it was updated with -update_mirrors
+	BytesCloned int64
+	Duration    time.Duration
+}
+
+// add returns the sum of 'r' and 'other'
+func (r repoResult) add(other repoResult) repoResult {
+	return repoResult{
+		IssueCount:   r.IssueCount + other.IssueCount,
+		CommentCount: r.CommentCount + other.CommentCount,
+		BytesCloned:  r.BytesCloned + other.BytesCloned,
+		Duration:     r.Duration + other.Duration,
+	}
+}
+
+// dirSize returns the total size of the files under 'dir'
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
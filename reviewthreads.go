@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// XXX A thread's comments aren't paginated: 100 is way more than threads have
+// in practice
+const reviewThreadsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 50, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          path
+          line
+          startLine
+          originalLine
+          diffSide
+          isResolved
+          isOutdated
+          resolvedBy { login }
+          comments(first: 100) {
+            nodes {
+              author { login }
+              authorAssociation
+              body
+              createdAt
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type graphQLReviewThread struct {
+	Path         string `json:"path"`
+	Line         *int   `json:"line"`
+	StartLine    *int   `json:"startLine"`
+	OriginalLine *int   `json:"originalLine"`
+	DiffSide     string `json:"diffSide"`
+	IsResolved   bool   `json:"isResolved"`
+	IsOutdated   bool   `json:"isOutdated"`
+	ResolvedBy   *struct {
+		Login string `json:"login"`
+	} `json:"resolvedBy"`
+	Comments struct {
+		Nodes []struct {
+			Author *struct {
+				Login string `json:"login"`
+			} `json:"author"`
+			AuthorAssociation string    `json:"authorAssociation"`
+			Body              string    `json:"body"`
+			CreatedAt         time.Time `json:"createdAt"`
+		} `json:"nodes"`
+	} `json:"comments"`
+}
+
+func (t graphQLReviewThread) toExport() export.ReviewThread {
+	out := export.ReviewThread{
+		Path:       t.Path,
+		Line:       t.Line,
+		StartLine:  t.StartLine,
+		Side:       t.DiffSide,
+		IsResolved: t.IsResolved,
+		IsOutdated: t.IsOutdated,
+		Comments:   []export.Comment{},
+	}
+	// XXX Outdated threads are on lines that don't exist anymore: fall back
+	// to the line they were originally on
+	if out.Line == nil {
+		out.Line = t.OriginalLine
+	}
+	if t.ResolvedBy != nil {
+		out.ResolvedBy = t.ResolvedBy.Login
+	}
+	for _, comment := range t.Comments.Nodes {
+		c := export.Comment{
+			AuthorAssociation: comment.AuthorAssociation,
+			CreatedAt:         comment.CreatedAt,
+			Body:              comment.Body,
+		}
+		// Deleted users have no author
+		if comment.Author != nil {
+			c.Author = comment.Author.Login
+		}
+		out.Comments = append(out.Comments, c)
+	}
+	return out
+}
+
+// fetchReviewThreads uses 'client' and 'ctx' to fill the review threads of
+// the PR 'issue' of 'repo' into 'out', sorted by file and line.
+//
+// XXX The REST API lists review comments but not whether their thread is
+// resolved, hence GraphQL: one query per 50 threads of every PR
+func fetchReviewThreads(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	threads := []export.ReviewThread{}
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						PageInfo graphQLPageInfo       `json:"pageInfo"`
+						Nodes    []graphQLReviewThread `json:"nodes"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		err := queryGraphQL(client, ctx, reviewThreadsQuery, map[string]interface{}{
+			"owner":  *repo.Owner.Login,
+			"name":   *repo.Name,
+			"number": *issue.Number,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Debugf("Skipping review threads of PR #%d: %v\n", *issue.Number, err)
+				return nil
+			}
+			return err
+		}
+		reviewThreads := data.Repository.PullRequest.ReviewThreads
+		for _, thread := range reviewThreads.Nodes {
+			threads = append(threads, thread.toExport())
+		}
+		if !reviewThreads.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &reviewThreads.PageInfo.EndCursor
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		if threads[i].Path != threads[j].Path {
+			return threads[i].Path < threads[j].Path
+		}
+		return threads[i].GetLine() < threads[j].GetLine()
+	})
+	out.ReviewThreads = threads
+	return nil
+}
+
+// writeReviewThreadsMarkdown writes the review threads of 'issue' to 'fd',
+// grouped by file
+func writeReviewThreadsMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if len(issue.ReviewThreads) == 0 {
+		return
+	}
+	fd.WriteString("## Review threads\r\n\r\n")
+	path := ""
+	for i, thread := range issue.ReviewThreads {
+		if i == 0 || thread.Path != path {
+			path = thread.Path
+			fd.WriteString(fmt.Sprintf("### %s\r\n\r\n", path))
+		}
+		location := "file"
+		if thread.Line != nil {
+			location = fmt.Sprintf("line %d", *thread.Line)
+			if thread.StartLine != nil && *thread.StartLine != *thread.Line {
+				location = fmt.Sprintf("lines %d-%d", *thread.StartLine, *thread.Line)
+			}
+		}
+		state := "unresolved"
+		if thread.IsResolved {
+			state = "resolved"
+			if len(thread.ResolvedBy) != 0 {
+				state += " by " + thread.ResolvedBy
+			}
+		}
+		if thread.IsOutdated {
+			state += ", outdated"
+		}
+		fd.WriteString(fmt.Sprintf("#### On %s (%s)\r\n\r\n", location, state))
+		for _, comment := range thread.Comments {
+			fd.WriteString(fmt.Sprintf("* %s at %v:\r\n\r\n", comment.Author, comment.CreatedAt))
+			fd.WriteString(fmt.Sprintf("%s\r\n\r\n", comment.Body))
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+// emailMap maps author and committer emails to the ones they're rewritten to
+type emailMap struct {
+	// emails maps a lowercased email to its replacement
+	emails map[string]string
+	// domains maps a lowercased '@domain' to its replacement, for emails
+	// that aren't in 'emails'
+	domains map[string]string
+}
+
+// readEmailMap reads the mapping file at 'path'. Every line is an old email
+// and its replacement, separated by spaces, e.g.
+//
+//	jane@corp.example jane@example.com
+//	@corp.example @users.noreply.github.com
+//
+// Entries starting with '@' map every email of a domain. Empty lines and lines
+// starting with '#' are ignored
+func readEmailMap(path string) (*emailMap, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &emailMap{emails: map[string]string{}, domains: map[string]string{}}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		// XXX Both must have an '@': a login, e.g. from a list of members,
+		// would never match an email and be silently ignored
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "@") != strings.HasPrefix(fields[1], "@") ||
+			!strings.Contains(fields[0], "@") || !strings.Contains(fields[1], "@") {
+			return nil, print.Errorf("%s:%d: expected '<old email> <new email>' or '@<old domain> @<new domain>', got %q",
+				path, i+1, line)
+		}
+		if strings.HasPrefix(fields[0], "@") {
+			m.domains[strings.ToLower(fields[0])] = fields[1]
+		} else {
+			m.emails[strings.ToLower(fields[0])] = fields[1]
+		}
+	}
+	if len(m.emails) == 0 && len(m.domains) == 0 {
+		return nil, print.Errorf("%s has no mappings", path)
+	}
+	return m, nil
+}
+
+// identRewriter rewrites the identities of a 'git fast-export' stream
+type identRewriter interface {
+	// rewriteIdentLine rewrites an 'author', 'committer' or 'tagger' line:
+	// '<kind> Name <email> <when>'. It returns whether it changed anything
+	rewriteIdentLine(line string) (string, bool)
+	// rewriteMessage rewrites the message of a commit or tag
+	rewriteMessage(msg []byte) []byte
+}
+
+// rewrite returns what 'email' maps to, and whether it's mapped at all
+func (m *emailMap) rewrite(email string) (string, bool) {
+	lower := strings.ToLower(email)
+	if to, ok := m.emails[lower]; ok {
+		return to, true
+	}
+	i := strings.LastIndex(lower, "@")
+	if i < 0 {
+		return email, false
+	}
+	if to, ok := m.domains[lower[i:]]; ok {
+		return email[:i] + to, true
+	}
+	return email, false
+}
+
+// rewriteIdentLine rewrites the email of 'line', an 'author', 'committer' or
+// 'tagger' line of a fast-export stream: '<kind> Name <email> <when>'
+func (m *emailMap) rewriteIdentLine(line string) (string, bool) {
+	start := strings.Index(line, "<")
+	end := strings.Index(line, ">")
+	if start < 0 || end < start {
+		return line, false
+	}
+	to, ok := m.rewrite(line[start+1 : end])
+	if !ok {
+		return line, false
+	}
+	return line[:start+1] + to + line[end:], true
+}
+
+// rewriteMessage leaves 'msg' alone: only the emails of ident lines are
+// rewritten
+func (m *emailMap) rewriteMessage(msg []byte) []byte {
+	return msg
+}
+
+// rewriteFastExport copies the 'git fast-export' stream 'r' to 'w', rewriting
+// its author, committer and tagger lines, and its commit and tag messages,
+// with 'm'. It returns how many ident lines were rewritten.
+//
+// XXX Blobs are copied byte for byte without being looked at, so a file that
+// happens to contain an 'author' line is left alone
+func rewriteFastExport(r io.Reader, w io.Writer, m identRewriter) (int, error) {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	rewritten := 0
+	// inMessage is true while the 'data' block to come is the message of a
+	// commit or tag, rather than a blob
+	inMessage := false
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) != 0 {
+			switch {
+			case strings.HasPrefix(line, "data "):
+				n, convErr := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "data ")), 10, 64)
+				if convErr != nil {
+					return rewritten, print.Errorf("unexpected fast-export data line %q", line)
+				}
+				if !inMessage {
+					_, err = bw.WriteString(line)
+					if err != nil {
+						return rewritten, err
+					}
+					_, err = io.CopyN(bw, br, n)
+					if err != nil {
+						return rewritten, err
+					}
+					continue
+				}
+				inMessage = false
+				msg := make([]byte, n)
+				_, err = io.ReadFull(br, msg)
+				if err != nil {
+					return rewritten, err
+				}
+				msg = m.rewriteMessage(msg)
+				_, err = bw.WriteString("data " + strconv.Itoa(len(msg)) + "\n")
+				if err != nil {
+					return rewritten, err
+				}
+				_, err = bw.Write(msg)
+				if err != nil {
+					return rewritten, err
+				}
+				continue
+			case strings.HasPrefix(line, "commit "), strings.HasPrefix(line, "tag "):
+				inMessage = true
+			case strings.HasPrefix(line, "blob"):
+				inMessage = false
+			case strings.HasPrefix(line, "author "), strings.HasPrefix(line, "committer "),
+				strings.HasPrefix(line, "tagger "):
+				var ok bool
+				line, ok = m.rewriteIdentLine(line)
+				if ok {
+					rewritten++
+				}
+			}
+			_, writeErr := bw.WriteString(line)
+			if writeErr != nil {
+				return rewritten, writeErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rewritten, err
+		}
+	}
+	return rewritten, bw.Flush()
+}
+
+// rewriteMirrorEmails writes a copy of the mirror 'srcDir' to 'dstDir', a new
+// bare repo, with the author, committer and tagger identities, and the commit
+// and tag messages, rewritten by 'm'.
+//
+// XXX This goes through 'git fast-export | git fast-import', so every
+// rewritten commit, and all of its descendants, get a new SHA, and signatures
+// of commits and tags are dropped
+func rewriteMirrorEmails(ctx context.Context, srcDir, dstDir string, m identRewriter) error {
+	print.DebugFunc()
+
+	_, err := runCommand(ctx, "", nil, "git", "init", "--bare", "--quiet", dstDir)
+	if err != nil {
+		return err
+	}
+	var exportErr, importErr bytes.Buffer
+	exportCmd := exec.CommandContext(ctx, "git", "fast-export", "--all",
+		"--signed-tags=strip", "--tag-of-filtered-object=rewrite")
+	exportCmd.Dir = srcDir
+	exportCmd.Stderr = &exportErr
+	exportOut, err := exportCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	importCmd := exec.CommandContext(ctx, "git", "fast-import", "--quiet")
+	importCmd.Dir = dstDir
+	importCmd.Stderr = &importErr
+	importIn, err := importCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	print.Debugf("Executing command: %s | %s\n", exportCmd.String(), importCmd.String())
+	err = exportCmd.Start()
+	if err != nil {
+		return err
+	}
+	err = importCmd.Start()
+	if err != nil {
+		exportCmd.Process.Kill()
+		exportCmd.Wait()
+		return err
+	}
+	rewritten, err := rewriteFastExport(exportOut, importIn, m)
+	importIn.Close()
+	if err != nil {
+		exportCmd.Process.Kill()
+	}
+	exportWaitErr := exportCmd.Wait()
+	importWaitErr := importCmd.Wait()
+	if err != nil {
+		return err
+	}
+	if exportWaitErr != nil {
+		return print.Errorf("git fast-export in %s failed: %v: %s", srcDir, exportWaitErr,
+			strings.TrimSpace(exportErr.String()))
+	}
+	if importWaitErr != nil {
+		return print.Errorf("git fast-import in %s failed: %v: %s", dstDir, importWaitErr,
+			strings.TrimSpace(importErr.String()))
+	}
+
+	// fast-import doesn't touch HEAD: point it at the same branch as the
+	// mirror's
+	head, err := runCommand(ctx, srcDir, nil, "git", "symbolic-ref", "HEAD")
+	if err == nil {
+		_, err = runCommand(ctx, dstDir, nil, "git", "symbolic-ref", "HEAD", head)
+		if err != nil {
+			return err
+		}
+	}
+	print.Infof("Rewrote %d author, committer and tagger lines from %s to %s\n", rewritten, srcDir, dstDir)
+	return nil
+}
+
+// findMirrors returns the git mirrors of the backup 'backupDirPath', by repo
+// name, in either layout
+func findMirrors(backupDirPath string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	err := filepath.Walk(backupDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || filepath.Ext(path) != ".git" {
+			return nil
+		}
+		// XXX -meta_git's '__meta.git' is a working directory, not a mirror
+		if !util.IsFile(filepath.Join(path, "HEAD")) || !util.IsDirectory(filepath.Join(path, "objects")) {
+			return filepath.SkipDir
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".git")
+		if filepath.Base(path) == "code.git" {
+			name = filepath.Base(filepath.Dir(path))
+		}
+		mirrors[name] = path
+		return filepath.SkipDir
+	})
+	return mirrors, err
+}
+
+// rewriteBackupEmails writes a copy of every mirror of the backup
+// 'backupDirPath' to '<outDirPath>/<name>.git', with the emails of the
+// mapping file 'mapPath' rewritten. The backup itself is left untouched
+func rewriteBackupEmails(ctx context.Context, backupDirPath, mapPath, outDirPath string) error {
+	print.DebugFunc()
+
+	m, err := readEmailMap(mapPath)
+	if err != nil {
+		return err
+	}
+	mirrors, err := findMirrors(backupDirPath)
+	if err != nil {
+		return err
+	}
+	if len(mirrors) == 0 {
+		return print.Errorf("no git mirrors found in %s", backupDirPath)
+	}
+	print.Warnf("Rewriting emails rewrites history: the commits of the rewritten mirrors get new SHAs, " +
+		"and commit and tag signatures are dropped. Only push them to a new remote\n")
+	err = os.MkdirAll(outDirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name := range mirrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dstDir := filepath.Join(outDirPath, name+".git")
+		if util.IsDirectory(dstDir) {
+			return print.Errorf("%s already exists: not overwriting it", dstDir)
+		}
+		err = rewriteMirrorEmails(ctx, mirrors[name], dstDir, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadEmailMap(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		content     string
+		wantEmails  map[string]string
+		wantDomains map[string]string
+		wantErr     bool
+	}{
+		{
+			name:        "emails and domains",
+			content:     "# comment\n\nJane@Corp.example  jane@example.com\r\n@corp.example @users.noreply.github.com\n",
+			wantEmails:  map[string]string{"jane@corp.example": "jane@example.com"},
+			wantDomains: map[string]string{"@corp.example": "@users.noreply.github.com"},
+		},
+		{name: "login instead of an old email", content: "jane jane@example.com\n", wantErr: true},
+		{name: "login instead of a new email", content: "jane@corp.example jane\n", wantErr: true},
+		{name: "email mapped to a domain", content: "jane@corp.example @example.com\n", wantErr: true},
+		{name: "domain mapped to an email", content: "@corp.example jane@example.com\n", wantErr: true},
+		{name: "too many fields", content: "a@b c@d e@f\n", wantErr: true},
+		{name: "no mappings", content: "# nothing\n\n", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "emails.txt")
+			err := os.WriteFile(path, []byte(tc.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := readEmailMap(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("readEmailMap() = %+v, want an error", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readEmailMap(): %v", err)
+			}
+			if !reflect.DeepEqual(m.emails, tc.wantEmails) || !reflect.DeepEqual(m.domains, tc.wantDomains) {
+				t.Errorf("readEmailMap() = %v %v, want %v %v", m.emails, m.domains, tc.wantEmails, tc.wantDomains)
+			}
+		})
+	}
+}
+
+func TestEmailMapRewrite(t *testing.T) {
+	m := &emailMap{
+		emails:  map[string]string{"jane@corp.example": "jane@example.com"},
+		domains: map[string]string{"@corp.example": "@example.org"},
+	}
+	for _, tc := range []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{in: "JANE@corp.example", want: "jane@example.com", wantOK: true},
+		{in: "Bob@Corp.Example", want: "Bob@example.org", wantOK: true},
+		{in: "bob@other.example", want: "bob@other.example"},
+		{in: "bob@sub.corp.example", want: "bob@sub.corp.example"},
+		{in: "jane", want: "jane"},
+	} {
+		got, ok := m.rewrite(tc.in)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("rewrite(%q) = %q, %t, want %q, %t", tc.in, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+// upperMessages rewrites ident lines and messages to upper case, to tell
+// what rewriteFastExport handed to it
+type upperMessages struct{}
+
+func (upperMessages) rewriteIdentLine(line string) (string, bool) {
+	return strings.ToUpper(line), true
+}
+
+func (upperMessages) rewriteMessage(msg []byte) []byte {
+	return []byte(strings.ToUpper(string(msg)) + "!")
+}
+
+func TestRewriteFastExport(t *testing.T) {
+	// A blob whose content looks like the stream itself: it must be copied
+	// as-is, and its size is what tells where it ends
+	blob := "author x <x@y> 0 +0000\ndata 3\ncommit refs/heads/fake\n"
+	in := "blob\nmark :1\ndata " + strconv.Itoa(len(blob)) + "\n" + blob + "\n" +
+		"commit refs/heads/main\nmark :2\n" +
+		"author Jane <jane@corp.example> 1 +0000\n" +
+		"committer Jane <jane@corp.example> 1 +0000\n" +
+		"data 12\nfix\ndata 2\n\n" +
+		"M 100644 :1 file\n\n" +
+		"tag v1\nfrom :2\ntagger Jane <jane@corp.example> 1 +0000\ndata 4\nv1\n\n" +
+		"done\n"
+	want := "blob\nmark :1\ndata " + strconv.Itoa(len(blob)) + "\n" + blob + "\n" +
+		"commit refs/heads/main\nmark :2\n" +
+		"AUTHOR JANE <JANE@CORP.EXAMPLE> 1 +0000\n" +
+		"COMMITTER JANE <JANE@CORP.EXAMPLE> 1 +0000\n" +
+		"data 13\nFIX\nDATA 2\n\n!" +
+		"M 100644 :1 file\n\n" +
+		"tag v1\nfrom :2\nTAGGER JANE <JANE@CORP.EXAMPLE> 1 +0000\ndata 5\nV1\n\n!" +
+		"done\n"
+	var out strings.Builder
+	n, err := rewriteFastExport(strings.NewReader(in), &out, upperMessages{})
+	if err != nil {
+		t.Fatalf("rewriteFastExport(): %v", err)
+	}
+	if n != 3 {
+		t.Errorf("rewriteFastExport() rewrote %d ident lines, want 3", n)
+	}
+	if out.String() != want {
+		t.Errorf("rewriteFastExport() wrote\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestRewriteFastExportTruncated(t *testing.T) {
+	var out strings.Builder
+	for _, in := range []string{"blob\ndata 10\nshort", "commit refs/heads/main\ndata 10\nshort", "data x\n"} {
+		_, err := rewriteFastExport(strings.NewReader(in), &out, upperMessages{})
+		if err == nil {
+			t.Errorf("rewriteFastExport(%q) succeeded, want an error", in)
+		}
+	}
+}
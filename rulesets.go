@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const rulesetsFileName = "rulesets.json"
+
+// fetchRulesets calls 'get' for every ruleset in 'rulesets', which only have
+// a summary, to get their conditions, rules and enforcement
+func fetchRulesets(ctx context.Context, rulesets []*github.RepositoryRuleset,
+	get func(id int64) (*github.RepositoryRuleset, *github.Response, error)) ([]*github.RepositoryRuleset, error) {
+	full := []*github.RepositoryRuleset{}
+	for _, ruleset := range rulesets {
+		r, resp, err := get(ruleset.GetID())
+		if err != nil {
+			return nil, err
+		}
+		full = append(full, r)
+		err = waitForRateLimit(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return full, nil
+}
+
+// backupRepoRulesets uses 'client' and 'ctx' to write the rulesets of 'repo',
+// with their conditions, rules and enforcement, to 'rulesets.json' in its meta
+// directory.
+//
+// XXX Only the repo's own rulesets are written: the org-level ones that apply
+// to it are in the org's rulesets. It costs one API call per ruleset
+func backupRepoRulesets(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	opts := &github.RepositoryListRulesetsOptions{
+		IncludesParents: github.Ptr(false),
+		ListOptions:     github.ListOptions{PerPage: 100},
+	}
+	rulesets, err := paginate(ctx, "rulesets", func(page int) ([]*github.RepositoryRuleset, *github.Response, error) {
+		opts.ListOptions.Page = page
+		return client.Repositories.GetAllRulesets(ctx, owner, name, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping rulesets of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	full, err := fetchRulesets(ctx, rulesets, func(id int64) (*github.RepositoryRuleset, *github.Response, error) {
+		return client.Repositories.GetRuleset(ctx, owner, name, id, false)
+	})
+	if err != nil {
+		return err
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, rulesetsFileName), full)
+}
+
+// backupOrgRulesets uses 'client' and 'ctx' to write the rulesets of 'org',
+// which apply to some or all of its repos, to 'org__meta/rulesets.json'
+func backupOrgRulesets(client *github.Client, ctx context.Context, backupDirPath, org string) error {
+	print.DebugFunc()
+
+	opts := &github.ListOptions{PerPage: 100}
+	rulesets, err := paginate(ctx, "org rulesets", func(page int) ([]*github.RepositoryRuleset, *github.Response, error) {
+		opts.Page = page
+		return client.Organizations.GetAllRepositoryRulesets(ctx, org, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Warnf("Skipping rulesets of %s: %v\n", org, err)
+			return nil
+		}
+		return err
+	}
+	full, err := fetchRulesets(ctx, rulesets, func(id int64) (*github.RepositoryRuleset, *github.Response, error) {
+		return client.Organizations.GetRepositoryRuleset(ctx, org, id)
+	})
+	if err != nil {
+		return err
+	}
+	targetDir := orgArtifactPath(backupDirPath, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, rulesetsFileName), full)
+}
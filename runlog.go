@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/afjoseph/commongo/util"
+	"github.com/fatih/color"
+)
+
+const runLogFileName = "run.log"
+
+// ansiEscapeRegexp matches the color codes 'print' wraps its output in
+var ansiEscapeRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ansiStripWriter writes to 'w' with the color codes removed, so the log file
+// reads as plain text. An escape sequence split across two writes is held
+// back until it's complete
+type ansiStripWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (s *ansiStripWriter) Write(p []byte) (int, error) {
+	b := append(s.pending, p...)
+	s.pending = nil
+	if i := bytes.LastIndexByte(b, 0x1b); i >= 0 && !ansiEscapeRegexp.Match(b[i:]) {
+		s.pending = append([]byte{}, b[i:]...)
+		b = b[:i]
+	}
+	_, err := s.w.Write(ansiEscapeRegexp.ReplaceAll(b, nil))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// runLogSecrets are the tokens that are never written to a run log, even if
+// something prints them. They're registered with registerRunLogSecret
+var (
+	runLogSecretsMu sync.Mutex
+	runLogSecrets   [][]byte
+)
+
+// registerRunLogSecret makes run logs write 'secret' as 'REDACTED'
+func registerRunLogSecret(secret string) {
+	if len(secret) == 0 {
+		return
+	}
+	runLogSecretsMu.Lock()
+	defer runLogSecretsMu.Unlock()
+	runLogSecrets = append(runLogSecrets, []byte(secret))
+}
+
+// secretScrubWriter writes to 'w' with the registered secrets replaced.
+//
+// XXX It works on what each write holds: 'print' writes a line at once, so a
+// secret isn't split across two writes
+type secretScrubWriter struct {
+	w io.Writer
+}
+
+func (s *secretScrubWriter) Write(p []byte) (int, error) {
+	b := p
+	runLogSecretsMu.Lock()
+	for _, secret := range runLogSecrets {
+		b = bytes.ReplaceAll(b, secret, []byte(redactedSecretPlaceholder))
+	}
+	runLogSecretsMu.Unlock()
+	_, err := s.w.Write(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// runLog tees everything written to stdout into a file
+type runLog struct {
+	file   *os.File
+	stdout *os.File
+	w      *os.File
+	done   chan struct{}
+}
+
+// activeRunLog is the run log started by startRunLog, if any
+var activeRunLog *runLog
+
+// rotateRunLogs renames the 'run.log' of 'backupDirPath' to 'run.log.1',
+// 'run.log.1' to 'run.log.2', and so on, and deletes the ones past 'keep'
+func rotateRunLogs(backupDirPath string, keep int) error {
+	base := filepath.Join(backupDirPath, runLogFileName)
+	rotated := func(n int) string {
+		if n == 0 {
+			return base
+		}
+		return fmt.Sprintf("%s.%d", base, n)
+	}
+	// Delete the ones past 'keep', including the ones left over from a run
+	// with a higher -run_logs_keep
+	for n := keep; util.IsFile(rotated(n)); n++ {
+		err := os.Remove(rotated(n))
+		if err != nil {
+			return err
+		}
+	}
+	for n := keep - 1; n >= 0; n-- {
+		if !util.IsFile(rotated(n)) {
+			continue
+		}
+		err := os.Rename(rotated(n), rotated(n+1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startRunLog rotates the run logs of 'backupDirPath', keeping 'keep' of the
+// previous ones, and tees stdout, where 'print' writes, into a new 'run.log'.
+// A run log that's already started, e.g. the previous org's in a multi-org
+// run, is stopped first.
+//
+// XXX 'print' writes to os.Stdout directly, so stdout itself is swapped for a
+// pipe that's copied to both the terminal and the file through an
+// io.MultiWriter. Whatever was printed before the backup directory was known
+// isn't in the log
+func startRunLog(backupDirPath string, keep int) error {
+	stopRunLog()
+	err := os.MkdirAll(backupDirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = rotateRunLogs(backupDirPath, keep)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(backupDirPath, runLogFileName))
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l := &runLog{file: file, stdout: os.Stdout, w: w, done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		out := []io.Writer{&mutableWriter{w: l.stdout}, &ansiStripWriter{w: &secretScrubWriter{w: file}}}
+		if progress != nil {
+			out = append(out, &ansiStripWriter{w: progress})
+		}
+		io.Copy(io.MultiWriter(out...), r)
+		r.Close()
+	}()
+	os.Stdout = w
+	// Colors go through the pipe too, or they'd reach the terminal out of
+	// order with the text they wrap
+	color.Output = w
+	activeRunLog = l
+	return nil
+}
+
+// stopRunLog restores stdout and waits until everything printed so far is in
+// the log file
+func stopRunLog() {
+	l := activeRunLog
+	if l == nil {
+		return
+	}
+	activeRunLog = nil
+	os.Stdout = l.stdout
+	color.Output = l.stdout
+	l.w.Close()
+	<-l.done
+	l.file.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// safeModeRoot is the backup directory, with its symlinks resolved, when
+// -safe_mode is on. It's empty otherwise
+var safeModeRoot string
+
+// enableSafeMode makes checkWritePath refuse any path outside of
+// 'backupDirPath', which is created if needed
+func enableSafeMode(backupDirPath string) error {
+	err := os.MkdirAll(backupDirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(backupDirPath)
+	if err != nil {
+		return err
+	}
+	safeModeRoot, err = filepath.EvalSymlinks(root)
+	return err
+}
+
+// resolvePath returns the absolute path of 'path' with the symlinks of its
+// longest existing prefix resolved, so a symlink pointing out of the backup
+// directory is caught even if 'path' itself doesn't exist yet
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// checkWritePath returns an error if -safe_mode is on and 'path' resolves to
+// somewhere outside of the backup directory, like util.SafeDelete does for
+// deletions.
+//
+// XXX Repo names, tags, asset names, etc. come from the API and end up in
+// paths: a name with '..' or a symlink planted in a reused backup directory
+// could otherwise make us write anywhere
+func checkWritePath(path string) error {
+	if len(safeModeRoot) == 0 {
+		return nil
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(safeModeRoot, resolved)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return print.Errorf("-safe_mode: refusing to write %s, which is outside of %s", path, safeModeRoot)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const sbomFileName = "sbom.spdx.json"
+
+// backupRepoSBOM uses 'client' and 'ctx' to write the SPDX software bill of
+// materials GitHub's dependency graph generates for 'repo' to
+// 'sbom.spdx.json' in its meta directory.
+//
+// XXX Repos with the dependency graph disabled, or which the token can't see
+// the dependency graph of, are skipped
+func backupRepoSBOM(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	sbom, _, err := client.DependencyGraph.GetSBOM(ctx, *repo.Owner.Login, *repo.Name)
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping SBOM of %s: %v\n", *repo.Name, err)
+			return nil
+		}
+		return err
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up SBOM of %s to %s\n", *repo.Name, targetDir)
+	return writeJSONFile(filepath.Join(targetDir, sbomFileName), sbom.GetSBOM())
+}
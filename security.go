@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	artifactSecurity          = "security"
+	codeScanningFileName      = "code_scanning.json"
+	secretScanningFileName    = "secret_scanning.json"
+	redactedSecretPlaceholder = "REDACTED"
+)
+
+// backupRepoSecurityAlerts uses 'client' and 'ctx' to write the code
+// scanning and secret scanning alerts of 'repo', with their rule, state,
+// severity and location, to 'code_scanning.json' and 'secret_scanning.json'
+// in its security directory.
+//
+// XXX Both APIs answer 403 or 404 when the feature isn't enabled on the repo,
+// or the token lacks the 'security_events' scope: each is skipped on its own.
+// Secret values are never written, even if the API returns them
+func backupRepoSecurityAlerts(client *github.Client, ctx context.Context, backupDirPath string,
+	repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	codeOpts := &github.AlertListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	codeAlerts, err := paginate(ctx, "code scanning alerts", func(page int) ([]*github.Alert, *github.Response, error) {
+		codeOpts.ListOptions.Page = page
+		return client.CodeScanning.ListAlertsForRepo(ctx, owner, name, codeOpts)
+	})
+	if err != nil {
+		if !isAccessDenied(err) {
+			return err
+		}
+		print.Debugf("Skipping code scanning alerts of %s: %v\n", name, err)
+		codeAlerts = nil
+	}
+
+	secretOpts := &github.SecretScanningAlertListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	secretAlerts, err := paginate(ctx, "secret scanning alerts", func(page int) ([]*github.SecretScanningAlert, *github.Response, error) {
+		secretOpts.ListOptions.Page = page
+		return client.SecretScanning.ListAlertsForRepo(ctx, owner, name, secretOpts)
+	})
+	if err != nil {
+		if !isAccessDenied(err) {
+			return err
+		}
+		print.Debugf("Skipping secret scanning alerts of %s: %v\n", name, err)
+		secretAlerts = nil
+	}
+	for _, alert := range secretAlerts {
+		if alert.Secret != nil {
+			alert.Secret = github.Ptr(redactedSecretPlaceholder)
+		}
+	}
+
+	if len(codeAlerts) == 0 && len(secretAlerts) == 0 {
+		print.Debugf("No security alerts found for repo %s\n", name)
+		return nil
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactSecurity)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Backing up %d code scanning and %d secret scanning alerts of %s to %s\n",
+		len(codeAlerts), len(secretAlerts), name, targetDir)
+	if len(codeAlerts) != 0 {
+		err = writeJSONFile(filepath.Join(targetDir, codeScanningFileName), codeAlerts)
+		if err != nil {
+			return err
+		}
+	}
+	if len(secretAlerts) != 0 {
+		err = writeJSONFile(filepath.Join(targetDir, secretScanningFileName), secretAlerts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
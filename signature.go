@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+const (
+	sha256SumsFileName = "SHA256SUMS"
+	signatureExt       = ".asc"
+)
+
+// runLogFileRegexp matches the run log and its rotated copies, which are
+// still written to after the backup is signed
+var runLogFileRegexp = regexp.MustCompile(`^run\.log(\.\d+)?$`)
+
+// signedFileNames are the files of the root of a backup -gpg_sign_manifest
+// signs, each with a detached signature next to it
+var signedFileNames = []string{manifestFileName, sha256SumsFileName}
+
+// isSummedFile returns whether the file at 'rel', relative to the root of
+// the backup, is listed in 'SHA256SUMS'
+func isSummedFile(rel string) bool {
+	if rel == sha256SumsFileName || runLogFileRegexp.MatchString(rel) {
+		return false
+	}
+	for _, name := range signedFileNames {
+		if rel == name+signatureExt {
+			return false
+		}
+	}
+	return true
+}
+
+// hashFile returns the hex SHA-256 of the file at 'path'
+func hashFile(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, fd)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashBackup returns the SHA-256 of every regular file in 'backupDirPath'
+// that goes in 'SHA256SUMS', keyed by their slash-separated path relative to
+// it
+func hashBackup(backupDirPath string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.Walk(backupDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(backupDirPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !isSummedFile(rel) {
+			return nil
+		}
+		sums[rel], err = hashFile(path)
+		return err
+	})
+	return sums, err
+}
+
+// writeSHA256Sums writes the SHA-256 of every file of the backup at
+// 'backupDirPath' to 'SHA256SUMS' at its root, in the format 'sha256sum -c'
+// reads.
+//
+// XXX Not through 'outputEncoder': a BOM would break 'sha256sum -c'
+func writeSHA256Sums(backupDirPath string) error {
+	print.DebugFunc()
+
+	sums, err := hashBackup(backupDirPath)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", sums[path], path)
+	}
+	print.Debugf("Hashed %d files of %s\n", len(paths), backupDirPath)
+	return os.WriteFile(filepath.Join(backupDirPath, sha256SumsFileName), []byte(b.String()), 0644)
+}
+
+// signBackup writes 'SHA256SUMS' at the root of 'backupDirPath', then signs
+// it and the manifest with the GPG key 'keyID', as detached ASCII-armored
+// signatures next to them.
+//
+// XXX gpg runs in batch mode: the key must have no passphrase, or gpg-agent
+// must already have it
+func signBackup(ctx context.Context, backupDirPath, keyID string) error {
+	print.DebugFunc()
+
+	err := writeSHA256Sums(backupDirPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range signedFileNames {
+		_, err = runCommand(ctx, backupDirPath, nil, "gpg", "--batch", "--yes", "--armor",
+			"--local-user", keyID, "--output", name+signatureExt, "--detach-sign", name)
+		if err != nil {
+			return err
+		}
+	}
+	print.Infof("Signed %s with %s\n", backupDirPath, keyID)
+	return nil
+}
+
+// readSHA256Sums reads the 'SHA256SUMS' at the root of 'backupDirPath'
+func readSHA256Sums(backupDirPath string) (map[string]string, error) {
+	path := filepath.Join(backupDirPath, sha256SumsFileName)
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		sum, file, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			return nil, print.Errorf("%s: malformed line %q", path, scanner.Text())
+		}
+		sums[file] = sum
+	}
+	return sums, scanner.Err()
+}
+
+// verifyBackupSignature checks the signatures -gpg_sign_manifest made of the
+// backup at 'backupDirPath' against the public key at 'publicKeyPath', then
+// that every file listed in 'SHA256SUMS' is still there, unchanged, and that
+// no file was added.
+//
+// XXX The key is imported into a throwaway keyring, so a signature by any
+// other key, even a trusted one, doesn't verify
+func verifyBackupSignature(ctx context.Context, backupDirPath, publicKeyPath string) error {
+	print.DebugFunc()
+
+	gpgHome, err := os.MkdirTemp("", "clone_your_org_gpg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(gpgHome)
+	env := []string{"GNUPGHOME=" + gpgHome}
+	_, err = runCommand(ctx, gpgHome, env, "gpg", "--batch", "--import", publicKeyPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range signedFileNames {
+		_, err = runCommand(ctx, backupDirPath, env, "gpg", "--batch", "--verify", name+signatureExt, name)
+		if err != nil {
+			return print.Errorf("bad or missing signature of %s: %v", name, err)
+		}
+	}
+
+	want, err := readSHA256Sums(backupDirPath)
+	if err != nil {
+		return err
+	}
+	got, err := hashBackup(backupDirPath)
+	if err != nil {
+		return err
+	}
+	var missing, changed, added []string
+	for path, sum := range want {
+		gotSum, ok := got[path]
+		switch {
+		case !ok:
+			missing = append(missing, path)
+		case gotSum != sum:
+			changed = append(changed, path)
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			added = append(added, path)
+		}
+	}
+	for _, files := range [][]string{missing, changed, added} {
+		sort.Strings(files)
+	}
+	for _, path := range missing {
+		print.Warnf("Missing: %s\n", path)
+	}
+	for _, path := range changed {
+		print.Warnf("Changed: %s\n", path)
+	}
+	for _, path := range added {
+		print.Warnf("Added: %s\n", path)
+	}
+	if len(missing) != 0 || len(changed) != 0 || len(added) != 0 {
+		return print.Errorf("%s doesn't match its signed checksums: %d missing, %d changed and %d added files",
+			backupDirPath, len(missing), len(changed), len(added))
+	}
+	print.Infof("Signature of %s is good and its %d files are unchanged\n", backupDirPath, len(want))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+)
+
+// formatSize returns 'size', in bytes, in the largest binary unit that keeps
+// it at least 1, e.g. '1.5 GiB'
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// repoDiskUsage returns the on-disk size of every artifact of the repo
+// 'repoName' in 'backupDirPath', its -zip_per_repo archive included
+func repoDiskUsage(backupDirPath, repoName string) (int64, error) {
+	var total int64
+	for _, root := range repoArtifactRoots(backupDirPath, repoName) {
+		if !util.IsDirectory(root) {
+			continue
+		}
+		size, err := dirSize(root)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	info, err := os.Stat(filepath.Join(backupDirPath, repoName+".zip"))
+	if err == nil {
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// reportDiskUsage records the on-disk size of every repo of 'm', and of the
+// whole of 'backupDirPath', in 'm', then prints them, largest repos first.
+//
+// XXX It's a walk of the backup directory once everything is written: it
+// costs no API call
+func reportDiskUsage(backupDirPath string, m *export.Manifest) error {
+	print.DebugFunc()
+
+	for i := range m.Repos {
+		size, err := repoDiskUsage(backupDirPath, m.Repos[i].Name)
+		if err != nil {
+			return err
+		}
+		m.Repos[i].SizeBytes = size
+	}
+	total, err := dirSize(backupDirPath)
+	if err != nil {
+		return err
+	}
+	m.TotalSizeBytes = total
+
+	repos := append([]export.ManifestRepo{}, m.Repos...)
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].SizeBytes > repos[j].SizeBytes
+	})
+	print.Infof("Disk usage of %s: %s\n", backupDirPath, formatSize(total))
+	for _, repo := range repos {
+		print.Infof("    %10s  %s\n", formatSize(repo.SizeBytes), repo.Name)
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	// XXX A pure-Go SQLite, so the binary still builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+const sqlDumpFileName = "issues.db"
+
+// sqlDumpSchema creates the tables of -sql_dump. Rows get their IDs from
+// sqlDumper, so foreign keys hold without looking anything up
+const sqlDumpSchema = `PRAGMA foreign_keys = ON;
+DROP TABLE IF EXISTS issue_labels;
+DROP TABLE IF EXISTS labels;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS issues;
+DROP TABLE IF EXISTS repos;
+CREATE TABLE repos (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  full_name TEXT NOT NULL UNIQUE,
+  description TEXT,
+  stargazers INTEGER NOT NULL,
+  watchers INTEGER NOT NULL,
+  forks INTEGER NOT NULL,
+  open_issues INTEGER NOT NULL,
+  backed_up_at TEXT NOT NULL
+);
+CREATE TABLE issues (
+  id INTEGER PRIMARY KEY,
+  repo_id INTEGER NOT NULL REFERENCES repos(id),
+  number INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  is_pull_request INTEGER NOT NULL,
+  state TEXT NOT NULL,
+  state_reason TEXT,
+  author TEXT,
+  author_association TEXT,
+  created_at TEXT NOT NULL,
+  updated_at TEXT,
+  closed_at TEXT,
+  closed_by TEXT,
+  body TEXT,
+  UNIQUE (repo_id, is_pull_request, number)
+);
+CREATE TABLE comments (
+  id INTEGER PRIMARY KEY,
+  issue_id INTEGER NOT NULL REFERENCES issues(id),
+  author TEXT,
+  author_association TEXT,
+  created_at TEXT NOT NULL,
+  updated_at TEXT,
+  body TEXT NOT NULL
+);
+CREATE TABLE labels (
+  id INTEGER PRIMARY KEY,
+  repo_id INTEGER NOT NULL REFERENCES repos(id),
+  name TEXT NOT NULL,
+  color TEXT,
+  description TEXT,
+  UNIQUE (repo_id, name)
+);
+CREATE TABLE issue_labels (
+  issue_id INTEGER NOT NULL REFERENCES issues(id),
+  label_id INTEGER NOT NULL REFERENCES labels(id),
+  PRIMARY KEY (issue_id, label_id)
+);
+CREATE INDEX issues_repo_state ON issues (repo_id, state);
+CREATE INDEX issues_author ON issues (author);
+CREATE INDEX issues_created_at ON issues (created_at);
+CREATE INDEX comments_issue ON comments (issue_id);
+CREATE INDEX comments_author ON comments (author);
+CREATE INDEX labels_name ON labels (name);
+CREATE INDEX issue_labels_label ON issue_labels (label_id);
+`
+
+// sqlString returns 's' as an SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlNullString returns 's' as an SQL string literal, or NULL if it's empty
+func sqlNullString(s string) string {
+	if len(s) == 0 {
+		return "NULL"
+	}
+	return sqlString(s)
+}
+
+// sqlTime returns 't' as an SQL string literal in RFC 3339, in UTC, or NULL
+// if it's nil
+func sqlTime(t *time.Time) string {
+	if t == nil {
+		return "NULL"
+	}
+	return sqlString(t.UTC().Format(time.RFC3339))
+}
+
+// sqlBool returns 'b' as SQLite stores booleans
+func sqlBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// readJSONIssues returns the issues written to 'issuesDir' with -format json,
+// sorted by number
+func readJSONIssues(issuesDir string) ([]*export.Issue, error) {
+	entries, err := os.ReadDir(issuesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	issues := []*export.Issue{}
+	for _, entry := range entries {
+		name := entry.Name()
+		// XXX Only '<number>.json', and 'mr_<number>.json' for GitLab's merge
+		// requests: the directory also has attachments and PR diffs
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		stem := strings.TrimPrefix(strings.TrimSuffix(name, ".json"), mergeRequestFilePrefix)
+		if _, err := strconv.Atoi(stem); err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(issuesDir, name))
+		if err != nil {
+			return nil, err
+		}
+		issue := &export.Issue{}
+		err = json.Unmarshal(bytes.TrimPrefix(b, utf8BOM), issue)
+		if err != nil {
+			return nil, print.Errorf("%s: %v", filepath.Join(issuesDir, name), err)
+		}
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Number != issues[j].Number {
+			return issues[i].Number < issues[j].Number
+		}
+		// XXX Only GitLab has a merge request with the number of an issue
+		return !issues[i].IsPullRequest && issues[j].IsPullRequest
+	})
+	return issues, nil
+}
+
+// sqlDumper writes the rows of -sql_dump, numbering them as it goes
+type sqlDumper struct {
+	w             io.Writer
+	repoID        int
+	issueID       int
+	commentID     int
+	labelID       int
+	issuesWritten int
+}
+
+// writeRepo writes 'repo' and the issues in 'issues'
+func (d *sqlDumper) writeRepo(repo *export.Repo, issues []*export.Issue) error {
+	d.repoID++
+	_, err := fmt.Fprintf(d.w, "INSERT INTO repos VALUES (%d, %s, %s, %s, %d, %d, %d, %d, %s);\n",
+		d.repoID, sqlString(repo.Name), sqlString(repo.FullName), sqlNullString(repo.Description),
+		repo.Stats.Stargazers, repo.Stats.Watchers, repo.Stats.Forks, repo.Stats.OpenIssues,
+		sqlTime(&repo.BackedUpAt))
+	if err != nil {
+		return err
+	}
+	labelIDs := map[string]int{}
+	for _, issue := range issues {
+		// Issues written before labels had details only have their names
+		labels := append([]export.Label{}, issue.LabelDetails...)
+		for _, name := range issue.Labels {
+			labels = append(labels, export.Label{Name: name})
+		}
+		for _, label := range labels {
+			if _, ok := labelIDs[label.Name]; ok {
+				continue
+			}
+			d.labelID++
+			labelIDs[label.Name] = d.labelID
+			_, err = fmt.Fprintf(d.w, "INSERT INTO labels VALUES (%d, %d, %s, %s, %s);\n",
+				d.labelID, d.repoID, sqlString(label.Name), sqlNullString(label.Color),
+				sqlNullString(label.Description))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, issue := range issues {
+		err = d.writeIssue(issue, labelIDs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIssue writes 'issue', of the current repo, its comments and its
+// labels, whose IDs are in 'labelIDs'
+func (d *sqlDumper) writeIssue(issue *export.Issue, labelIDs map[string]int) error {
+	d.issueID++
+	d.issuesWritten++
+	// Issues written before their state was recorded only have 'closed_at'
+	state := issue.State
+	if len(state) == 0 {
+		state = "open"
+		if issue.ClosedAt != nil {
+			state = "closed"
+		}
+	}
+	body := ""
+	if issue.Body != nil {
+		body = *issue.Body
+	}
+	_, err := fmt.Fprintf(d.w, "INSERT INTO issues VALUES (%d, %d, %d, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s);\n",
+		d.issueID, d.repoID, issue.Number, sqlString(issue.Title), sqlBool(issue.IsPullRequest),
+		sqlString(state), sqlNullString(issue.StateReason), sqlNullString(issue.Author), sqlNullString(issue.AuthorAssociation),
+		sqlTime(&issue.CreatedAt), sqlTime(issue.UpdatedAt), sqlTime(issue.ClosedAt), sqlNullString(issue.ClosedBy),
+		sqlNullString(body))
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, name := range issue.Labels {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		_, err = fmt.Fprintf(d.w, "INSERT INTO issue_labels VALUES (%d, %d);\n", d.issueID, labelIDs[name])
+		if err != nil {
+			return err
+		}
+	}
+	for _, comment := range issue.Comments {
+		d.commentID++
+		_, err = fmt.Fprintf(d.w, "INSERT INTO comments VALUES (%d, %d, %s, %s, %s, %s, %s);\n",
+			d.commentID, d.issueID, sqlNullString(comment.Author), sqlNullString(comment.AuthorAssociation),
+			sqlTime(&comment.CreatedAt), sqlTime(comment.UpdatedAt), sqlString(comment.Body))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSQLDump writes the repos in 'metas', and every issue backed up for
+// them, with their comments and labels, to the SQLite database 'issues.db' at
+// the root of 'backupDirPath'. It's created anew on every run.
+//
+// XXX The issues are read back from their JSON files rather than collected
+// while they're written: issues that didn't change since the previous run
+// aren't rewritten, and they'd be missing. The database is filled through a
+// temporary file, renamed once complete, so a failed run doesn't leave half a
+// database behind
+func writeSQLDump(backupDirPath string, metas []*export.Repo) error {
+	print.DebugFunc()
+
+	path := filepath.Join(backupDirPath, sqlDumpFileName)
+	err := checkWritePath(path)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = os.Remove(tmpPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	db, err := sql.Open("sqlite", tmpPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// XXX One connection, for 'PRAGMA foreign_keys' to hold in the transaction
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(sqlDumpSchema)
+	if err != nil {
+		return print.Errorf("%s: %v", tmpPath, err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// XXX sqlDumper still writes SQL: each repo's statements are run at once,
+	// so no more than one repo's rows are held in memory
+	var b strings.Builder
+	d := &sqlDumper{w: &b}
+	for _, meta := range metas {
+		if meta == nil {
+			continue
+		}
+		issues, err := readJSONIssues(repoArtifactPath(backupDirPath, meta.Name, artifactIssues))
+		if err != nil {
+			return err
+		}
+		b.Reset()
+		err = d.writeRepo(meta, issues)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(b.String())
+		if err != nil {
+			return print.Errorf("%s: %s: %v", tmpPath, meta.Name, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	err = db.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	print.Infof("Wrote %d repos and %d issues to %s\n", d.repoID, d.issuesWritten, path)
+	return nil
+}
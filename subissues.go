@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// taskListItemRegexp matches a task list item referencing an issue, as
+// '#12', 'owner/repo#12' or an issue/PR URL
+var taskListItemRegexp = regexp.MustCompile(
+	`^\s*[-*+]\s+\[([ xX])\]\s+(?:([\w.-]+/[\w.-]+)?#(\d+)|https?://[^/\s]+/([\w.-]+/[\w.-]+)/(?:issues|pull)/(\d+))`)
+
+// subIssueIndex is the parent/child relationships between the issues of a
+// repo
+type subIssueIndex struct {
+	// children maps an issue number to its sub-issues
+	children map[int][]export.IssueRef
+	// parents maps an issue number to its parent, if it's in the same repo
+	parents map[int]export.IssueRef
+}
+
+// repoFullNameFromAPIURL returns 'owner/repo' from a repo's API URL, e.g.
+// 'https://api.github.com/repos/owner/repo'
+func repoFullNameFromAPIURL(u string) string {
+	i := strings.LastIndex(u, "/repos/")
+	if i < 0 {
+		return ""
+	}
+	return u[i+len("/repos/"):]
+}
+
+// fetchSubIssues uses 'client' and 'ctx' to list the sub-issues of every
+// issue of 'repo' in 'issues'.
+//
+// XXX This costs one API call per issue (PRs can't have sub-issues). If the
+// API isn't available, e.g. on older GitHub Enterprise Server versions, an
+// empty index is returned
+func fetchSubIssues(client *github.Client, ctx context.Context,
+	repo *github.Repository, issues []*github.Issue) (*subIssueIndex, error) {
+	print.DebugFunc()
+
+	idx := &subIssueIndex{
+		children: map[int][]export.IssueRef{},
+		parents:  map[int]export.IssueRef{},
+	}
+	for _, issue := range issues {
+		if issue.IsPullRequest() {
+			continue
+		}
+		opts := &github.IssueListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		subIssues, err := paginate(ctx, "sub-issues", func(page int) ([]*github.SubIssue, *github.Response, error) {
+			opts.ListOptions.Page = page
+			return client.SubIssue.ListByIssue(ctx, *repo.Owner.Login, *repo.Name,
+				int64(*issue.Number), opts)
+		})
+		if err != nil {
+			if isAccessDenied(err) {
+				print.Debugf("Can't list sub-issues of %s: %v\n", *repo.Name, err)
+				return idx, nil
+			}
+			return nil, err
+		}
+		for _, subIssue := range subIssues {
+			sub := (*github.Issue)(subIssue)
+			ref := export.IssueRef{Number: sub.GetNumber()}
+			fullName := repoFullNameFromAPIURL(sub.GetRepositoryURL())
+			if len(fullName) != 0 && fullName != repo.GetFullName() {
+				ref.Repo = fullName
+			} else {
+				idx.parents[ref.Number] = export.IssueRef{Number: *issue.Number}
+			}
+			idx.children[*issue.Number] = append(idx.children[*issue.Number], ref)
+		}
+	}
+	return idx, nil
+}
+
+// parseTaskList returns the task list items of 'body' that reference an
+// issue or PR. References to 'repoFullName' are made relative, and get their
+// title from 'titles' if it has them
+func parseTaskList(body, repoFullName string, titles map[int]string) []export.TaskListItem {
+	var items []export.TaskListItem
+	for _, line := range strings.Split(body, "\n") {
+		m := taskListItemRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		repoName, number := m[2], m[3]
+		if len(number) == 0 {
+			repoName, number = m[4], m[5]
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			continue
+		}
+		item := export.TaskListItem{
+			Issue:   export.IssueRef{Repo: repoName, Number: n},
+			Checked: m[1] != " ",
+		}
+		if strings.EqualFold(repoName, repoFullName) {
+			item.Issue.Repo = ""
+		}
+		if len(item.Issue.Repo) == 0 {
+			item.Title = titles[n]
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// fillIssueHierarchy fills the parent, sub-issues and task list of 'out'
+// from 'idx', which is nil if sub-issues weren't fetched, and from its body
+func fillIssueHierarchy(out *export.Issue, idx *subIssueIndex,
+	repo *github.Repository, titles map[int]string) {
+	if idx != nil {
+		if parent, ok := idx.parents[out.Number]; ok {
+			out.ParentIssue = &parent
+		}
+		out.SubIssues = idx.children[out.Number]
+	}
+	if out.Body != nil {
+		out.TaskList = parseTaskList(*out.Body, repo.GetFullName(), titles)
+	}
+}
+
+func formatIssueRef(ref export.IssueRef) string {
+	return fmt.Sprintf("%s#%d", ref.Repo, ref.Number)
+}
+
+// writeIssueHierarchyMarkdown writes the parent, sub-issues and task list of
+// 'issue' to 'fd'
+func writeIssueHierarchyMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if issue.ParentIssue != nil {
+		fd.WriteString(fmt.Sprintf("* Parent issue: %s\r\n", formatIssueRef(*issue.ParentIssue)))
+	}
+	if len(issue.SubIssues) != 0 {
+		var refs []string
+		for _, ref := range issue.SubIssues {
+			refs = append(refs, formatIssueRef(ref))
+		}
+		fd.WriteString(fmt.Sprintf("* Sub-issues: %s\r\n", strings.Join(refs, ", ")))
+	}
+	if len(issue.TaskList) != 0 {
+		fd.WriteString("* Task list:\r\n")
+		for _, item := range issue.TaskList {
+			check := " "
+			if item.Checked {
+				check = "x"
+			}
+			line := fmt.Sprintf("  * [%s] %s", check, formatIssueRef(item.Issue))
+			if len(item.Title) != 0 {
+				line += ": " + item.Title
+			}
+			fd.WriteString(line + "\r\n")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const watchersFileName = "watchers.json"
+
+// subscribersNote is written with every issue's subscribers, so whoever
+// migrates them knows what's missing
+const subscribersNote = "GitHub doesn't expose who subscribed to an issue: " +
+	"the notification subscription endpoint only answers for the token's own user. " +
+	"These are the users GitHub counts as participants (author, commenters, assignees, " +
+	"mentioned users, reviewers), which are subscribed unless they opted out. " +
+	"Users who subscribed without participating aren't listed, and neither are the " +
+	"repo's watchers, who get notified about every issue: see " + watchersFileName +
+	" in the repo's meta directory"
+
+const issueParticipantsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issueOrPullRequest(number: $number) {
+      ... on Issue {
+        participants(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { login }
+        }
+      }
+      ... on PullRequest {
+        participants(first: 100, after: $cursor) {
+          pageInfo { hasNextPage endCursor }
+          nodes { login }
+        }
+      }
+    }
+  }
+}`
+
+// fetchIssueSubscribers uses 'client' and 'ctx' to fill the subscribers of
+// the issue or PR 'issue' of 'repo' into 'out', as far as the API tells: see
+// subscribersNote
+func fetchIssueSubscribers(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	subscribers := &export.IssueSubscribers{Users: []string{}, Note: subscribersNote}
+	var cursor *string
+	for {
+		var data struct {
+			Repository struct {
+				IssueOrPullRequest struct {
+					Participants struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							Login string `json:"login"`
+						} `json:"nodes"`
+					} `json:"participants"`
+				} `json:"issueOrPullRequest"`
+			} `json:"repository"`
+		}
+		err := queryGraphQL(client, ctx, issueParticipantsQuery, map[string]interface{}{
+			"owner":  *repo.Owner.Login,
+			"name":   *repo.Name,
+			"number": *issue.Number,
+			"cursor": cursor,
+		}, &data)
+		if err != nil {
+			if isGraphQLAccessDenied(err) {
+				print.Debugf("Skipping subscribers of issue #%d: %v\n", *issue.Number, err)
+				return nil
+			}
+			return err
+		}
+		participants := data.Repository.IssueOrPullRequest.Participants
+		for _, node := range participants.Nodes {
+			subscribers.Users = append(subscribers.Users, node.Login)
+		}
+		if !participants.PageInfo.HasNextPage {
+			break
+		}
+		cursor = &participants.PageInfo.EndCursor
+	}
+	out.Subscribers = subscribers
+	return nil
+}
+
+// writeIssueSubscribersMarkdown writes the subscribers of 'issue', if they
+// were fetched, to 'fd'
+func writeIssueSubscribersMarkdown(fd io.StringWriter, issue *export.Issue) {
+	if issue.Subscribers == nil {
+		return
+	}
+	fd.WriteString(fmt.Sprintf("* Subscribers: %s\r\n", strings.Join(issue.Subscribers.Users, ", ")))
+	fd.WriteString("  * Participants only: GitHub doesn't expose explicit subscriptions, and repo watchers aren't listed\r\n")
+}
+
+// backupRepoWatchers uses 'client' and 'ctx' to write the logins of the
+// watchers of 'repo', who get notified about all of its issues and PRs, to
+// 'watchers.json' in its meta directory
+func backupRepoWatchers(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	opts := &github.ListOptions{PerPage: 100}
+	users, err := paginate(ctx, "watchers", func(page int) ([]*github.User, *github.Response, error) {
+		opts.Page = page
+		return client.Activity.ListWatchers(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+	if err != nil {
+		return err
+	}
+	watchers := []string{}
+	for _, user := range users {
+		watchers = append(watchers, user.GetLogin())
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, watchersFileName), watchers)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/afjoseph/commongo/print"
+)
+
+// runSummary collects what went wrong during a run without aborting it, so it
+// can all be reported once at the end
+type runSummary struct {
+	mu sync.Mutex
+	// verifyFailures maps a repo name to why its mirror failed verification
+	verifyFailures map[string]string
+	// verifyFailuresOrder keeps the repos in the order they failed
+	verifyFailuresOrder []string
+	// skippedOrgs are the orgs of a multi-org run the token couldn't see, each
+	// with why
+	skippedOrgs []string
+	// repoFailures are the repos that couldn't be backed up, each with why
+	repoFailures []string
+	// orgs are the orgs whose backup was started, with where it went
+	orgs []orgBackup
+	// reposBackedUp is how many repos were backed up, and totals what was
+	// written for them
+	reposBackedUp int
+	totals        repoResult
+}
+
+// orgBackup is an org whose backup was started in 'backupDirPath'
+type orgBackup struct {
+	org           string
+	backupDirPath string
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{verifyFailures: map[string]string{}}
+}
+
+func (s *runSummary) addVerifyFailure(repoName string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.verifyFailures[repoName]; !ok {
+		s.verifyFailuresOrder = append(s.verifyFailuresOrder, repoName)
+	}
+	s.verifyFailures[repoName] = err.Error()
+}
+
+func (s *runSummary) addSkippedOrg(org string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skippedOrgs = append(s.skippedOrgs, fmt.Sprintf("%s: %v", org, err))
+}
+
+func (s *runSummary) addRepoFailure(org, repoName string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repoFailures = append(s.repoFailures, fmt.Sprintf("%s/%s: %v", org, repoName, err))
+}
+
+func (s *runSummary) addOrg(org, backupDirPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs = append(s.orgs, orgBackup{org: org, backupDirPath: backupDirPath})
+}
+
+func (s *runSummary) addRepoResult(result repoResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reposBackedUp++
+	s.totals = s.totals.add(result)
+}
+
+func (s *runSummary) repoFailureCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.repoFailures)
+}
+
+// print writes the summary to stdout
+func (s *runSummary) print() {
+	if len(s.skippedOrgs) != 0 {
+		print.Warnf("%d orgs were skipped:\n", len(s.skippedOrgs))
+		for _, skipped := range s.skippedOrgs {
+			print.Warnln("    " + skipped)
+		}
+	}
+	if len(s.repoFailures) != 0 {
+		print.Warnf("%d repos failed to back up:\n", len(s.repoFailures))
+		for _, failure := range s.repoFailures {
+			print.Warnln("    " + failure)
+		}
+	}
+	if len(s.verifyFailuresOrder) == 0 {
+		return
+	}
+	print.Warnf("%d repos failed verification. You should re-run their backup:\n",
+		len(s.verifyFailuresOrder))
+	for _, repoName := range s.verifyFailuresOrder {
+		print.Warnln(fmt.Sprintf("    %s: %s", repoName, s.verifyFailures[repoName]))
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+	"github.com/google/go-github/v76/github"
+)
+
+const (
+	// formatCSV and formatTSV write the issues of each repo as a single
+	// table, one row per issue, instead of a file per issue
+	formatCSV = "csv"
+	formatTSV = "tsv"
+)
+
+var issueTableHeader = []string{
+	"number", "type", "title", "state", "author", "labels", "assignees", "created", "updated", "closed", "comments",
+}
+
+// isTableFormat returns whether issues are written as a table in 'format'
+func isTableFormat(format string) bool {
+	return format == formatCSV || format == formatTSV
+}
+
+// issueTableFileName returns the name of the table issues are written to in
+// 'format'
+func issueTableFileName(format string) string {
+	return "issues." + format
+}
+
+// newTableWriter returns a writer of 'format' rows into 'fd'. Fields are
+// quoted as RFC 4180 says, with a tab instead of a comma for TSV
+func newTableWriter(fd *textFile, format string) *csv.Writer {
+	w := csv.NewWriter(fd)
+	if format == formatTSV {
+		w.Comma = '\t'
+	}
+	w.UseCRLF = true
+	return w
+}
+
+// issueTableRow returns the row of 'issue' in an issue table
+func issueTableRow(issue *github.Issue) []string {
+	kind := "issue"
+	if issue.IsPullRequest() {
+		kind = "pull_request"
+	}
+	var labels, assignees []string
+	for _, label := range issue.Labels {
+		labels = append(labels, label.GetName())
+	}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.GetLogin())
+	}
+	updated := ""
+	if issue.UpdatedAt != nil {
+		updated = issue.UpdatedAt.Format(time.RFC3339)
+	}
+	closed := ""
+	// XXX Like in the other formats, 'closed_at' is only recorded while the
+	// issue is closed
+	if issue.GetState() != "open" && issue.ClosedAt != nil {
+		closed = issue.ClosedAt.Format(time.RFC3339)
+	}
+	return []string{
+		strconv.Itoa(issue.GetNumber()),
+		kind,
+		issue.GetTitle(),
+		issue.GetState(),
+		issue.GetUser().GetLogin(),
+		strings.Join(labels, ", "),
+		strings.Join(assignees, ", "),
+		issue.GetCreatedAt().Format(time.RFC3339),
+		updated,
+		closed,
+		strconv.Itoa(issue.GetComments()),
+	}
+}
+
+// writeIssueTable writes 'rows', made with issueTableRow, to the table at
+// 'path' in 'format'
+func writeIssueTable(path, format string, rows [][]string) error {
+	fd, err := createTextFile(path)
+	if err != nil {
+		return err
+	}
+	w := newTableWriter(fd, format)
+	w.Write(issueTableHeader)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// readIssueTable returns the rows, without the header, of the table at 'path'
+// in 'format'
+func readIssueTable(path, format string) ([][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b, utf8BOM)))
+	if format == formatTSV {
+		r.Comma = '\t'
+	}
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, print.Errorf("%s: %v", path, err)
+	}
+	return rows[min(1, len(rows)):], nil
+}
+
+// removeOrgIssueTable removes the org's issue table of a previous run from
+// the root of 'backupDirPath', as appendOrgIssueTable only appends to it
+func removeOrgIssueTable(backupDirPath, format string) error {
+	err := os.Remove(filepath.Join(backupDirPath, issueTableFileName(format)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// appendOrgIssueTable appends 'rows', the issue table of the repo
+// 'repoFullName', to the org's issue table at the root of 'backupDirPath',
+// with a leading 'repo' column. The header is only written if the file is
+// new
+func appendOrgIssueTable(backupDirPath, format, repoFullName string, rows [][]string) error {
+	csvMu.Lock()
+	defer csvMu.Unlock()
+	path := filepath.Join(backupDirPath, issueTableFileName(format))
+	isNew := !util.IsFile(path)
+	fd, err := appendTextFile(path)
+	if err != nil {
+		return err
+	}
+	w := newTableWriter(fd, format)
+	if isNew {
+		w.Write(append([]string{"repo"}, issueTableHeader...))
+	}
+	for _, row := range rows {
+		w.Write(append([]string{repoFullName}, row...))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// appendExistingIssueTable appends the issue table 'repo' already has in
+// 'issuesDir', from a previous run, to the org's issue table at the root of
+// 'backupDirPath'
+func appendExistingIssueTable(backupDirPath, issuesDir string, repo *github.Repository) error {
+	format := issueFormat()
+	rows, err := readIssueTable(filepath.Join(issuesDir, issueTableFileName(format)), format)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return appendOrgIssueTable(backupDirPath, format, repo.GetFullName(), rows)
+}
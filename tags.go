@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// tagIndexEntry is a single tag in 'tags.json'
+type tagIndexEntry struct {
+	Name       string     `json:"name"`
+	SHA        string     `json:"sha"`
+	CommitDate *time.Time `json:"commit_date"`
+}
+
+// backupRepoTagsIndex uses 'client' and 'ctx' to write every tag of 'repo',
+// with the SHA and date of the commit it points to, to 'tags.json' in its
+// meta directory.
+//
+// XXX This costs one extra API call per distinct tagged commit, to get its
+// date. Tags pointing to the same commit share a call
+func backupRepoTagsIndex(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	opts := &github.ListOptions{PerPage: 100}
+	tags, err := paginate(ctx, "tags", func(page int) ([]*github.RepositoryTag, *github.Response, error) {
+		opts.Page = page
+		return client.Repositories.ListTags(ctx, owner, name, opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	commitDates := map[string]*time.Time{}
+	index := []tagIndexEntry{}
+	for _, tag := range tags {
+		sha := tag.GetCommit().GetSHA()
+		date, ok := commitDates[sha]
+		if !ok {
+			commit, resp, err := client.Git.GetCommit(ctx, owner, name, sha)
+			if err != nil {
+				return err
+			}
+			if commit.GetCommitter() != nil && commit.GetCommitter().Date != nil {
+				date = &commit.GetCommitter().Date.Time
+			}
+			commitDates[sha] = date
+			err = waitForRateLimit(ctx, resp)
+			if err != nil {
+				return err
+			}
+		}
+		index = append(index, tagIndexEntry{
+			Name:       tag.GetName(),
+			SHA:        sha,
+			CommitDate: date,
+		})
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	print.Debugf("Backing up index of %d tags for repo %s to %s\n", len(index), name, targetDir)
+	return writeJSONFile(filepath.Join(targetDir, "tags.json"), index)
+}
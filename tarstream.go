@@ -0,0 +1,232 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+)
+
+// tarStream is the archive of -stream_to_tar. Repos are backed up to the
+// backup directory as usual, then moved into the archive as soon as they're
+// done, so the directory only ever holds the repos in flight and the
+// org-level files.
+//
+// XXX tar can't be written to from several goroutines at once: every entry
+// goes through 'mu'
+type tarStream struct {
+	mu      sync.Mutex
+	path    string
+	fd      *os.File
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	entries int
+}
+
+// openTarStream creates the archive of -stream_to_tar at 'path', gzipped if
+// it ends with '.tgz' or '.gz'. It's written to 'path.partial' until it's
+// finished
+func openTarStream(path string) (*tarStream, error) {
+	err := checkWritePath(path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Create(path + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	s := &tarStream{path: path, fd: fd}
+	var w io.Writer = fd
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".gz") {
+		s.gz = gzip.NewWriter(fd)
+		w = s.gz
+	}
+	s.tw = tar.NewWriter(w)
+	return s, nil
+}
+
+// addManifest writes 'm' as the 'manifest.json' entry
+func (s *tarStream) addManifest(m *export.Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Encoded like every other JSON file
+	var buf bytes.Buffer
+	buf.Write(outputEncoder.preamble())
+	_, err = outputEncoder.wrap(&buf).Write(b)
+	if err != nil {
+		return err
+	}
+	b = buf.Bytes()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     manifestFileName,
+		Size:     int64(len(b)),
+		Mode:     0o644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.tw.Write(b)
+	s.entries++
+	return err
+}
+
+// addDirLocked adds 'dir', recursively, to the archive, leaving out
+// 'skipPath'. Entries are named after their path relative to 'baseDir'.
+// 's.mu' must be held
+func (s *tarStream) addDirLocked(baseDir, dir, skipPath string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if len(skipPath) != 0 {
+			if abs, _ := filepath.Abs(path); abs == skipPath {
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			print.Debugf("Not archiving %s: not a regular file\n", path)
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		// XXX Directories are added too, even empty ones: a bare git repo
+		// without its (often empty) 'refs' directory isn't a git repo anymore
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		err = s.tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		s.entries++
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		fd, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		// XXX Only as much as the header says: the run log is still being
+		// written to when it's archived
+		_, err = io.CopyN(s.tw, fd, header.Size)
+		return err
+	})
+}
+
+// addRepo moves every artifact of the repo 'repoName' in 'backupDirPath'
+// into the archive. 's' may be nil
+func (s *tarStream) addRepo(backupDirPath, repoName string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, root := range repoArtifactRoots(backupDirPath, repoName) {
+		if !isDirectoryOrSymlink(root) {
+			continue
+		}
+		err := s.addDirLocked(backupDirPath, root, "")
+		if err != nil {
+			return err
+		}
+		print.Debugf("Removing %s\n", root)
+		err = os.RemoveAll(root)
+		if err != nil {
+			return err
+		}
+	}
+	print.Debugf("Streamed %s to %s\n", repoName, s.path)
+	return nil
+}
+
+func isDirectoryOrSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && (info.IsDir() || info.Mode()&os.ModeSymlink != 0)
+}
+
+// finish adds what's left in 'backupDirPath', the org-level files, to the
+// archive, then completes it. They're left in place: the next run reads its
+// caches from them. 's' may be nil
+func (s *tarStream) finish(backupDirPath string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	partialPath := s.fd.Name()
+	err := s.addDirLocked(backupDirPath, backupDirPath, partialPath)
+	if err != nil {
+		return err
+	}
+	err = s.tw.Close()
+	if err != nil {
+		return err
+	}
+	if s.gz != nil {
+		err = s.gz.Close()
+		if err != nil {
+			return err
+		}
+	}
+	err = s.fd.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(partialPath, s.path)
+	if err != nil {
+		return err
+	}
+	print.Infof("Wrote %d entries to %s\n", s.entries, s.path)
+	return nil
+}
+
+// abort closes the archive without completing it, if it isn't already. What
+// was streamed so far stays in 'path.partial'. 's' may be nil
+func (s *tarStream) abort() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fd.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// fetchTimelineEvents fills the timeline events of 'issue' into 'out', for
+// -flatten_comments.
+//
+// XXX The timeline has the comments too, as 'commented' events: they're left
+// out, ListComments already has them
+func fetchTimelineEvents(client *github.Client, ctx context.Context,
+	repo *github.Repository, issue *github.Issue, out *export.Issue) error {
+	owner, name, number := *repo.Owner.Login, *repo.Name, *issue.Number
+	opts := &github.ListOptions{PerPage: 100}
+	events, err := paginate(ctx, "timeline events", func(page int) ([]*github.Timeline, *github.Response, error) {
+		opts.Page = page
+		return client.Issues.ListIssueTimeline(ctx, owner, name, number, opts)
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping timeline of issue #%d: %v\n", number, err)
+			return nil
+		}
+		return err
+	}
+	for _, event := range events {
+		if event.GetEvent() == "commented" {
+			continue
+		}
+		out.TimelineEvents = append(out.TimelineEvents, newTimelineEvent(event))
+	}
+	return nil
+}
+
+// newTimelineEvent converts 'event' to its export. Events differ in which
+// fields they have: the actor, time and detail come from the ones that are
+// set
+func newTimelineEvent(event *github.Timeline) export.TimelineEvent {
+	actor := event.GetActor().GetLogin()
+	if len(actor) == 0 {
+		// 'reviewed' events
+		actor = event.GetUser().GetLogin()
+	}
+	if len(actor) == 0 {
+		// 'committed' events, by git authors who may not have an account
+		actor = event.GetAuthor().GetName()
+	}
+	var createdAt time.Time
+	switch {
+	case event.CreatedAt != nil:
+		createdAt = event.GetCreatedAt().Time
+	case event.SubmittedAt != nil:
+		createdAt = event.GetSubmittedAt().Time
+	case event.GetAuthor().Date != nil:
+		createdAt = event.GetAuthor().GetDate().Time
+	}
+	detail := ""
+	switch {
+	case event.Label != nil:
+		detail = event.GetLabel().GetName()
+	case event.Assignee != nil:
+		detail = event.GetAssignee().GetLogin()
+	case event.Milestone != nil:
+		detail = event.GetMilestone().GetTitle()
+	case event.Rename != nil:
+		detail = event.GetRename().GetFrom() + " -> " + event.GetRename().GetTo()
+	case event.Reviewer != nil:
+		detail = event.GetReviewer().GetLogin()
+	case event.RequestedTeam != nil:
+		detail = event.GetRequestedTeam().GetSlug()
+	case event.Source != nil:
+		detail = event.GetSource().GetIssue().GetHTMLURL()
+	case event.Message != nil:
+		detail = event.GetMessage()
+	case event.Body != nil:
+		detail = event.GetBody()
+	case event.CommitID != nil:
+		detail = event.GetCommitID()
+	}
+	return export.TimelineEvent{
+		Event:     event.GetEvent(),
+		Actor:     actor,
+		CreatedAt: createdAt,
+		Detail:    detail,
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+)
+
+// truncateIssueBodies cuts the body of 'issue', of its comments and of its
+// review comments down to -max_comment_bytes. With -truncated_sidecars, the
+// full text of each truncated one is written next to the issue in
+// 'issueDir' first.
+//
+// XXX Comment sidecars are numbered from 1, like the comments in Markdown
+func truncateIssueBodies(issueDir string, issue *export.Issue) error {
+	limit := *maxCommentBytesFlag
+	truncate := func(body, sidecarName string) (string, error) {
+		if len(body) <= limit {
+			return body, nil
+		}
+		sidecar := ""
+		if *truncatedSidecarsFlag {
+			fd, err := createTextFile(filepath.Join(issueDir, sidecarName))
+			if err != nil {
+				return "", err
+			}
+			fd.WriteString(body)
+			err = fd.Close()
+			if err != nil {
+				return "", err
+			}
+			sidecar = sidecarName
+		}
+		return truncateBody(body, limit, sidecar), nil
+	}
+	prefix := issueFileStem(issue.Number, issue.IsPullRequest)
+	if issue.Body != nil {
+		body, err := truncate(*issue.Body, prefix+".body.full.md")
+		if err != nil {
+			return err
+		}
+		issue.Body = &body
+	}
+	var err error
+	for i := range issue.Comments {
+		issue.Comments[i].Body, err = truncate(issue.Comments[i].Body,
+			fmt.Sprintf("%s.comment_%d.full.md", prefix, i+1))
+		if err != nil {
+			return err
+		}
+	}
+	for i := range issue.ReviewThreads {
+		thread := &issue.ReviewThreads[i]
+		for j := range thread.Comments {
+			thread.Comments[j].Body, err = truncate(thread.Comments[j].Body,
+				fmt.Sprintf("%s.thread_%d.comment_%d.full.md", prefix, i+1, j+1))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// truncateBody returns the first 'limit' bytes of 'body', without cutting a
+// UTF-8 character in two, followed by a marker telling how many bytes were
+// cut and, if 'sidecar' isn't empty, which file has the full text
+func truncateBody(body string, limit int, sidecar string) string {
+	end := limit
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	marker := fmt.Sprintf("[truncated %d bytes]", len(body)-end)
+	if len(sidecar) != 0 {
+		marker = fmt.Sprintf("[truncated %d bytes, full text in %s]", len(body)-end, sidecar)
+	}
+	print.Debugf("Truncating a body of %d bytes to %d\n", len(body), end)
+	return body[:end] + "\r\n\r\n" + marker
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	// tuiRefreshInterval is how often the -tui dashboard is redrawn
+	tuiRefreshInterval = 500 * time.Millisecond
+	// tuiMaxWidth is the most characters a dashboard line has, so lines never
+	// wrap and the dashboard can be redrawn in place on most terminals
+	tuiMaxWidth = 100
+	// tuiMaxActive is the most in-flight repos the dashboard lists
+	tuiMaxActive = 10
+)
+
+// repoProgress is what a repo being backed up is doing
+type repoProgress struct {
+	step      string
+	startedAt time.Time
+}
+
+// progressTracker counts what the run has done so far, for the -tui
+// dashboard. It's updated from every worker.
+//
+// XXX Every method is a no-op on a nil tracker, which is what it is without
+// -tui, so the backup code doesn't have to check
+type progressTracker struct {
+	mu          sync.Mutex
+	org         string
+	reposTotal  int
+	reposDone   int
+	reposFailed int
+	active      map[string]*repoProgress
+	issues      int
+	comments    int
+	// rateRemaining is -1 until a response with rate limit headers is seen
+	rateRemaining int
+	rateLimit     int
+	rateReset     time.Time
+	// lastLine is the last line that was logged
+	lastLine string
+	partial  []byte
+}
+
+// progress is the tracker of -tui. It's nil otherwise
+var progress *progressTracker
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{active: map[string]*repoProgress{}, rateRemaining: -1}
+}
+
+// startOrg resets the repo counters for the backup of the 'total' repos of
+// 'org'
+func (p *progressTracker) startOrg(org string, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.org = org
+	p.reposTotal = total
+	p.reposDone = 0
+	p.reposFailed = 0
+	p.active = map[string]*repoProgress{}
+}
+
+// setStep records that 'repoName' is now at 'step', e.g. "cloning"
+func (p *progressTracker) setStep(repoName, step string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.active[repoName]
+	if !ok {
+		r = &repoProgress{startedAt: time.Now()}
+		p.active[repoName] = r
+	}
+	r.step = step
+}
+
+// finishRepo records that 'repoName' is done, successfully or not
+func (p *progressTracker) finishRepo(repoName string, failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, repoName)
+	p.reposDone++
+	if failed {
+		p.reposFailed++
+	}
+}
+
+// addIssue records that an issue with 'comments' comments was written
+func (p *progressTracker) addIssue(comments int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issues++
+	p.comments += comments
+}
+
+// observe records the rate limit headroom from the headers of 'resp'
+func (p *progressTracker) observe(resp *http.Response) {
+	if p == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rateRemaining = remaining
+	p.rateLimit = limit
+	p.rateReset = time.Unix(reset, 0)
+}
+
+// Write keeps the last complete line of what's logged, so the dashboard can
+// show it
+func (p *progressTracker) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, b...)
+	for {
+		i := strings.IndexByte(string(p.partial), '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(p.partial[:i])); len(line) != 0 {
+			p.lastLine = line
+		}
+		p.partial = p.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+// render returns the lines of the dashboard
+func (p *progressTracker) render() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lines := []string{fmt.Sprintf("Backing up %s", p.org)}
+
+	const barWidth = 30
+	filled := 0
+	percent := 0
+	if p.reposTotal != 0 {
+		filled = p.reposDone * barWidth / p.reposTotal
+		percent = p.reposDone * 100 / p.reposTotal
+	}
+	repos := fmt.Sprintf("Repos: [%s%s] %d/%d (%d%%)", strings.Repeat("#", filled),
+		strings.Repeat(".", barWidth-filled), p.reposDone, p.reposTotal, percent)
+	if p.reposFailed != 0 {
+		repos += fmt.Sprintf(", %d failed", p.reposFailed)
+	}
+	lines = append(lines, repos)
+	lines = append(lines, fmt.Sprintf("Issues: %d written, %d comments", p.issues, p.comments))
+	if p.rateRemaining >= 0 {
+		lines = append(lines, fmt.Sprintf("Rate limit: %d/%d left, resets in %v", p.rateRemaining,
+			p.rateLimit, time.Until(p.rateReset).Round(time.Second)))
+	}
+
+	names := []string{}
+	for name := range p.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i == tuiMaxActive {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(names)-tuiMaxActive))
+			break
+		}
+		r := p.active[name]
+		lines = append(lines, fmt.Sprintf("  %s: %s (%v)", name, r.step,
+			time.Since(r.startedAt).Round(time.Second)))
+	}
+	if len(p.lastLine) != 0 {
+		lines = append(lines, "Last: "+p.lastLine)
+	}
+	for i, line := range lines {
+		if len(line) > tuiMaxWidth {
+			lines[i] = line[:tuiMaxWidth-3] + "..."
+		}
+	}
+	return lines
+}
+
+// terminalMuted is true while the -tui dashboard owns the terminal: the run
+// log then only writes to its file
+var terminalMuted atomic.Bool
+
+// mutableWriter writes to 'w' unless the terminal is muted
+type mutableWriter struct {
+	w io.Writer
+}
+
+func (m *mutableWriter) Write(b []byte) (int, error) {
+	if terminalMuted.Load() {
+		return len(b), nil
+	}
+	return m.w.Write(b)
+}
+
+// tuiDashboard redraws the state of 'tracker' in place on 'out'
+type tuiDashboard struct {
+	out       *os.File
+	tracker   *progressTracker
+	lineCount int
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// isTerminal returns true if 'f' is a terminal the dashboard can be drawn on
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// startTUIDashboard draws the dashboard of 'tracker' on 'out' until it's
+// stopped. What's logged in the meantime only goes to the run log
+func startTUIDashboard(out *os.File, tracker *progressTracker) *tuiDashboard {
+	d := &tuiDashboard{out: out, tracker: tracker,
+		stop: make(chan struct{}), done: make(chan struct{})}
+	terminalMuted.Store(true)
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(tuiRefreshInterval)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-ticker.C:
+			case <-d.stop:
+				d.draw()
+				return
+			}
+		}
+	}()
+	return d
+}
+
+// draw replaces the previous frame with the current one
+func (d *tuiDashboard) draw() {
+	var b strings.Builder
+	if d.lineCount != 0 {
+		// Back to the start of the previous frame, then clear it
+		fmt.Fprintf(&b, "\x1b[%dF\x1b[J", d.lineCount)
+	}
+	lines := d.tracker.render()
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	d.lineCount = len(lines)
+	d.out.WriteString(b.String())
+}
+
+// stopTUIDashboard draws the last frame and hands the terminal back to the
+// log
+func (d *tuiDashboard) stopTUIDashboard() {
+	close(d.stop)
+	<-d.done
+	terminalMuted.Store(false)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/afjoseph/clone_your_org/export"
+	"github.com/afjoseph/commongo/print"
+)
+
+const schemaFileName = "schema.json"
+
+// The optional 'mr_' is mergeRequestFilePrefix
+var (
+	issueJSONFileRegexp    = regexp.MustCompile(`^(mr_)?\d{6}\.json$`)
+	issueEntriesFileRegexp = regexp.MustCompile(`^(mr_)?\d{6}\.entries\.json$`)
+)
+
+// schemaNameForFile returns which export schema applies to the file at
+// 'path', or an empty string if it isn't an exported JSON document
+func schemaNameForFile(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case name == manifestFileName:
+		return "manifest"
+	case name == "repo.json":
+		return "repo"
+	case issueJSONFileRegexp.MatchString(name):
+		return "issue"
+	case issueEntriesFileRegexp.MatchString(name):
+		return "entries"
+	}
+	return ""
+}
+
+// writeSchemas writes the schema of every exported document to the root of
+// 'backupDirPath', so a backup documents its own format
+func writeSchemas(backupDirPath string) error {
+	return writeJSONFile(filepath.Join(backupDirPath, schemaFileName), export.Schemas())
+}
+
+// validateBackup walks 'backupDirPath' and validates every exported JSON
+// document it finds against the current export schema
+func validateBackup(backupDirPath string) error {
+	print.DebugFunc()
+
+	schemas := export.Schemas()
+	checkedCount := 0
+	invalidCount := 0
+	err := filepath.Walk(backupDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Don't descend into git mirrors
+		if info.IsDir() && filepath.Ext(path) == ".git" {
+			return filepath.SkipDir
+		}
+		schemaName := schemaNameForFile(path)
+		if info.IsDir() || len(schemaName) == 0 {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// XXX Backups made with -bom start with one, which isn't valid JSON
+		data = bytes.TrimPrefix(data, utf8BOM)
+		checkedCount++
+		errs := export.Validate(schemas[schemaName], data)
+		if len(errs) != 0 {
+			invalidCount++
+			print.Warnf("%s doesn't conform to the %s schema:\n", path, schemaName)
+			for _, err := range errs {
+				print.Warnf("    %v\n", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	print.Infof("Validated %d files in %s: %d invalid\n", checkedCount, backupDirPath, invalidCount)
+	if invalidCount != 0 {
+		return print.Errorf("%d files don't conform to the export schema (version %d)",
+			invalidCount, export.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+const variablesFileName = "variables.json"
+
+// variableBackup is what gets written for each Actions variable
+type variableBackup struct {
+	Name      string     `json:"name"`
+	Value     string     `json:"value"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// backupRepoVariables uses 'client' and 'ctx' to write the Actions variables
+// of 'repo', with their values, to 'variables.json' in its meta directory.
+//
+// XXX Unlike secrets, variables aren't encrypted: their values are written as
+// is. Repos with Actions disabled, or which the token can't see the variables
+// of, are skipped
+func backupRepoVariables(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	owner, name := *repo.Owner.Login, *repo.Name
+	opts := &github.ListOptions{PerPage: 30}
+	variables, err := paginate(ctx, "variables", func(page int) ([]*github.ActionsVariable, *github.Response, error) {
+		opts.Page = page
+		resp, httpResp, err := client.Actions.ListRepoVariables(ctx, owner, name, opts)
+		if err != nil {
+			return nil, httpResp, err
+		}
+		return resp.Variables, httpResp, nil
+	})
+	if err != nil {
+		if isAccessDenied(err) {
+			print.Debugf("Skipping variables of %s: %v\n", name, err)
+			return nil
+		}
+		return err
+	}
+	out := []variableBackup{}
+	for _, variable := range variables {
+		backup := variableBackup{Name: variable.Name, Value: variable.Value}
+		if variable.UpdatedAt != nil {
+			backup.UpdatedAt = &variable.UpdatedAt.Time
+		}
+		out = append(out, backup)
+	}
+	targetDir := repoArtifactPath(backupDirPath, name, artifactMeta)
+	err = os.MkdirAll(targetDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(targetDir, variablesFileName), out)
+}
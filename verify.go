@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/afjoseph/commongo/util"
+	"github.com/google/go-github/v76/github"
+)
+
+// verifyRepoMirror checks the mirror of 'repo' in 'backupDirPath' isn't
+// truncated: it runs 'git fsck' on it and, if 'client' is supplied, compares
+// its branches with what the API reports.
+//
+// XXX If someone pushes between the clone and this check, the default branch
+// will look like a mismatch. Re-running the backup fixes it.
+func verifyRepoMirror(client *github.Client, ctx context.Context,
+	backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	gitDir := repoArtifactPath(backupDirPath, *repo.Name, artifactCode)
+	if !util.IsDirectory(gitDir) {
+		return print.Errorf("no mirror found at %s", gitDir)
+	}
+	print.Debugf("Verifying mirror at %s...\n", gitDir)
+	_, err := runCommand(ctx, "", nil, "git", "--git-dir", gitDir, "fsck", "--no-progress")
+	if err != nil {
+		return print.Errorf("git fsck failed: %v", err)
+	}
+	// XXX Full ref names: short ones are ambiguous when a tag has the same
+	// name as a branch
+	snapshot, err := readRefSnapshot(ctx, gitDir)
+	if err != nil {
+		return err
+	}
+	localBranches := snapshot.Branches
+	if len(localBranches) == 0 && repo.GetSize() == 0 {
+		print.Debugf("Mirror at %s is an empty repo: nothing to verify\n", gitDir)
+		return nil
+	}
+	defaultBranch := repo.GetDefaultBranch()
+	if len(defaultBranch) != 0 {
+		if _, ok := localBranches[defaultBranch]; !ok {
+			return print.Errorf("default branch %s is missing from the mirror", defaultBranch)
+		}
+	}
+	if client == nil {
+		return nil
+	}
+
+	opts := &github.BranchListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	remoteBranches, err := paginate(ctx, "branches", func(page int) ([]*github.Branch, *github.Response, error) {
+		opts.Page = page
+		return client.Repositories.ListBranches(ctx, *repo.Owner.Login, *repo.Name, opts)
+	})
+	if err != nil {
+		return err
+	}
+	if len(remoteBranches) != len(localBranches) {
+		return print.Errorf("mirror has %d branches but the remote has %d",
+			len(localBranches), len(remoteBranches))
+	}
+	for _, branch := range remoteBranches {
+		if branch.GetName() != defaultBranch {
+			continue
+		}
+		if localBranches[defaultBranch] != branch.GetCommit().GetSHA() {
+			return print.Errorf("default branch %s is at %s in the mirror but at %s on the remote",
+				defaultBranch, localBranches[defaultBranch], branch.GetCommit().GetSHA())
+		}
+	}
+	print.Debugf("Mirror at %s verified: %d branches\n", gitDir, len(localBranches))
+	return nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed VERSION
+var versionFile string
+
+// version is the current version of clone_your_org, as written in VERSION
+var version = strings.TrimSpace(versionFile)
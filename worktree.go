@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/afjoseph/commongo/print"
+	"github.com/google/go-github/v76/github"
+)
+
+// exportWorktree checks out the tip of the branch the mirror of 'repo' points
+// to, which must already be cloned, to '<name>__src/': a shallow, non-bare
+// clone of the mirror that can be browsed without knowing git.
+//
+// XXX It's recreated from scratch every run, so it always matches the mirror.
+// Empty repos have nothing to check out and are skipped
+func exportWorktree(ctx context.Context, backupDirPath string, repo *github.Repository) error {
+	print.DebugFunc()
+
+	mirrorDir, err := filepath.Abs(repoArtifactPath(backupDirPath, *repo.Name, artifactCode))
+	if err != nil {
+		return err
+	}
+	targetDir := repoArtifactPath(backupDirPath, *repo.Name, artifactSource)
+	_, err = runCommand(ctx, mirrorDir, nil, "git", "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		print.Debugf("Skipping the worktree of %s: nothing to check out\n", *repo.Name)
+		return nil
+	}
+	err = os.RemoveAll(targetDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(targetDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	print.Debugf("Checking out %s to %s...\n", *repo.Name, targetDir)
+	// XXX --depth is ignored for local paths: file:// makes git actually
+	// transfer just the tip instead of hardlinking the whole mirror
+	_, err = runCommand(ctx, "", nil, "git", "clone", "--quiet", "--depth", "1",
+		"file://"+filepath.ToSlash(mirrorDir), targetDir)
+	return err
+}